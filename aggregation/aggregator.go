@@ -0,0 +1,193 @@
+package aggregation
+
+import (
+	. "awesomeProject/model"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// AggregatorConfig sets when merged incidents are reported.
+type AggregatorConfig struct {
+	QuietPeriod   time.Duration // A merged incident is reported once no occurrence was seen for this long
+	MaxAge        time.Duration // A merged incident is reported at the latest this long after its first occurrence
+	MaxSamples    int           // Sample packets kept per merged incident
+	MaxAggregates int           // Merged incidents held at once, the oldest is reported early when exceeded
+}
+
+// DefaultAggregatorConfig returns a configuration reporting a flood once it stopped for 30 seconds,
+// and at least every 5 minutes while it goes on.
+func DefaultAggregatorConfig() AggregatorConfig {
+	return AggregatorConfig{
+		QuietPeriod:   30 * time.Second,
+		MaxAge:        5 * time.Minute,
+		MaxSamples:    5,
+		MaxAggregates: 10000,
+	}
+}
+
+// Validate checks that the configuration describes a usable aggregator.
+func (config AggregatorConfig) Validate() error {
+	if config.QuietPeriod <= 0 {
+		return fmt.Errorf("quiet period must be positive, got %s", config.QuietPeriod)
+	}
+	if config.MaxAge < config.QuietPeriod {
+		return fmt.Errorf("max age must be at least the quiet period, got %s", config.MaxAge)
+	}
+	if config.MaxSamples < 1 || config.MaxAggregates < 1 {
+		return fmt.Errorf("max samples and max aggregates must be at least 1, got %d and %d", config.MaxSamples, config.MaxAggregates)
+	}
+	return nil
+}
+
+// FlushInterval returns how often Flush should run to honor the quiet period.
+func (config AggregatorConfig) FlushInterval() time.Duration {
+	return max(config.QuietPeriod/4, time.Second)
+}
+
+// Aggregator merges repeated incidents of a rule by type, source and destination into a single incident.
+// The merged incident keeps the ID and description of the first occurrence, counts the occurrences, tracks when
+// they were first and last seen, takes the highest severity and confidence and keeps a few sample packets.
+// It is handed to the report function when the quiet period or the max age ends. It is safe for concurrent use.
+type Aggregator struct {
+	config  AggregatorConfig
+	report  func(incident *Incident)
+	mu      sync.Mutex
+	pending map[aggregateKey]*Incident
+}
+
+// aggregateKey identifies the incidents merged together.
+type aggregateKey struct {
+	rule         string
+	incidentType IncidentType
+	src          string
+	dst          string
+}
+
+// NewAggregator creates an aggregator handing merged incidents to report.
+func NewAggregator(config AggregatorConfig, report func(incident *Incident)) (*Aggregator, error) {
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid incident aggregation configuration: %w", err)
+	}
+	return &Aggregator{
+		config:  config,
+		report:  report,
+		pending: map[aggregateKey]*Incident{},
+	}, nil
+}
+
+// Pending returns the number of merged incidents waiting to be reported.
+func (aggregator *Aggregator) Pending() int {
+	aggregator.mu.Lock()
+	defer aggregator.mu.Unlock()
+	return len(aggregator.pending)
+}
+
+// Add merges the incident into the pending incident with the same rule, type, source and destination,
+// or starts a new one.
+func (aggregator *Aggregator) Add(incident *Incident) {
+	key := keyOf(incident)
+
+	aggregator.mu.Lock()
+	merged, exists := aggregator.pending[key]
+	if exists {
+		merged.Count += incident.Count
+		merged.FirstSeen = minTime(merged.FirstSeen, incident.FirstSeen)
+		merged.LastSeen = maxTime(merged.LastSeen, incident.LastSeen)
+		merged.Severity = max(merged.Severity, incident.Severity)
+		merged.Confidence = max(merged.Confidence, incident.Confidence)
+		if incident.Attempt != nil && len(merged.Samples) < aggregator.config.MaxSamples {
+			merged.Samples = append(merged.Samples, incident.Attempt)
+		}
+		aggregator.mu.Unlock()
+		return
+	}
+
+	if incident.Attempt != nil && len(incident.Samples) == 0 {
+		incident.Samples = []*Packet{incident.Attempt}
+	}
+	aggregator.pending[key] = incident
+
+	var evicted *Incident
+	if len(aggregator.pending) > aggregator.config.MaxAggregates {
+		evicted = aggregator.removeOldest()
+	}
+	aggregator.mu.Unlock()
+
+	if evicted != nil {
+		aggregator.report(evicted)
+	}
+}
+
+// Flush reports the merged incidents whose quiet period or max age ended at the given time.
+func (aggregator *Aggregator) Flush(now time.Time) {
+	aggregator.mu.Lock()
+	due := []*Incident{}
+	for key, merged := range aggregator.pending {
+		if now.Sub(merged.LastSeen) >= aggregator.config.QuietPeriod || now.Sub(merged.FirstSeen) >= aggregator.config.MaxAge {
+			due = append(due, merged)
+			delete(aggregator.pending, key)
+		}
+	}
+	aggregator.mu.Unlock()
+
+	for _, merged := range due {
+		aggregator.report(merged)
+	}
+}
+
+// FlushAll reports every pending merged incident. It is used on shutdown.
+func (aggregator *Aggregator) FlushAll() {
+	aggregator.mu.Lock()
+	due := make([]*Incident, 0, len(aggregator.pending))
+	for key, merged := range aggregator.pending {
+		due = append(due, merged)
+		delete(aggregator.pending, key)
+	}
+	aggregator.mu.Unlock()
+
+	for _, merged := range due {
+		aggregator.report(merged)
+	}
+}
+
+// removeOldest removes and returns the pending incident first seen the longest ago.
+func (aggregator *Aggregator) removeOldest() *Incident {
+	var oldestKey aggregateKey
+	var oldest *Incident
+	for key, merged := range aggregator.pending {
+		if oldest == nil || merged.FirstSeen.Before(oldest.FirstSeen) {
+			oldestKey, oldest = key, merged
+		}
+	}
+	delete(aggregator.pending, oldestKey)
+	return oldest
+}
+
+// keyOf returns the key of the incident. Sources counted under an IPv6 prefix are merged by prefix.
+func keyOf(incident *Incident) aggregateKey {
+	key := aggregateKey{rule: incident.Rule, incidentType: incident.Type, src: incident.IP.String()}
+	if incident.SourcePrefix.IsValid() {
+		key.src = incident.SourcePrefix.String()
+	}
+	if incident.Attempt != nil {
+		key.dst = incident.Attempt.DstIP.String()
+	}
+	return key
+}
+
+// minTime returns the earlier of two times.
+func minTime(a, b time.Time) time.Time {
+	if b.Before(a) {
+		return b
+	}
+	return a
+}
+
+// maxTime returns the later of two times.
+func maxTime(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
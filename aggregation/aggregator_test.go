@@ -0,0 +1,231 @@
+package aggregation
+
+import (
+	. "awesomeProject/model"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+var start = time.Unix(1700000000, 0)
+
+// occurrence describes an incident raised at a time since start.
+type occurrence struct {
+	rule     string
+	src, dst string
+	at       time.Duration
+	severity Severity
+}
+
+func TestAggregatorMergesIncidents(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxSamples  int
+		occurrences []occurrence
+		prefix      string   // Source prefix the rule counted the sources under, if any
+		reports     []string // Summaries of the merged incidents, see summarize
+	}{
+		{
+			name: "same source and destination",
+			occurrences: []occurrence{
+				{"ddos", "10.0.0.1", "10.0.0.9", 0, SeverityLow},
+				{"ddos", "10.0.0.1", "10.0.0.9", 2 * time.Second, SeverityHigh},
+				{"ddos", "10.0.0.1", "10.0.0.9", time.Second, SeverityMedium},
+			},
+			reports: []string{"ddos 10.0.0.1->10.0.0.9 x3 0s-2s High samples 3"},
+		},
+		{
+			name: "other destination, source or rule",
+			occurrences: []occurrence{
+				{"ddos", "10.0.0.1", "10.0.0.9", 0, SeverityLow},
+				{"ddos", "10.0.0.1", "10.0.0.8", 0, SeverityLow},
+				{"ddos", "10.0.0.2", "10.0.0.9", 0, SeverityLow},
+				{"port_scanning", "10.0.0.1", "10.0.0.9", 0, SeverityLow},
+			},
+			reports: []string{
+				"ddos 10.0.0.1->10.0.0.8 x1 0s-0s Low samples 1",
+				"ddos 10.0.0.1->10.0.0.9 x1 0s-0s Low samples 1",
+				"ddos 10.0.0.2->10.0.0.9 x1 0s-0s Low samples 1",
+				"port_scanning 10.0.0.1->10.0.0.9 x1 0s-0s Low samples 1",
+			},
+		},
+		{
+			name: "sources of an IPv6 prefix",
+			occurrences: []occurrence{
+				{"ddos", "2001:db8::1", "2001:db8:ffff::1", 0, SeverityLow},
+				{"ddos", "2001:db8::2", "2001:db8:ffff::1", time.Second, SeverityLow},
+			},
+			prefix:  "2001:db8::/64",
+			reports: []string{"ddos 2001:db8::1->2001:db8:ffff::1 x2 0s-1s Low samples 2"},
+		},
+		{
+			name:       "samples capped",
+			maxSamples: 2,
+			occurrences: []occurrence{
+				{"ddos", "10.0.0.1", "10.0.0.9", 0, SeverityLow},
+				{"ddos", "10.0.0.1", "10.0.0.9", time.Second, SeverityLow},
+				{"ddos", "10.0.0.1", "10.0.0.9", 2 * time.Second, SeverityLow},
+			},
+			reports: []string{"ddos 10.0.0.1->10.0.0.9 x3 0s-2s Low samples 2"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := DefaultAggregatorConfig()
+			if test.maxSamples > 0 {
+				config.MaxSamples = test.maxSamples
+			}
+			aggregator, reported := newTestAggregator(t, config)
+
+			var first *Incident
+			for _, occurrence := range test.occurrences {
+				incident := occurrence.incident()
+				if test.prefix != "" {
+					incident.SourcePrefix = netip.MustParsePrefix(test.prefix)
+				}
+				if first == nil {
+					first = incident
+				}
+				aggregator.Add(incident)
+			}
+			aggregator.FlushAll()
+
+			incidents := reported.incidents()
+			if got := summarize(incidents); !slices.Equal(got, test.reports) {
+				t.Errorf("reported %q, want %q", got, test.reports)
+			}
+			if len(incidents) > 0 && !slices.ContainsFunc(incidents, func(incident *Incident) bool { return incident.ID == first.ID }) {
+				t.Errorf("the merged incidents don't keep the ID of the first occurrence")
+			}
+			if aggregator.Pending() != 0 {
+				t.Errorf("%d incidents pending after flushing all", aggregator.Pending())
+			}
+		})
+	}
+}
+
+func TestAggregatorReportsWhenDue(t *testing.T) {
+	config := DefaultAggregatorConfig()
+	config.QuietPeriod, config.MaxAge, config.MaxAggregates = 10*time.Second, time.Minute, 2
+
+	tests := []struct {
+		name        string
+		occurrences []occurrence
+		flush       time.Duration // Time of the flush since start
+		reports     []string
+		pending     int
+	}{
+		{
+			name:        "within the quiet period",
+			occurrences: []occurrence{{"ddos", "10.0.0.1", "10.0.0.9", 0, SeverityLow}, {"ddos", "10.0.0.1", "10.0.0.9", 5 * time.Second, SeverityLow}},
+			flush:       14 * time.Second,
+			pending:     1,
+		},
+		{
+			name:        "quiet period ended",
+			occurrences: []occurrence{{"ddos", "10.0.0.1", "10.0.0.9", 0, SeverityLow}, {"ddos", "10.0.0.1", "10.0.0.9", 5 * time.Second, SeverityLow}},
+			flush:       15 * time.Second,
+			reports:     []string{"ddos 10.0.0.1->10.0.0.9 x2 0s-5s Low samples 2"},
+		},
+		{
+			name: "ongoing flood reaching the max age",
+			occurrences: []occurrence{
+				{"ddos", "10.0.0.1", "10.0.0.9", 0, SeverityLow},
+				{"ddos", "10.0.0.1", "10.0.0.9", 30 * time.Second, SeverityLow},
+				{"ddos", "10.0.0.1", "10.0.0.9", 55 * time.Second, SeverityLow},
+			},
+			flush:   time.Minute,
+			reports: []string{"ddos 10.0.0.1->10.0.0.9 x3 0s-55s Low samples 3"},
+		},
+		{
+			name: "oldest evicted beyond max aggregates",
+			occurrences: []occurrence{
+				{"ddos", "10.0.0.2", "10.0.0.9", time.Second, SeverityLow},
+				{"ddos", "10.0.0.1", "10.0.0.9", 0, SeverityLow},
+				{"ddos", "10.0.0.3", "10.0.0.9", 2 * time.Second, SeverityLow},
+			},
+			reports: []string{"ddos 10.0.0.1->10.0.0.9 x1 0s-0s Low samples 1"},
+			pending: 2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			aggregator, reported := newTestAggregator(t, config)
+			for _, occurrence := range test.occurrences {
+				aggregator.Add(occurrence.incident())
+			}
+			if test.flush > 0 {
+				aggregator.Flush(start.Add(test.flush))
+			}
+
+			if got := summarize(reported.incidents()); !slices.Equal(got, test.reports) {
+				t.Errorf("reported %q, want %q", got, test.reports)
+			}
+			if aggregator.Pending() != test.pending {
+				t.Errorf("%d incidents pending, want %d", aggregator.Pending(), test.pending)
+			}
+		})
+	}
+}
+
+// incident returns the incident described by the occurrence, with a TCP packet to port 80 as its attempt.
+func (occurrence occurrence) incident() *Incident {
+	attempt := &Packet{
+		Timestamp: start.Add(occurrence.at),
+		SrcIP:     net.ParseIP(occurrence.src),
+		DstIP:     net.ParseIP(occurrence.dst),
+		Protocol:  ProtocolTCP,
+		DstPort:   80,
+	}
+	incident := NewIncident(attempt.SrcIP, DDoSAttack, attempt.Timestamp, attempt)
+	incident.Rule = occurrence.rule
+	incident.Severity = occurrence.severity
+	return incident
+}
+
+// reportedIncidents collects the incidents reported by an aggregator.
+type reportedIncidents struct {
+	mu   sync.Mutex
+	list []*Incident
+}
+
+// newTestAggregator returns an aggregator reporting to the returned collection.
+func newTestAggregator(t *testing.T, config AggregatorConfig) (*Aggregator, *reportedIncidents) {
+	t.Helper()
+	reported := &reportedIncidents{}
+	aggregator, err := NewAggregator(config, func(incident *Incident) {
+		reported.mu.Lock()
+		defer reported.mu.Unlock()
+		reported.list = append(reported.list, incident)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return aggregator, reported
+}
+
+// incidents returns the incidents reported so far.
+func (reported *reportedIncidents) incidents() []*Incident {
+	reported.mu.Lock()
+	defer reported.mu.Unlock()
+	return slices.Clone(reported.list)
+}
+
+// summarize describes each merged incident by rule, addresses, count, first and last occurrence since start,
+// severity and samples, sorted.
+func summarize(incidents []*Incident) []string {
+	summaries := []string{}
+	for _, incident := range incidents {
+		summaries = append(summaries, fmt.Sprintf("%s %s->%s x%d %s-%s %s samples %d", incident.Rule, incident.IP,
+			incident.DstIP, incident.Count, incident.FirstSeen.Sub(start), incident.LastSeen.Sub(start), incident.Severity,
+			len(incident.Samples)))
+	}
+	slices.Sort(summaries)
+	return summaries
+}
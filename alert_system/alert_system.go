@@ -1,14 +1,65 @@
 package alert_system
 
-import "fmt"
+import (
+	. "awesomeProject/model"
+	"errors"
+	"fmt"
+	"io"
+)
 
-// AlertSystem notifies users of detected incidents.
+// Channel delivers alerts about incidents to users.
+type Channel interface {
+	Send(incident *Incident) error
+}
+
+// AlertSystem notifies users of detected incidents on every channel. It is an output sink.
 type AlertSystem struct {
-	// Placeholder for notification channels (e.g., email, SMS)
+	Channels []Channel // Notification channels (e.g., stdout, email, SMS)
+}
+
+// NewAlertSystem creates an AlertSystem notifying the given channels.
+func NewAlertSystem(channels ...Channel) *AlertSystem {
+	return &AlertSystem{Channels: channels}
+}
+
+// Write sends the incident to every channel and returns the errors of the channels that failed.
+func (alert *AlertSystem) Write(incident *Incident) error {
+	var errs []error
+	for _, channel := range alert.Channels {
+		if err := channel.Send(incident); err != nil {
+			errs = append(errs, fmt.Errorf("error sending alert: %w", err))
+		}
+	}
+	return errors.Join(errs...)
 }
 
-// Notify simulates notifying users of detected incidents.
-func (alert *AlertSystem) Notify(incident string) {
-	// Implement notification logic (e.g., email, SMS)
-	fmt.Println("Alert:", incident)
+// Close closes the channels holding resources, e.g. connections or background deliveries.
+func (alert *AlertSystem) Close() error {
+	var errs []error
+	for _, channel := range alert.Channels {
+		if closer, ok := channel.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("error closing alert channel: %w", err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// FormatAlert returns the one-line alert message of an incident.
+func FormatAlert(incident *Incident) string {
+	message := fmt.Sprintf("[%s] Incident detected at %s from IP %s on %s with type: %s", incident.Severity, incident.Timestamp, incident.IP, incident.Interface, incident.Type)
+	if incident.Count > 1 {
+		message += fmt.Sprintf(" (%d times until %s)", incident.Count, incident.LastSeen)
+	}
+	return message
+}
+
+// StdoutChannel prints alerts to the standard output.
+type StdoutChannel struct{}
+
+// Send prints the alert message of the incident.
+func (channel *StdoutChannel) Send(incident *Incident) error {
+	_, err := fmt.Println("Alert:", FormatAlert(incident))
+	return err
 }
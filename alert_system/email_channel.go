@@ -0,0 +1,535 @@
+package alert_system
+
+import (
+	. "awesomeProject/model"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// EmailSecurity is how the connection to the SMTP server is encrypted.
+type EmailSecurity int
+
+const (
+	StartTLS    EmailSecurity = iota // The connection is upgraded with STARTTLS, which the server must support
+	ImplicitTLS                      // The connection is encrypted from the start, usually on port 465
+	NoTLS                            // The connection isn't encrypted, only for servers on a trusted network, without authentication but on localhost
+)
+
+// String method for better readability
+func (security EmailSecurity) String() string {
+	switch security {
+	case StartTLS:
+		return "starttls"
+	case ImplicitTLS:
+		return "tls"
+	case NoTLS:
+		return "none"
+	default:
+		return "Unknown Email Security"
+	}
+}
+
+// ParseEmailSecurity parses the name of an email security, "starttls", "tls" or "none".
+func ParseEmailSecurity(name string) (EmailSecurity, error) {
+	for _, security := range []EmailSecurity{StartTLS, ImplicitTLS, NoTLS} {
+		if strings.EqualFold(security.String(), name) {
+			return security, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown email security %q (expected starttls, tls or none)", name)
+}
+
+const (
+	DefaultEmailPort           = 587
+	DefaultEmailDigestInterval = 15 * time.Minute
+	DefaultEmailTimeout        = 30 * time.Second
+	DefaultEmailSubjectPrefix  = "[NIDS]"
+	DefaultEmailMaxGroups      = 1000
+)
+
+// EmailConfig sets the SMTP server an EmailChannel sends through, the recipients and when alerts are sent.
+type EmailConfig struct {
+	Host              string
+	Port              int
+	Security          EmailSecurity
+	TLS               *tls.Config // Client configuration for the TLS connection, the system roots are trusted if nil
+	Username          string      // Authenticates with PLAIN if set
+	Password          string
+	From              string        // Sender address, e.g. "NIDS <nids@example.com>"
+	To                []string      // Recipient addresses
+	ImmediateSeverity Severity      // Incidents of this severity or higher are sent right away, the others in the digest
+	DigestInterval    time.Duration // Period of the digest
+	MaxGroups         int           // Groups listed in a digest at most, further incidents are only counted
+	SubjectPrefix     string
+	Timeout           time.Duration // Limit for sending an email
+}
+
+// DefaultEmailConfig returns the configuration of an email channel sending critical incidents right away and
+// the others in a digest every 15 minutes, through a server on the submission port with STARTTLS.
+func DefaultEmailConfig(host, from string, to ...string) EmailConfig {
+	return EmailConfig{
+		Host:              host,
+		Port:              DefaultEmailPort,
+		Security:          StartTLS,
+		From:              from,
+		To:                to,
+		ImmediateSeverity: SeverityCritical,
+		DigestInterval:    DefaultEmailDigestInterval,
+		SubjectPrefix:     DefaultEmailSubjectPrefix,
+		MaxGroups:         DefaultEmailMaxGroups,
+		Timeout:           DefaultEmailTimeout,
+	}
+}
+
+// Validate checks that the configuration describes a usable email channel.
+func (config EmailConfig) Validate() error {
+	if config.Host == "" {
+		return errors.New("SMTP host is required")
+	}
+	if config.Port <= 0 || config.Port > 65535 {
+		return fmt.Errorf("SMTP port must be between 1 and 65535, got %d", config.Port)
+	}
+	if config.Security < StartTLS || config.Security > NoTLS {
+		return fmt.Errorf("unknown email security %d", int(config.Security))
+	}
+	if config.Security == NoTLS && config.Username != "" && !isLocalhost(config.Host) {
+		// net/smtp refuses to send the password unencrypted to anything but the local host
+		return errors.New("SMTP authentication requires starttls or tls security unless the server is on localhost")
+	}
+	if _, err := mail.ParseAddress(config.From); err != nil {
+		return fmt.Errorf("invalid sender address %q: %w", config.From, err)
+	}
+	if len(config.To) == 0 {
+		return errors.New("at least one recipient is required")
+	}
+	for _, to := range config.To {
+		if _, err := mail.ParseAddress(to); err != nil {
+			return fmt.Errorf("invalid recipient address %q: %w", to, err)
+		}
+	}
+	if config.DigestInterval <= 0 || config.Timeout <= 0 || config.MaxGroups <= 0 {
+		return errors.New("digest interval, digest groups and timeout must be positive")
+	}
+	return nil
+}
+
+// EmailChannel sends alerts by email. Incidents of the immediate severity or higher are sent right away,
+// one email each. Less severe incidents are collected and sent as a digest once per digest interval,
+// grouped by incident type and source IP. Emails have a plaintext and an HTML body.
+// A digest that can't be sent is kept and sent along with the next one.
+type EmailChannel struct {
+	config  EmailConfig
+	mu      sync.Mutex
+	digest  map[digestKey]*DigestGroup // Incidents waiting for the next digest
+	omitted int                        // Incidents of the next digest beyond its groups
+	since   time.Time                  // Start of the period covered by the next digest
+	sendMu  sync.Mutex                 // Serializes the sending of immediate alerts and digests
+	stop    chan struct{}
+	stopped chan struct{}
+	closed  sync.Once
+}
+
+// digestKey groups the incidents of a digest.
+type digestKey struct {
+	Type  IncidentType
+	SrcIP string
+}
+
+// DigestGroup summarizes the incidents of a type and source IP in a digest.
+type DigestGroup struct {
+	Type        IncidentType
+	SrcIP       string
+	Count       int       // Occurrences, merged incidents count as many as they merged
+	MaxSeverity Severity  // Highest severity among the incidents
+	FirstSeen   time.Time // First occurrence
+	LastSeen    time.Time // Last occurrence
+	Rules       []string  // Rules that raised the incidents
+}
+
+// NewEmailChannel creates an EmailChannel and starts sending its digests.
+func NewEmailChannel(config EmailConfig) (*EmailChannel, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	channel := &EmailChannel{
+		config:  config,
+		digest:  make(map[digestKey]*DigestGroup),
+		since:   time.Now(),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go channel.run()
+	return channel, nil
+}
+
+// Send emails the alert about a severe incident right away, or adds a less severe one to the next digest.
+func (channel *EmailChannel) Send(incident *Incident) error {
+	if incident.Severity >= channel.config.ImmediateSeverity {
+		subject := fmt.Sprintf("%s %s: %s from %s", channel.config.SubjectPrefix, incident.Severity, incident.Type, incident.IP)
+		return channel.send(subject, alertText, alertHTML, incident)
+	}
+
+	channel.mu.Lock()
+	defer channel.mu.Unlock()
+	channel.add(incident)
+	return nil
+}
+
+// SendDigest emails the digest of the incidents collected so far, if there are any.
+func (channel *EmailChannel) SendDigest() error {
+	channel.mu.Lock()
+	groups, omitted, since := channel.digest, channel.omitted, channel.since
+	channel.digest, channel.omitted, channel.since = make(map[digestKey]*DigestGroup), 0, time.Now()
+	channel.mu.Unlock()
+
+	if len(groups) == 0 {
+		return nil
+	}
+	data := newDigestData(groups, omitted, since, time.Now())
+	subject := fmt.Sprintf("%s Digest: %d incidents", channel.config.SubjectPrefix, data.Total)
+	if err := channel.send(subject, digestText, digestHTML, data); err != nil {
+		// keep the incidents for the next digest
+		channel.mu.Lock()
+		for _, group := range groups {
+			channel.merge(group)
+		}
+		channel.omitted += omitted
+		channel.since = since
+		channel.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Close stops the periodic digests and sends the last one.
+func (channel *EmailChannel) Close() error {
+	var err error
+	channel.closed.Do(func() {
+		close(channel.stop)
+		<-channel.stopped
+		err = channel.SendDigest()
+	})
+	return err
+}
+
+// run sends the digest once per digest interval until the channel is closed.
+func (channel *EmailChannel) run() {
+	defer close(channel.stopped)
+	ticker := time.NewTicker(channel.config.DigestInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := channel.SendDigest(); err != nil {
+				fmt.Printf("Error sending email digest: %v\n", err)
+			}
+		case <-channel.stop:
+			return
+		}
+	}
+}
+
+// add adds an incident to the group of its type and source IP.
+func (channel *EmailChannel) add(incident *Incident) {
+	group := &DigestGroup{
+		Type:        incident.Type,
+		SrcIP:       IPString(incident.IP),
+		Count:       max(incident.Count, 1),
+		MaxSeverity: incident.Severity,
+		FirstSeen:   incident.FirstSeen,
+		LastSeen:    incident.LastSeen,
+	}
+	if group.FirstSeen.IsZero() {
+		group.FirstSeen, group.LastSeen = incident.Timestamp, incident.Timestamp
+	}
+	if incident.Rule != "" {
+		group.Rules = []string{incident.Rule}
+	}
+	channel.merge(group)
+}
+
+// merge adds a group to the digest, combining it with the group of the same type and source IP.
+// Once the digest has the maximum number of groups, the incidents of further groups are only counted.
+func (channel *EmailChannel) merge(group *DigestGroup) {
+	key := digestKey{group.Type, group.SrcIP}
+	existing := channel.digest[key]
+	if existing == nil && len(channel.digest) >= channel.config.MaxGroups {
+		channel.omitted += group.Count
+		return
+	}
+	if existing == nil {
+		channel.digest[key] = group
+		return
+	}
+	existing.Count += group.Count
+	existing.MaxSeverity = max(existing.MaxSeverity, group.MaxSeverity)
+	if group.FirstSeen.Before(existing.FirstSeen) {
+		existing.FirstSeen = group.FirstSeen
+	}
+	if group.LastSeen.After(existing.LastSeen) {
+		existing.LastSeen = group.LastSeen
+	}
+	for _, rule := range group.Rules {
+		if !slices.Contains(existing.Rules, rule) {
+			existing.Rules = append(existing.Rules, rule)
+		}
+	}
+}
+
+// send renders the bodies from the data and emails them to the recipients.
+func (channel *EmailChannel) send(subject string, text *template.Template, html *htmltemplate.Template, data any) error {
+	var textBody, htmlBody bytes.Buffer
+	if err := text.Execute(&textBody, data); err != nil {
+		return fmt.Errorf("error rendering email: %w", err)
+	}
+	if err := html.Execute(&htmlBody, data); err != nil {
+		return fmt.Errorf("error rendering email: %w", err)
+	}
+	message, err := channel.message(subject, textBody.Bytes(), htmlBody.Bytes())
+	if err != nil {
+		return fmt.Errorf("error composing email: %w", err)
+	}
+
+	channel.sendMu.Lock()
+	defer channel.sendMu.Unlock()
+	if err := channel.deliver(message); err != nil {
+		return fmt.Errorf("error sending email through %s: %w", channel.config.Host, err)
+	}
+	return nil
+}
+
+// message composes a MIME message with alternative plaintext and HTML bodies.
+func (channel *EmailChannel) message(subject string, text, html []byte) ([]byte, error) {
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		content     []byte
+	}{
+		{"text/plain; charset=utf-8", text}, // the last part is preferred, so the plaintext comes first
+		{"text/html; charset=utf-8", html},
+	} {
+		writer, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		encoder := quotedprintable.NewWriter(writer)
+		encoder.Write(part.content)
+		if err := encoder.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	var message bytes.Buffer
+	domain := "localhost"
+	if from, err := mail.ParseAddress(channel.config.From); err == nil {
+		if at := strings.LastIndex(from.Address, "@"); at >= 0 {
+			domain = from.Address[at+1:]
+		}
+	}
+	headers := [][2]string{
+		{"From", channel.config.From},
+		{"To", strings.Join(channel.config.To, ", ")},
+		{"Subject", mime.QEncoding.Encode("utf-8", subject)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"Message-ID", fmt.Sprintf("<%s@%s>", NewIncidentID(), domain)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "multipart/alternative; boundary=" + parts.Boundary()},
+	}
+	for _, header := range headers {
+		fmt.Fprintf(&message, "%s: %s\r\n", header[0], header[1])
+	}
+	message.WriteString("\r\n")
+	message.Write(body.Bytes())
+	return message.Bytes(), nil
+}
+
+// deliver hands the message to the SMTP server.
+func (channel *EmailChannel) deliver(message []byte) error {
+	address := net.JoinHostPort(channel.config.Host, strconv.Itoa(channel.config.Port))
+	tlsConfig := channel.config.TLS
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.ServerName = channel.config.Host
+	}
+
+	dialer := &net.Dialer{Timeout: channel.config.Timeout}
+	var conn net.Conn
+	var err error
+	if channel.config.Security == ImplicitTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(channel.config.Timeout))
+
+	client, err := smtp.NewClient(conn, channel.config.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if channel.config.Security == StartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return errors.New("server doesn't support STARTTLS")
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if channel.config.Username != "" {
+		auth := smtp.PlainAuth("", channel.config.Username, channel.config.Password, channel.config.Host)
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+
+	from, _ := mail.ParseAddress(channel.config.From) // validated
+	if err := client.Mail(from.Address); err != nil {
+		return err
+	}
+	for _, to := range channel.config.To {
+		recipient, _ := mail.ParseAddress(to)
+		if err := client.Rcpt(recipient.Address); err != nil {
+			return err
+		}
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(message); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// digestData is what the digest templates are rendered from.
+type digestData struct {
+	Since   time.Time
+	Until   time.Time
+	Total   int            // Incidents, including the omitted ones
+	Omitted int            // Incidents beyond the groups
+	Groups  []*DigestGroup // Most severe and frequent first
+}
+
+// newDigestData orders the groups of a digest.
+func newDigestData(groups map[digestKey]*DigestGroup, omitted int, since, until time.Time) digestData {
+	data := digestData{Since: since, Until: until, Total: omitted, Omitted: omitted}
+	for _, group := range groups {
+		sort.Strings(group.Rules)
+		data.Groups = append(data.Groups, group)
+		data.Total += group.Count
+	}
+	sort.Slice(data.Groups, func(i, j int) bool {
+		a, b := data.Groups[i], data.Groups[j]
+		if a.MaxSeverity != b.MaxSeverity {
+			return a.MaxSeverity > b.MaxSeverity
+		}
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.SrcIP < b.SrcIP
+	})
+	return data
+}
+
+// The email bodies of a single incident and of a digest. The templates are rendered from an *Incident
+// and from a digestData.
+var (
+	alertText = template.Must(template.New("alert").Funcs(template.FuncMap{"percent": percent}).Parse(`{{.Severity}} incident detected: {{.Type}}
+
+Source:      {{.IP}}{{if .DstIP}}
+Destination: {{.DstIP}}{{if .DstPort}}:{{.DstPort}}{{end}}{{end}}{{if .Interface}}
+Interface:   {{.Interface}}{{end}}
+Time:        {{.Timestamp.Format "2006-01-02 15:04:05 MST"}}{{if gt .Count 1}}
+Occurrences: {{.Count}} until {{.LastSeen.Format "2006-01-02 15:04:05 MST"}}{{end}}{{if .Rule}}
+Rule:        {{.Rule}}{{if .RuleVersion}} {{.RuleVersion}}{{end}}{{end}}
+Confidence:  {{printf "%.0f" (percent .Confidence)}}%{{if .Description}}
+
+{{.Description}}{{end}}{{range .Techniques}}
+ATT&CK:      {{.ID}} {{.Name}} ({{.Tactic}}){{end}}
+
+Incident ID: {{.ID}}
+`))
+
+	alertHTML = htmltemplate.Must(htmltemplate.New("alert").Funcs(htmltemplate.FuncMap{"percent": percent}).Parse(`<html><body>
+<h2>{{.Severity}} incident detected: {{.Type}}</h2>
+<table>
+<tr><th align="left">Source</th><td>{{.IP}}</td></tr>
+{{if .DstIP}}<tr><th align="left">Destination</th><td>{{.DstIP}}{{if .DstPort}}:{{.DstPort}}{{end}}</td></tr>{{end}}
+{{if .Interface}}<tr><th align="left">Interface</th><td>{{.Interface}}</td></tr>{{end}}
+<tr><th align="left">Time</th><td>{{.Timestamp.Format "2006-01-02 15:04:05 MST"}}</td></tr>
+{{if gt .Count 1}}<tr><th align="left">Occurrences</th><td>{{.Count}} until {{.LastSeen.Format "2006-01-02 15:04:05 MST"}}</td></tr>{{end}}
+{{if .Rule}}<tr><th align="left">Rule</th><td>{{.Rule}}{{if .RuleVersion}} {{.RuleVersion}}{{end}}</td></tr>{{end}}
+<tr><th align="left">Confidence</th><td>{{printf "%.0f" (percent .Confidence)}}%</td></tr>
+{{range .Techniques}}<tr><th align="left">ATT&amp;CK</th><td>{{.ID}} {{.Name}} ({{.Tactic}})</td></tr>{{end}}
+</table>
+{{if .Description}}<p>{{.Description}}</p>{{end}}
+<p><small>Incident ID: {{.ID}}</small></p>
+</body></html>
+`))
+
+	digestText = template.Must(template.New("digest").Funcs(template.FuncMap{"join": strings.Join}).Parse(`{{.Total}} incidents in {{len .Groups}} groups by type and source between {{.Since.Format "2006-01-02 15:04:05"}} and {{.Until.Format "2006-01-02 15:04:05 MST"}}
+{{range .Groups}}
+- {{.MaxSeverity}} {{.Type}} from {{.SrcIP}}: {{.Count}} times, {{.FirstSeen.Format "15:04:05"}} to {{.LastSeen.Format "15:04:05"}}{{if .Rules}} ({{join .Rules ", "}}){{end}}{{end}}{{if .Omitted}}
+- {{.Omitted}} further incidents not listed{{end}}
+`))
+
+	digestHTML = htmltemplate.Must(htmltemplate.New("digest").Funcs(htmltemplate.FuncMap{"join": strings.Join}).Parse(`<html><body>
+<h2>{{.Total}} incidents in {{len .Groups}} groups by type and source</h2>
+<p>Between {{.Since.Format "2006-01-02 15:04:05"}} and {{.Until.Format "2006-01-02 15:04:05 MST"}}</p>
+<table border="1" cellpadding="4" cellspacing="0">
+<tr><th>Severity</th><th>Type</th><th>Source</th><th>Count</th><th>First seen</th><th>Last seen</th><th>Rules</th></tr>
+{{range .Groups}}<tr><td>{{.MaxSeverity}}</td><td>{{.Type}}</td><td>{{.SrcIP}}</td><td>{{.Count}}</td><td>{{.FirstSeen.Format "15:04:05"}}</td><td>{{.LastSeen.Format "15:04:05"}}</td><td>{{join .Rules ", "}}</td></tr>
+{{end}}</table>
+{{if .Omitted}}<p>{{.Omitted}} further incidents not listed</p>{{end}}
+</body></html>
+`))
+)
+
+// percent converts a ratio to a percentage.
+func percent(ratio float64) float64 {
+	return ratio * 100
+}
+
+// isLocalhost reports whether the host is one net/smtp allows to authenticate to without encryption.
+func isLocalhost(host string) bool {
+	return host == "localhost" || host == "127.0.0.1" || host == "::1"
+}
@@ -0,0 +1,337 @@
+package alert_system
+
+import (
+	. "awesomeProject/model"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEmailConfigValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(config *EmailConfig)
+		valid  bool
+	}{
+		{"default", func(config *EmailConfig) {}, true},
+		{"no host", func(config *EmailConfig) { config.Host = "" }, false},
+		{"invalid port", func(config *EmailConfig) { config.Port = 70000 }, false},
+		{"invalid sender", func(config *EmailConfig) { config.From = "nids" }, false},
+		{"no recipients", func(config *EmailConfig) { config.To = nil }, false},
+		{"invalid recipient", func(config *EmailConfig) { config.To = append(config.To, "soc@") }, false},
+		{"no digest interval", func(config *EmailConfig) { config.DigestInterval = 0 }, false},
+		{"authentication with tls", func(config *EmailConfig) { config.Security, config.Username = ImplicitTLS, "nids" }, true},
+		{"unencrypted", func(config *EmailConfig) { config.Security = NoTLS }, true},
+		{"unencrypted authentication", func(config *EmailConfig) { config.Security, config.Username = NoTLS, "nids" }, false},
+		{"unencrypted authentication on localhost", func(config *EmailConfig) {
+			config.Host, config.Security, config.Username = "localhost", NoTLS, "nids"
+		}, true},
+	}
+
+	for _, test := range tests {
+		config := DefaultEmailConfig("smtp.example.com", "NIDS <nids@example.com>", "soc@example.com")
+		test.modify(&config)
+		if err := config.Validate(); (err == nil) != test.valid {
+			t.Errorf("%s: got error %v, want valid %t", test.name, err, test.valid)
+		}
+	}
+}
+
+func TestEmailChannelSendsSevereIncidentsImmediately(t *testing.T) {
+	server := newSMTPServer(t)
+	channel := newTestEmailChannel(t, server)
+
+	if err := channel.Send(emailIncident(DDoSAttack, SeverityCritical, "192.0.2.1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := channel.Send(emailIncident(PortScanning, SeverityHigh, "192.0.2.1")); err != nil {
+		t.Fatal(err)
+	}
+
+	messages := server.messages()
+	if len(messages) != 1 {
+		t.Fatalf("server got %d emails, want the critical incident only", len(messages))
+	}
+	message := messages[0]
+	if message.subject != "[NIDS] Critical: DDoS Attack from 192.0.2.1" {
+		t.Errorf("got subject %q", message.subject)
+	}
+	if message.from != "nids@example.com" || !slices.Equal(message.to, []string{"soc@example.com", "noc@example.com"}) {
+		t.Errorf("got envelope from %s to %v", message.from, message.to)
+	}
+	for _, body := range []string{message.text, message.html} {
+		if !strings.Contains(body, "Critical incident detected: DDoS Attack") || !strings.Contains(body, "192.0.2.1") {
+			t.Errorf("body doesn't describe the incident:\n%s", body)
+		}
+	}
+	if !strings.HasPrefix(message.html, "<html>") || strings.Contains(message.text, "<") {
+		t.Errorf("plaintext and HTML bodies mixed up:\n%s\n%s", message.text, message.html)
+	}
+}
+
+func TestEmailChannelGroupsDigest(t *testing.T) {
+	server := newSMTPServer(t)
+	channel := newTestEmailChannel(t, server)
+
+	incidents := []*Incident{
+		emailIncident(PortScanning, SeverityLow, "192.0.2.1"),
+		emailIncident(PortScanning, SeverityHigh, "192.0.2.1"),
+		emailIncident(PortScanning, SeverityMedium, "192.0.2.1"),
+		emailIncident(PortScanning, SeverityLow, "192.0.2.2"),
+		emailIncident(SQLInjection, SeverityMedium, "192.0.2.1"),
+	}
+	incidents[2].Count = 4 // merged by the aggregator
+	for _, incident := range incidents {
+		if err := channel.Send(incident); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(server.messages()) != 0 {
+		t.Fatalf("incidents below the immediate severity were sent right away")
+	}
+	if err := channel.SendDigest(); err != nil {
+		t.Fatal(err)
+	}
+
+	messages := server.messages()
+	if len(messages) != 1 {
+		t.Fatalf("server got %d emails, want one digest", len(messages))
+	}
+	message := messages[0]
+	if message.subject != "[NIDS] Digest: 8 incidents" {
+		t.Errorf("got subject %q", message.subject)
+	}
+	if got, want := digestLines(message.text), []string{
+		"- High Port Scanning from 192.0.2.1: 6 times",
+		"- Medium SQL Injection from 192.0.2.1: 1 times",
+		"- Low Port Scanning from 192.0.2.2: 1 times",
+	}; !slices.Equal(got, want) {
+		t.Errorf("digest lists\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if rows := strings.Count(message.html, "<tr><td>"); rows != 3 {
+		t.Errorf("HTML digest has %d rows, want 3:\n%s", rows, message.html)
+	}
+
+	if err := channel.SendDigest(); err != nil || len(server.messages()) != 1 {
+		t.Errorf("an empty digest was sent (error %v)", err)
+	}
+}
+
+func TestEmailChannelKeepsDigestAfterFailure(t *testing.T) {
+	server := newSMTPServer(t)
+	channel := newTestEmailChannel(t, server)
+
+	channel.Send(emailIncident(PortScanning, SeverityLow, "192.0.2.1"))
+	server.fail(1)
+	if err := channel.SendDigest(); err == nil {
+		t.Fatal("digest was sent although the server rejected it")
+	}
+	channel.Send(emailIncident(PortScanning, SeverityMedium, "192.0.2.1"))
+	channel.Send(emailIncident(DDoSAttack, SeverityLow, "192.0.2.3"))
+	if err := channel.SendDigest(); err != nil {
+		t.Fatal(err)
+	}
+
+	messages := server.messages()
+	if len(messages) != 1 {
+		t.Fatalf("server accepted %d emails, want one digest", len(messages))
+	}
+	if got, want := digestLines(messages[0].text), []string{
+		"- Medium Port Scanning from 192.0.2.1: 2 times",
+		"- Low DDoS Attack from 192.0.2.3: 1 times",
+	}; !slices.Equal(got, want) {
+		t.Errorf("digest lists\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// newTestEmailChannel creates a channel sending through the server without encryption, with a digest interval
+// long enough for the digests to be sent by the test only.
+func newTestEmailChannel(t *testing.T, server *smtpServer) *EmailChannel {
+	t.Helper()
+	host, port, _ := net.SplitHostPort(server.address)
+	config := DefaultEmailConfig(host, "NIDS <nids@example.com>", "soc@example.com", "NOC <noc@example.com>")
+	config.Port, _ = strconv.Atoi(port)
+	config.Security, config.DigestInterval, config.Timeout = NoTLS, time.Hour, 5*time.Second
+	channel, err := NewEmailChannel(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { channel.Close() })
+	return channel
+}
+
+// emailIncident returns an incident of the type and severity from the source IP.
+func emailIncident(incidentType IncidentType, severity Severity, srcIP string) *Incident {
+	incident := NewIncident(net.ParseIP(srcIP), incidentType, time.Now(), nil)
+	incident.Severity = severity
+	return incident
+}
+
+// digestLines returns the groups listed in a plaintext digest, without their times.
+func digestLines(text string) []string {
+	lines := []string{}
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(line, "- ") {
+			line, _, _ = strings.Cut(line, ",")
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// emailMessage is an email accepted by an smtpServer.
+type emailMessage struct {
+	from    string
+	to      []string
+	subject string
+	text    string // Plaintext body
+	html    string // HTML body
+}
+
+// smtpServer is a minimal SMTP server accepting emails without encryption or authentication.
+type smtpServer struct {
+	address  string
+	t        *testing.T
+	mu       sync.Mutex
+	failures int // Emails still to be rejected
+	accepted []emailMessage
+}
+
+// newSMTPServer starts a server, which is stopped when the test ends.
+func newSMTPServer(t *testing.T) *smtpServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	server := &smtpServer{address: listener.Addr().String(), t: t}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+// fail makes the server reject the next emails.
+func (server *smtpServer) fail(emails int) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	server.failures = emails
+}
+
+// messages returns the emails accepted so far.
+func (server *smtpServer) messages() []emailMessage {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	return slices.Clone(server.accepted)
+}
+
+// serve handles the SMTP session of a client.
+func (server *smtpServer) serve(conn net.Conn) {
+	text := textproto.NewConn(conn)
+	defer text.Close()
+	text.PrintfLine("220 localhost ESMTP")
+	var from string
+	var to []string
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, argument, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			text.PrintfLine("250 localhost")
+		case "MAIL":
+			from = strings.Trim(strings.TrimPrefix(argument, "FROM:"), "<>")
+			text.PrintfLine("250 OK")
+		case "RCPT":
+			to = append(to, strings.Trim(strings.TrimPrefix(argument, "TO:"), "<>"))
+			text.PrintfLine("250 OK")
+		case "DATA":
+			text.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			text.PrintfLine(server.accept(from, to, string(data)))
+			from, to = "", nil
+		case "QUIT":
+			text.PrintfLine("221 Bye")
+			return
+		default:
+			text.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+// accept parses an email and keeps it, unless the server is to reject it. It returns the reply to the client.
+func (server *smtpServer) accept(from string, to []string, data string) string {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.failures > 0 {
+		server.failures--
+		return "451 Try again later"
+	}
+
+	message, err := mail.ReadMessage(strings.NewReader(data))
+	if err != nil {
+		server.t.Errorf("malformed email: %v", err)
+		return "554 Malformed email"
+	}
+	parsed := emailMessage{from: from, to: to}
+	parsed.subject, err = new(mime.WordDecoder).DecodeHeader(message.Header.Get("Subject"))
+	if err != nil {
+		server.t.Errorf("malformed subject: %v", err)
+	}
+	mediaType, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		server.t.Errorf("email has content type %q, want multipart/alternative", message.Header.Get("Content-Type"))
+		return "554 Malformed email"
+	}
+
+	parts := multipart.NewReader(message.Body, params["boundary"])
+	contentTypes := []string{}
+	for {
+		part, err := parts.NextPart() // decodes the quoted-printable bodies
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			server.t.Errorf("malformed part: %v", err)
+			return "554 Malformed email"
+		}
+		body, err := io.ReadAll(part)
+		if err != nil {
+			server.t.Errorf("malformed part: %v", err)
+			return "554 Malformed email"
+		}
+		contentType := part.Header.Get("Content-Type")
+		contentTypes = append(contentTypes, contentType)
+		switch contentType {
+		case "text/plain; charset=utf-8":
+			parsed.text = string(body)
+		case "text/html; charset=utf-8":
+			parsed.html = string(body)
+		}
+	}
+	if !slices.Equal(contentTypes, []string{"text/plain; charset=utf-8", "text/html; charset=utf-8"}) {
+		server.t.Errorf("email has parts %q, want the plaintext then the HTML body", contentTypes)
+	}
+	server.accepted = append(server.accepted, parsed)
+	return "250 OK"
+}
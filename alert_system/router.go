@@ -0,0 +1,423 @@
+package alert_system
+
+import (
+	. "awesomeProject/model"
+	"awesomeProject/outputs"
+	"awesomeProject/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RouteMatch selects the incidents of a route. Empty criteria match every incident.
+type RouteMatch struct {
+	Types       []IncidentType // Incident types matched
+	MinSeverity Severity       // Incidents of a lower severity aren't matched
+	Subnets     []netip.Prefix // Incidents whose source or destination address is in one of the subnets
+	Rules       []string       // Names of the rules whose incidents are matched
+}
+
+// Matches reports whether the incident meets every criterion.
+func (match RouteMatch) Matches(incident *Incident) bool {
+	if incident.Severity < match.MinSeverity {
+		return false
+	}
+	if len(match.Types) > 0 && !slices.Contains(match.Types, incident.Type) {
+		return false
+	}
+	if len(match.Rules) > 0 && !slices.Contains(match.Rules, incident.Rule) {
+		return false
+	}
+	if len(match.Subnets) == 0 {
+		return true
+	}
+	for _, ip := range []net.IP{incident.IP, incident.DstIP} {
+		address, ok := netip.AddrFromSlice(ip)
+		if !ok {
+			continue
+		}
+		for _, subnet := range match.Subnets {
+			if subnet.Contains(address.Unmap()) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// QuietHours is a daily period in which a route suppresses its alerts, e.g. from 22:00 to 07:00. Incidents
+// matched during the period aren't sent later.
+// A period ending before it starts continues into the next day.
+type QuietHours struct {
+	Start    time.Duration  // Offset from midnight, e.g. 22 * time.Hour
+	End      time.Duration  // Offset from midnight
+	Weekdays []time.Weekday // Days the period starts on, every day if empty
+	Location *time.Location // Time zone of the offsets, the local time zone if nil
+}
+
+// Contains reports whether the time lies within the quiet hours.
+func (quiet QuietHours) Contains(t time.Time) bool {
+	location := quiet.Location
+	if location == nil {
+		location = time.Local
+	}
+	t = t.In(location)
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, location)
+	offset := t.Sub(midnight)
+
+	if quiet.Start <= quiet.End {
+		return offset >= quiet.Start && offset < quiet.End && quiet.startsOn(t.Weekday())
+	}
+	// the period wraps around midnight, it started today or yesterday
+	if offset >= quiet.Start {
+		return quiet.startsOn(t.Weekday())
+	}
+	return offset < quiet.End && quiet.startsOn((t.Weekday()+6)%7)
+}
+
+// startsOn reports whether the period starts on the weekday.
+func (quiet QuietHours) startsOn(weekday time.Weekday) bool {
+	return len(quiet.Weekdays) == 0 || slices.Contains(quiet.Weekdays, weekday)
+}
+
+// Escalation sends an alert to further channels when incidents of a type keep matching a route for a while
+// without being acknowledged.
+type Escalation struct {
+	After    time.Duration // How long the incidents must keep firing
+	Channels []string      // Channels the escalation is sent to
+}
+
+// Route sends the incidents it matches to its channels. Incidents beyond the rate limit or during quiet hours
+// are suppressed, they are counted but never sent.
+type Route struct {
+	Name       string
+	Match      RouteMatch
+	Channels   []string      // Names of the channels the incidents are sent to
+	RateLimit  int           // Alerts sent per RateWindow at most, unlimited if 0
+	RateWindow time.Duration // Defaults to a minute
+	QuietHours []QuietHours  // Periods in which no alerts are sent to the channels
+	Escalation *Escalation   // Escalation of unacknowledged incidents, none if nil
+	Continue   bool          // Incidents matched are offered to the following routes as well
+}
+
+// RouteStats counts what happened to the incidents matched by a route.
+type RouteStats struct {
+	Name      string
+	Matched   uint64 // Incidents the route matched
+	Sent      uint64 // Incidents sent to the channels of the route
+	Throttled uint64 // Incidents suppressed by the rate limit
+	Quiet     uint64 // Incidents suppressed during quiet hours
+	Escalated uint64 // Escalations sent
+}
+
+// Episode is a period in which incidents of a type keep matching an escalating route. It ends once no
+// incident of the type matched the route for the escalation duration.
+type Episode struct {
+	Route        string       `json:"route"`
+	Type         IncidentType `json:"type"`
+	FirstSeen    time.Time    `json:"first_seen"`
+	LastSeen     time.Time    `json:"last_seen"`
+	Count        int          `json:"count"` // Incidents matched in the episode
+	Acknowledged bool         `json:"acknowledged"`
+	Escalated    bool         `json:"escalated"`
+}
+
+// Router is an output sink routing incidents to named channels. Each incident is offered to the routes in
+// order and sent by the first route matching it, unless that route lets it continue to the following routes.
+// Incidents no route matches aren't sent anywhere.
+// Acknowledging an episode prevents its escalation; the Router serves acknowledgements over HTTP, see ServeHTTP.
+type Router struct {
+	routes   []*route
+	channels map[string]outputs.Sink
+	clock    utils.Clock
+	mu       sync.Mutex // Guards the rate limits and episodes
+	server   *http.Server
+}
+
+// route is a Route with its rate limit state, episodes and counters.
+type route struct {
+	Route
+	tokens    float64   // Alerts that can still be sent, refilled over the rate window
+	refilled  time.Time // Time the tokens were last refilled
+	episodes  map[IncidentType]*Episode
+	matched   atomic.Uint64
+	sent      atomic.Uint64
+	throttled atomic.Uint64
+	quiet     atomic.Uint64
+	escalated atomic.Uint64
+}
+
+// NewRouter creates a Router sending to the named channels, e.g. FanOuts queueing for alert channels.
+// The clock sets the time of the rate limits, quiet hours and episodes.
+func NewRouter(routes []Route, channels map[string]outputs.Sink, clock utils.Clock) (*Router, error) {
+	router := &Router{channels: channels, clock: clock}
+	names := map[string]bool{}
+	for i, config := range routes {
+		if config.Name == "" {
+			config.Name = fmt.Sprintf("route%d", i)
+		}
+		if names[config.Name] {
+			return nil, fmt.Errorf("duplicate route name %q", config.Name)
+		}
+		names[config.Name] = true
+
+		referenced := slices.Clone(config.Channels)
+		if config.Escalation != nil {
+			if config.Escalation.After <= 0 {
+				return nil, fmt.Errorf("route %s: escalation duration must be positive", config.Name)
+			}
+			referenced = append(referenced, config.Escalation.Channels...)
+		}
+		for _, channel := range referenced {
+			if _, ok := channels[channel]; !ok {
+				return nil, fmt.Errorf("route %s: unknown channel %q", config.Name, channel)
+			}
+		}
+		if config.RateLimit < 0 || config.RateWindow < 0 {
+			return nil, fmt.Errorf("route %s: rate limit must not be negative", config.Name)
+		}
+		if config.RateWindow == 0 {
+			config.RateWindow = time.Minute
+		}
+		router.routes = append(router.routes, &route{
+			Route:    config,
+			tokens:   float64(config.RateLimit),
+			episodes: make(map[IncidentType]*Episode),
+		})
+	}
+	return router, nil
+}
+
+// Write routes the incident and returns the errors of the channels it was sent to.
+func (router *Router) Write(incident *Incident) error {
+	var errs []error
+	for _, route := range router.routes {
+		if !route.Match.Matches(incident) {
+			continue
+		}
+		route.matched.Add(1)
+
+		channels, escalate := router.decide(route, incident)
+		for _, channel := range channels {
+			if err := router.channels[channel].Write(incident); err != nil {
+				errs = append(errs, fmt.Errorf("error routing to %s: %w", channel, err))
+			}
+		}
+		if escalate {
+			for _, channel := range route.Escalation.Channels {
+				if err := router.channels[channel].Write(incident); err != nil {
+					errs = append(errs, fmt.Errorf("error escalating to %s: %w", channel, err))
+				}
+			}
+		}
+
+		if !route.Continue {
+			break
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// decide returns the channels of the route the incident is sent to, none if quiet hours or the rate limit
+// suppress it, and whether it escalates its episode.
+func (router *Router) decide(route *route, incident *Incident) ([]string, bool) {
+	router.mu.Lock()
+	defer router.mu.Unlock()
+	now := router.clock.Now()
+
+	escalate := false
+	if route.Escalation != nil {
+		escalate = route.track(incident, now)
+		if escalate {
+			route.escalated.Add(1)
+		}
+	}
+
+	for _, quiet := range route.QuietHours {
+		if quiet.Contains(now) {
+			route.quiet.Add(1)
+			return nil, escalate
+		}
+	}
+	if route.RateLimit > 0 {
+		route.refill(now)
+		if route.tokens < 1 {
+			route.throttled.Add(1)
+			return nil, escalate
+		}
+		route.tokens--
+	}
+	route.sent.Add(1)
+	return route.Channels, escalate
+}
+
+// refill adds the tokens earned since the last refill, up to the rate limit.
+func (route *route) refill(now time.Time) {
+	if !route.refilled.IsZero() && now.After(route.refilled) {
+		earned := float64(route.RateLimit) * float64(now.Sub(route.refilled)) / float64(route.RateWindow)
+		route.tokens = min(route.tokens+earned, float64(route.RateLimit))
+	}
+	if now.After(route.refilled) {
+		route.refilled = now
+	}
+}
+
+// track adds the incident to the episode of its type and reports whether the episode escalates with it.
+func (route *route) track(incident *Incident, now time.Time) bool {
+	episode := route.episodes[incident.Type]
+	if episode == nil || now.Sub(episode.LastSeen) >= route.Escalation.After {
+		episode = &Episode{Route: route.Name, Type: incident.Type, FirstSeen: now}
+		route.episodes[incident.Type] = episode
+	}
+	episode.LastSeen = now
+	episode.Count++
+
+	if episode.Acknowledged || episode.Escalated || now.Sub(episode.FirstSeen) < route.Escalation.After {
+		return false
+	}
+	episode.Escalated = true
+	return true
+}
+
+// Acknowledge acknowledges the ongoing episode of the incident type on the route, so it doesn't escalate.
+// It reports whether there was such an episode.
+func (router *Router) Acknowledge(routeName string, incidentType IncidentType) bool {
+	router.mu.Lock()
+	defer router.mu.Unlock()
+
+	now := router.clock.Now()
+	for _, route := range router.routes {
+		if route.Name != routeName || route.Escalation == nil {
+			continue
+		}
+		episode := route.episodes[incidentType]
+		if episode == nil || now.Sub(episode.LastSeen) >= route.Escalation.After {
+			return false
+		}
+		episode.Acknowledged = true
+		return true
+	}
+	return false
+}
+
+// Episodes returns the ongoing episodes of the escalating routes, ordered by route and incident type.
+func (router *Router) Episodes() []Episode {
+	router.mu.Lock()
+	defer router.mu.Unlock()
+
+	now := router.clock.Now()
+	episodes := []Episode{}
+	for _, route := range router.routes {
+		for incidentType, episode := range route.episodes {
+			if now.Sub(episode.LastSeen) >= route.Escalation.After {
+				delete(route.episodes, incidentType) // ended
+				continue
+			}
+			episodes = append(episodes, *episode)
+		}
+	}
+	sort.Slice(episodes, func(i, j int) bool {
+		if episodes[i].Route != episodes[j].Route {
+			return episodes[i].Route < episodes[j].Route
+		}
+		return episodes[i].Type < episodes[j].Type
+	})
+	return episodes
+}
+
+// Stats returns the statistics of every route, in the order of the routes.
+func (router *Router) Stats() []RouteStats {
+	stats := make([]RouteStats, len(router.routes))
+	for i, route := range router.routes {
+		stats[i] = RouteStats{
+			Name:      route.Name,
+			Matched:   route.matched.Load(),
+			Sent:      route.sent.Load(),
+			Throttled: route.throttled.Load(),
+			Quiet:     route.quiet.Load(),
+			Escalated: route.escalated.Load(),
+		}
+	}
+	return stats
+}
+
+// ServeHTTP serves the episodes and their acknowledgement:
+//
+//	GET  /episodes                                  lists the ongoing episodes as JSON
+//	POST /acknowledge?route=<name>&type=<type name>  acknowledges an episode, 404 if there is none
+func (router *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/episodes" && r.Method == http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(router.Episodes())
+	case r.URL.Path == "/acknowledge" && r.Method == http.MethodPost:
+		incidentType, err := ParseIncidentType(r.FormValue("type"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !router.Acknowledge(r.FormValue("route"), incidentType) {
+			http.Error(w, "no ongoing episode", http.StatusNotFound)
+			return
+		}
+		fmt.Fprintln(w, "acknowledged")
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Listen serves the acknowledgements on the address until the router is closed.
+func (router *Router) Listen(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	router.server = &http.Server{Handler: router, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := router.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Printf("Error serving alert acknowledgements: %v\n", err)
+		}
+	}()
+	return nil
+}
+
+// Flush flushes the channels buffering alerts.
+func (router *Router) Flush() error {
+	var errs []error
+	for name, channel := range router.channels {
+		if flusher, ok := channel.(outputs.Flusher); ok {
+			if err := flusher.Flush(); err != nil {
+				errs = append(errs, fmt.Errorf("error flushing %s: %w", name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close stops serving acknowledgements and closes the channels.
+func (router *Router) Close() error {
+	var errs []error
+	if router.server != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		errs = append(errs, router.server.Shutdown(ctx))
+	}
+	for name, channel := range router.channels {
+		if closer, ok := channel.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("error closing %s: %w", name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,225 @@
+package alert_system
+
+import (
+	. "awesomeProject/model"
+	"awesomeProject/outputs"
+	"awesomeProject/utils"
+	"net"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// friday is 2024-03-01 at midnight UTC, a Friday.
+var friday = time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+func TestQuietHoursContains(t *testing.T) {
+	overnight := QuietHours{Start: 22 * time.Hour, End: 7 * time.Hour, Location: time.UTC}
+	fridayNight := QuietHours{Start: 22 * time.Hour, End: 7 * time.Hour, Weekdays: []time.Weekday{time.Friday}, Location: time.UTC}
+	lunch := QuietHours{Start: 12 * time.Hour, End: 13 * time.Hour, Location: time.UTC}
+	cetNight := QuietHours{Start: 22 * time.Hour, End: 7 * time.Hour, Location: time.FixedZone("CET", 3600)}
+
+	tests := []struct {
+		quiet    QuietHours
+		offset   time.Duration // From Friday midnight UTC
+		contains bool
+	}{
+		{overnight, 21*time.Hour + 59*time.Minute, false},
+		{overnight, 22 * time.Hour, true},
+		{overnight, 23*time.Hour + 59*time.Minute, true},
+		{overnight, 24 * time.Hour, true},
+		{overnight, 30*time.Hour + 59*time.Minute, true},
+		{overnight, 31 * time.Hour, false},
+		{overnight, 3 * time.Hour, true}, // started on Thursday
+		{fridayNight, 3 * time.Hour, false},
+		{fridayNight, 23 * time.Hour, true},
+		{fridayNight, 27 * time.Hour, true}, // Saturday morning
+		{fridayNight, 47 * time.Hour, false},
+		{lunch, 12 * time.Hour, true},
+		{lunch, 13 * time.Hour, false},
+		{lunch, 36 * time.Hour, true},
+		{cetNight, 21 * time.Hour, true}, // 22:00 CET
+		{cetNight, 20*time.Hour + 59*time.Minute, false},
+		{cetNight, 5*time.Hour + 59*time.Minute, true},
+		{cetNight, 6 * time.Hour, false},
+	}
+
+	for _, test := range tests {
+		now := friday.Add(test.offset)
+		if got := test.quiet.Contains(now); got != test.contains {
+			t.Errorf("%s to %s on %v in %s: contains %s %t, want %t", test.quiet.Start, test.quiet.End, test.quiet.Weekdays,
+				test.quiet.Location, now.Format("Mon 15:04"), got, test.contains)
+		}
+	}
+}
+
+func TestRouterRateLimit(t *testing.T) {
+	clock := newRouterClock()
+	pager := &alertRecorder{}
+	router := newTestRouter(t, clock, map[string]*alertRecorder{"pager": pager},
+		Route{Name: "limited", Channels: []string{"pager"}, RateLimit: 2, RateWindow: time.Minute})
+
+	steps := []struct {
+		after     time.Duration // Since the previous step
+		incidents int
+		sent      int
+	}{
+		{0, 3, 2},                // the burst is limited
+		{30 * time.Second, 2, 1}, // half the window earns one alert
+		{10 * time.Minute, 4, 2}, // the tokens are refilled up to the limit only
+		{29 * time.Second, 1, 0}, // not quite an alert earned
+		{2 * time.Second, 1, 1},  // now it is
+	}
+
+	sent, throttled := 0, 0
+	for i, step := range steps {
+		clock.Advance(clock.Now().Add(step.after))
+		before := len(pager.received())
+		for j := 0; j < step.incidents; j++ {
+			if err := router.Write(routerIncident(PortScanning, SeverityHigh)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got := len(pager.received()) - before; got != step.sent {
+			t.Errorf("step %d: %d of %d alerts sent, want %d", i, got, step.incidents, step.sent)
+		}
+		sent += step.sent
+		throttled += step.incidents - step.sent
+	}
+
+	stats := router.Stats()[0]
+	if stats.Sent != uint64(sent) || stats.Throttled != uint64(throttled) || stats.Matched != uint64(sent+throttled) {
+		t.Errorf("got stats %+v, want %d sent and %d throttled", stats, sent, throttled)
+	}
+}
+
+func TestRouterSuppressesDuringQuietHours(t *testing.T) {
+	clock := newRouterClock()
+	clock.Advance(friday.Add(21 * time.Hour))
+	pager, email := &alertRecorder{}, &alertRecorder{}
+	router := newTestRouter(t, clock, map[string]*alertRecorder{"pager": pager, "email": email},
+		Route{
+			Name:       "night",
+			Match:      RouteMatch{Types: []IncidentType{DDoSAttack}},
+			Channels:   []string{"pager"},
+			QuietHours: []QuietHours{{Start: 22 * time.Hour, End: 7 * time.Hour, Location: time.UTC}},
+		},
+		Route{Name: "rest", Channels: []string{"email"}})
+
+	for _, hour := range []time.Duration{21, 23, 26, 30, 31} {
+		clock.Advance(friday.Add(hour * time.Hour))
+		router.Write(routerIncident(DDoSAttack, SeverityCritical))
+	}
+	router.Write(routerIncident(PortScanning, SeverityLow))
+
+	if got := len(pager.received()); got != 2 {
+		t.Errorf("%d alerts sent to the pager, want the 2 outside the quiet hours", got)
+	}
+	if got := email.received(); len(got) != 1 || got[0] != PortScanning {
+		t.Errorf("the following route received %v, want the port scan only", got)
+	}
+	if stats := router.Stats()[0]; stats.Quiet != 3 || stats.Sent != 2 || stats.Matched != 5 {
+		t.Errorf("got stats %+v", stats)
+	}
+}
+
+func TestRouterEscalates(t *testing.T) {
+	clock := newRouterClock()
+	pager, oncall := &alertRecorder{}, &alertRecorder{}
+	router := newTestRouter(t, clock, map[string]*alertRecorder{"pager": pager, "oncall": oncall},
+		Route{
+			Name:       "dmz",
+			Channels:   []string{"pager"},
+			QuietHours: []QuietHours{{Start: 0, End: 24 * time.Hour, Location: time.UTC}}, // alerts are suppressed all day
+			Escalation: &Escalation{After: 10 * time.Minute, Channels: []string{"oncall"}},
+		})
+
+	// a DDoS attack fires every 5 minutes for 20 minutes, and again after a break ending its episode
+	escalations := []int{}
+	for i, minute := range []time.Duration{0, 5, 10, 15, 20, 35, 40, 45} {
+		clock.Advance(friday.Add(minute * time.Minute))
+		router.Write(routerIncident(DDoSAttack, SeverityCritical))
+		if len(oncall.received()) > len(escalations) {
+			escalations = append(escalations, i)
+		}
+	}
+	if !slices.Equal(escalations, []int{2, 7}) {
+		t.Errorf("escalated with incidents %v, want once per episode after 10 minutes", escalations)
+	}
+	if len(pager.received()) != 0 {
+		t.Errorf("alerts sent during quiet hours")
+	}
+
+	// a port scan is acknowledged before it escalates
+	for _, minute := range []time.Duration{50, 55, 60} {
+		clock.Advance(friday.Add(minute * time.Minute))
+		router.Write(routerIncident(PortScanning, SeverityHigh))
+		if minute == 50 && !router.Acknowledge("dmz", PortScanning) {
+			t.Fatal("no episode to acknowledge")
+		}
+	}
+	if got := oncall.received(); len(got) != 2 {
+		t.Errorf("escalated %v, the acknowledged port scan included", got)
+	}
+
+	episodes := router.Episodes()
+	if len(episodes) != 1 || episodes[0].Type != PortScanning || !episodes[0].Acknowledged || episodes[0].Count != 3 {
+		t.Errorf("got episodes %+v, want the acknowledged port scan only", episodes)
+	}
+	if router.Acknowledge("dmz", DDoSAttack) {
+		t.Errorf("acknowledged the ended DDoS episode")
+	}
+	if stats := router.Stats()[0]; stats.Escalated != 2 || stats.Quiet != 11 {
+		t.Errorf("got stats %+v", stats)
+	}
+}
+
+// newRouterClock returns an event clock set to Friday midnight.
+func newRouterClock() *utils.EventClock {
+	clock := utils.NewEventClock()
+	clock.Advance(friday)
+	return clock
+}
+
+// newTestRouter creates a router of the routes sending to the recorders.
+func newTestRouter(t *testing.T, clock utils.Clock, recorders map[string]*alertRecorder, routes ...Route) *Router {
+	t.Helper()
+	channels := map[string]outputs.Sink{}
+	for name, recorder := range recorders {
+		channels[name] = recorder
+	}
+	router, err := NewRouter(routes, channels, clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return router
+}
+
+// routerIncident returns an incident of the type and severity from 192.0.2.1.
+func routerIncident(incidentType IncidentType, severity Severity) *Incident {
+	incident := NewIncident(net.IPv4(192, 0, 2, 1), incidentType, time.Now(), nil)
+	incident.Severity = severity
+	return incident
+}
+
+// alertRecorder is a channel recording the types of the incidents it is sent.
+type alertRecorder struct {
+	mu    sync.Mutex
+	types []IncidentType
+}
+
+// Write implementation according to outputs.Sink
+func (recorder *alertRecorder) Write(incident *Incident) error {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	recorder.types = append(recorder.types, incident.Type)
+	return nil
+}
+
+// received returns the types of the incidents sent so far.
+func (recorder *alertRecorder) received() []IncidentType {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	return slices.Clone(recorder.types)
+}
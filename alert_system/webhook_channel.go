@@ -0,0 +1,402 @@
+package alert_system
+
+import (
+	. "awesomeProject/model"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+const (
+	DefaultWebhookTimeout    = 10 * time.Second
+	DefaultWebhookMaxRetries = 5
+	DefaultWebhookMinBackoff = time.Second
+	DefaultWebhookMaxBackoff = 5 * time.Minute
+	DefaultWebhookMaxQueued  = 10000
+
+	// queuedAlertSuffix names the files of the alerts queued on disk, failedAlertSuffix those the receiver rejected.
+	queuedAlertSuffix = ".alert"
+	failedAlertSuffix = ".failed"
+)
+
+// ErrWebhookQueueFull is returned for the alerts that don't fit into the disk queue anymore.
+var ErrWebhookQueueFull = errors.New("webhook queue is full")
+
+// WebhookConfig sets the endpoint a WebhookChannel posts alerts to, how they are rendered and how failed
+// deliveries are retried.
+type WebhookConfig struct {
+	URL         string
+	Method      string            // Defaults to POST
+	Headers     map[string]string // Sent with every request, e.g. API keys
+	Username    string            // Sent with Password as basic authentication if set
+	Password    string
+	BearerToken string             // Sent as bearer token authentication if set
+	Template    *template.Template // Renders the body from the incident, see ParseWebhookTemplate. The incident as JSON if nil.
+	ContentType string             // Defaults to application/json
+	Timeout     time.Duration      // Limit for a single request
+	MaxRetries  int                // Retries of a failed request before the alert is given up, unless queued on disk
+	MinBackoff  time.Duration      // Wait before the first retry, doubled for every further retry
+	MaxBackoff  time.Duration      // Longest wait between retries
+	QueueDir    string             // Alerts are stored in this directory until delivered, so they survive an outage and restarts
+	MaxQueued   int                // Alerts stored in the queue directory at most
+}
+
+// DefaultWebhookConfig returns the configuration of a webhook posting incidents as JSON to the URL.
+func DefaultWebhookConfig(url string) WebhookConfig {
+	return WebhookConfig{
+		URL:         url,
+		Method:      http.MethodPost,
+		ContentType: "application/json",
+		Timeout:     DefaultWebhookTimeout,
+		MaxRetries:  DefaultWebhookMaxRetries,
+		MinBackoff:  DefaultWebhookMinBackoff,
+		MaxBackoff:  DefaultWebhookMaxBackoff,
+		MaxQueued:   DefaultWebhookMaxQueued,
+	}
+}
+
+// Validate checks that the configuration describes a usable webhook.
+func (config WebhookConfig) Validate() error {
+	if !strings.HasPrefix(config.URL, "http://") && !strings.HasPrefix(config.URL, "https://") {
+		return fmt.Errorf("webhook URL must start with http:// or https://, got %q", config.URL)
+	}
+	if config.Username != "" && config.BearerToken != "" {
+		return errors.New("webhook basic and bearer authentication cannot be combined")
+	}
+	if config.Timeout <= 0 || config.MinBackoff <= 0 || config.MaxBackoff < config.MinBackoff {
+		return errors.New("webhook timeout and backoffs must be positive, with the max backoff not below the min backoff")
+	}
+	if config.MaxRetries < 0 {
+		return errors.New("webhook retries must not be negative")
+	}
+	if config.QueueDir != "" && config.MaxQueued <= 0 {
+		return errors.New("webhook queue size must be positive")
+	}
+	return nil
+}
+
+// webhookFuncs are the functions available to webhook templates besides the built-in ones.
+var webhookFuncs = template.FuncMap{
+	// json encodes a value as JSON, e.g. to quote strings inside a JSON body: {"text": {{json (alert .)}}}
+	"json": func(value any) (string, error) {
+		encoded, err := json.Marshal(value)
+		return string(encoded), err
+	},
+	"alert": FormatAlert, // the one-line alert message of the incident
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+}
+
+// ParseWebhookTemplate parses a text/template rendering a webhook body from an *Incident. Besides the
+// built-in functions, templates can use json (encodes a value as JSON), alert (the one-line alert message
+// of an incident), lower and upper. E.g. a Slack incoming webhook body:
+//
+//	{"text": {{json (alert .)}}}
+func ParseWebhookTemplate(text string) (*template.Template, error) {
+	return template.New("webhook").Funcs(webhookFuncs).Option("missingkey=error").Parse(text)
+}
+
+// WebhookChannel posts alerts to an HTTP endpoint, e.g. of Slack, Teams or PagerDuty.
+// Requests failing with a network error, a 408, 429 or 5xx status are retried with exponential backoff.
+// Without a queue directory, Send retries up to MaxRetries times before it gives up. With a queue directory,
+// Send stores the alert on disk and returns, and a background goroutine delivers the stored alerts in order,
+// retrying until the receiver takes them. Alerts the receiver rejects are kept with the ".failed" suffix.
+type WebhookChannel struct {
+	config  WebhookConfig
+	client  *http.Client
+	stop    chan struct{} // Closed by Close, interrupts backoffs
+	stopped chan struct{} // Closed once the delivery of the disk queue stopped, nil without disk queue
+	wake    chan struct{} // Signals the delivery of the disk queue that an alert was stored
+	mu      sync.Mutex    // Guards queued and last
+	queued  int           // Alerts stored in the queue directory
+	last    int64         // Sequence number of the last stored alert
+	closed  sync.Once
+}
+
+// webhookError is a failed delivery, along with whether it should be retried.
+type webhookError struct {
+	err        error
+	retryable  bool
+	retryAfter time.Duration // Wait requested by the receiver, 0 if none
+}
+
+// Error implementation according to error
+func (err *webhookError) Error() string {
+	return err.err.Error()
+}
+
+// NewWebhookChannel creates a WebhookChannel. With a queue directory, the alerts stored by an earlier run
+// are delivered first, and new alerts are numbered after them.
+func NewWebhookChannel(config WebhookConfig) (*WebhookChannel, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	channel := &WebhookChannel{
+		config: config,
+		client: &http.Client{Timeout: config.Timeout},
+		stop:   make(chan struct{}),
+		wake:   make(chan struct{}, 1),
+	}
+
+	if config.QueueDir != "" {
+		if err := os.MkdirAll(config.QueueDir, 0700); err != nil {
+			return nil, fmt.Errorf("error creating webhook queue directory: %w", err)
+		}
+		stored, err := channel.storedAlerts()
+		if err != nil {
+			return nil, fmt.Errorf("error reading webhook queue directory: %w", err)
+		}
+		channel.queued = len(stored)
+		for _, path := range stored {
+			// alerts stored with a clock set back would otherwise sort before the stored ones
+			channel.last = max(channel.last, storedSequence(path))
+		}
+		channel.stopped = make(chan struct{})
+		go channel.run()
+	}
+	return channel, nil
+}
+
+// Send posts the alert about the incident, or stores it in the disk queue to be posted in the background.
+func (channel *WebhookChannel) Send(incident *Incident) error {
+	body, err := channel.render(incident)
+	if err != nil {
+		return fmt.Errorf("error rendering webhook body: %w", err)
+	}
+	if channel.config.QueueDir != "" {
+		return channel.enqueue(body)
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := channel.post(body)
+		if err == nil {
+			return nil
+		}
+		if !err.retryable || attempt >= channel.config.MaxRetries {
+			return err
+		}
+		if !channel.sleep(channel.backoff(attempt, err.retryAfter)) {
+			return fmt.Errorf("channel closed while retrying: %w", err)
+		}
+	}
+}
+
+// Close stops the retries and the delivery of the disk queue. Alerts still stored are delivered on the next start.
+func (channel *WebhookChannel) Close() error {
+	channel.closed.Do(func() {
+		close(channel.stop)
+		if channel.stopped != nil {
+			<-channel.stopped
+		}
+	})
+	return nil
+}
+
+// render returns the body of the alert about the incident.
+func (channel *WebhookChannel) render(incident *Incident) ([]byte, error) {
+	if channel.config.Template == nil {
+		return json.Marshal(incident)
+	}
+	var body bytes.Buffer
+	if err := channel.config.Template.Execute(&body, incident); err != nil {
+		return nil, err
+	}
+	return body.Bytes(), nil
+}
+
+// post sends a single request with the body.
+func (channel *WebhookChannel) post(body []byte) *webhookError {
+	request, err := http.NewRequest(channel.config.Method, channel.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return &webhookError{err: err}
+	}
+	request.Header.Set("Content-Type", channel.config.ContentType)
+	for name, value := range channel.config.Headers {
+		request.Header.Set(name, value)
+	}
+	if channel.config.Username != "" {
+		request.SetBasicAuth(channel.config.Username, channel.config.Password)
+	}
+	if channel.config.BearerToken != "" {
+		request.Header.Set("Authorization", "Bearer "+channel.config.BearerToken)
+	}
+
+	response, err := channel.client.Do(request)
+	if err != nil {
+		return &webhookError{err: err, retryable: true}
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10)) // lets the connection be reused
+
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return nil
+	}
+	failure := &webhookError{err: fmt.Errorf("webhook receiver responded %s", response.Status)}
+	switch {
+	case response.StatusCode == http.StatusRequestTimeout, response.StatusCode == http.StatusTooManyRequests,
+		response.StatusCode >= 500:
+		failure.retryable = true
+		if seconds, err := strconv.Atoi(response.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			failure.retryAfter = time.Duration(seconds) * time.Second
+		}
+	}
+	return failure
+}
+
+// backoff returns the wait before the retry following the given attempt, counted from 0.
+func (channel *WebhookChannel) backoff(attempt int, retryAfter time.Duration) time.Duration {
+	wait := channel.config.MinBackoff
+	for i := 0; i < attempt && wait < channel.config.MaxBackoff; i++ {
+		wait *= 2
+	}
+	wait = max(wait, retryAfter)
+	return min(wait, channel.config.MaxBackoff)
+}
+
+// sleep waits for the duration and reports whether the channel is still open.
+func (channel *WebhookChannel) sleep(duration time.Duration) bool {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-channel.stop:
+		return false
+	}
+}
+
+// enqueue stores the body in the queue directory. The file is written under a temporary name first,
+// so the delivery never reads a partial alert.
+func (channel *WebhookChannel) enqueue(body []byte) error {
+	channel.mu.Lock()
+	if channel.queued >= channel.config.MaxQueued {
+		channel.mu.Unlock()
+		return ErrWebhookQueueFull
+	}
+	// names sort in the order the alerts were stored, even across restarts
+	sequence := max(time.Now().UnixNano(), channel.last+1)
+	channel.last = sequence
+	channel.queued++
+	channel.mu.Unlock()
+
+	path := filepath.Join(channel.config.QueueDir, fmt.Sprintf("%020d%s", sequence, queuedAlertSuffix))
+	err := os.WriteFile(path+".tmp", body, 0600)
+	if err == nil {
+		err = os.Rename(path+".tmp", path)
+	}
+	if err != nil {
+		os.Remove(path + ".tmp")
+		channel.dequeued()
+		return fmt.Errorf("error storing alert: %w", err)
+	}
+
+	select {
+	case channel.wake <- struct{}{}:
+	default: // the delivery was already woken up
+	}
+	return nil
+}
+
+// run delivers the stored alerts in order until the channel is closed. The queue directory is listed once per
+// batch; alerts stored meanwhile sort after the batch and are picked up by the next listing.
+func (channel *WebhookChannel) run() {
+	defer close(channel.stopped)
+	var batch []string // Listed alerts not delivered yet, oldest first
+	for attempt := 0; ; {
+		select {
+		case <-channel.stop:
+			return
+		default:
+		}
+
+		if len(batch) == 0 {
+			stored, err := channel.storedAlerts()
+			if err != nil {
+				fmt.Printf("Error reading webhook queue directory: %v\n", err)
+			}
+			if len(stored) == 0 || err != nil {
+				select {
+				case <-channel.wake:
+					continue
+				case <-channel.stop:
+					return
+				}
+			}
+			batch = stored
+		}
+
+		path := batch[0]
+		failure := channel.deliver(path)
+		if failure == nil {
+			batch, attempt = batch[1:], 0
+			continue
+		}
+		if !failure.retryable {
+			fmt.Printf("Webhook receiver rejected alert %s, keeping it as %s: %v\n", path, path+failedAlertSuffix, failure)
+			os.Rename(path, path+failedAlertSuffix)
+			channel.dequeued()
+			batch, attempt = batch[1:], 0
+			continue
+		}
+		if !channel.sleep(channel.backoff(attempt, failure.retryAfter)) {
+			return
+		}
+		attempt++
+	}
+}
+
+// deliver posts a stored alert and removes it once the receiver took it.
+func (channel *WebhookChannel) deliver(path string) *webhookError {
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return &webhookError{err: err}
+	}
+	if err := channel.post(body); err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		fmt.Printf("Error removing delivered alert %s: %v\n", path, err)
+	}
+	channel.dequeued()
+	return nil
+}
+
+// dequeued counts an alert leaving the disk queue.
+func (channel *WebhookChannel) dequeued() {
+	channel.mu.Lock()
+	channel.queued--
+	channel.mu.Unlock()
+}
+
+// storedAlerts returns the paths of the alerts stored in the queue directory, oldest first.
+func (channel *WebhookChannel) storedAlerts() ([]string, error) {
+	entries, err := os.ReadDir(channel.config.QueueDir)
+	if err != nil {
+		return nil, err
+	}
+	stored := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), queuedAlertSuffix) {
+			stored = append(stored, filepath.Join(channel.config.QueueDir, entry.Name()))
+		}
+	}
+	sort.Strings(stored)
+	return stored, nil
+}
+
+// storedSequence returns the sequence number a stored alert is named after, 0 if its name isn't one.
+func storedSequence(path string) int64 {
+	sequence, _ := strconv.ParseInt(strings.TrimSuffix(filepath.Base(path), queuedAlertSuffix), 10, 64)
+	return sequence
+}
@@ -0,0 +1,198 @@
+package alert_system
+
+import (
+	. "awesomeProject/model"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWebhookChannelRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxRetries int
+		statuses   []int // Responses of the receiver in order, 200 once exhausted
+		requests   int
+		failed     bool
+	}{
+		{"delivered", 2, nil, 1, false},
+		{"delivered after retries", 2, []int{503, 429}, 3, false},
+		{"retries exhausted", 1, []int{503, 502, 500}, 2, true},
+		{"rejected", 5, []int{400}, 1, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			receiver := newWebhookReceiver(t, test.statuses...)
+			config := DefaultWebhookConfig(receiver.url)
+			config.MaxRetries, config.MinBackoff, config.MaxBackoff = test.maxRetries, time.Millisecond, time.Millisecond
+			config.BearerToken = "secret"
+			config.Template, _ = ParseWebhookTemplate(`{"text": {{json .Description}}}`)
+			channel, err := NewWebhookChannel(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer channel.Close()
+
+			err = channel.Send(webhookIncident("port scan"))
+			if (err != nil) != test.failed {
+				t.Errorf("got error %v, want failure %t", err, test.failed)
+			}
+			requests := receiver.requests()
+			if len(requests) != test.requests {
+				t.Fatalf("receiver got %d requests, want %d", len(requests), test.requests)
+			}
+			for _, request := range requests {
+				if request.body != `{"text": "port scan"}` || request.authorization != "Bearer secret" {
+					t.Errorf("receiver got %q with authorization %q", request.body, request.authorization)
+				}
+			}
+		})
+	}
+}
+
+func TestWebhookChannelDeliversQueuedAlertsInOrder(t *testing.T) {
+	dir := t.TempDir()
+	for i, body := range []string{"stored 1", "stored 2"} { // left by an earlier run
+		path := filepath.Join(dir, fmt.Sprintf("%020d%s", i+1, queuedAlertSuffix))
+		if err := os.WriteFile(path, []byte(body), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	receiver := newWebhookReceiver(t, 503) // the first request fails and is retried
+	receiver.reject = "rejected"
+	config := DefaultWebhookConfig(receiver.url)
+	config.QueueDir, config.MinBackoff, config.MaxBackoff = dir, time.Millisecond, time.Millisecond
+	config.Template, _ = ParseWebhookTemplate(`{{.Description}}`)
+	channel, err := NewWebhookChannel(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, description := range []string{"alert 1", "rejected", "alert 2"} {
+		if err := channel.Send(webhookIncident(description)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{"stored 1", "stored 1", "stored 2", "alert 1", "rejected", "alert 2"}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(receiver.requests()) < len(want) && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	channel.Close()
+
+	got := []string{}
+	for _, request := range receiver.requests() {
+		got = append(got, request.body)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("receiver got %q, want %q", got, want)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || !strings.HasSuffix(entries[0].Name(), queuedAlertSuffix+failedAlertSuffix) {
+		t.Errorf("queue directory holds %v, want only the rejected alert", entries)
+	}
+	if channel.queued != 0 {
+		t.Errorf("%d alerts counted as queued after the delivery", channel.queued)
+	}
+}
+
+func TestWebhookChannelQueuesAfterStoredAlerts(t *testing.T) {
+	dir := t.TempDir()
+	later := time.Now().Add(time.Hour).UnixNano() // stored before the clock was set back
+	path := filepath.Join(dir, fmt.Sprintf("%020d%s", later, queuedAlertSuffix))
+	if err := os.WriteFile(path, []byte("stored"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	receiver := newWebhookReceiver(t, 503) // the stored alert waits for its retry until the channel is closed
+	config := DefaultWebhookConfig(receiver.url)
+	config.QueueDir, config.MinBackoff, config.MaxBackoff = dir, time.Hour, time.Hour
+	config.Template, _ = ParseWebhookTemplate(`{{.Description}}`)
+	channel, err := NewWebhookChannel(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := channel.Send(webhookIncident("new")); err != nil {
+		t.Fatal(err)
+	}
+	channel.Close()
+
+	stored, err := channel.storedAlerts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, path := range stored {
+		body, _ := os.ReadFile(path)
+		got = append(got, string(body))
+	}
+	if want := []string{"stored", "new"}; !slices.Equal(got, want) {
+		t.Errorf("queue holds %q in order, want %q", got, want)
+	}
+}
+
+// webhookRequest is a request received by a webhookReceiver.
+type webhookRequest struct {
+	body          string
+	authorization string
+}
+
+// webhookReceiver is an HTTP server recording the requests it receives. It responds with the given statuses in
+// order, then with 200, and with 400 to bodies equal to reject.
+type webhookReceiver struct {
+	url      string
+	reject   string
+	mu       sync.Mutex
+	statuses []int
+	received []webhookRequest
+}
+
+// newWebhookReceiver starts a receiver, which is stopped when the test ends.
+func newWebhookReceiver(t *testing.T, statuses ...int) *webhookReceiver {
+	receiver := &webhookReceiver{statuses: statuses}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		receiver.mu.Lock()
+		defer receiver.mu.Unlock()
+		receiver.received = append(receiver.received, webhookRequest{string(body), r.Header.Get("Authorization")})
+
+		status := http.StatusOK
+		if len(receiver.statuses) > 0 {
+			status, receiver.statuses = receiver.statuses[0], receiver.statuses[1:]
+		} else if string(body) == receiver.reject {
+			status = http.StatusBadRequest
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	receiver.url = server.URL
+	return receiver
+}
+
+// requests returns the requests received so far.
+func (receiver *webhookReceiver) requests() []webhookRequest {
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+	return slices.Clone(receiver.received)
+}
+
+// webhookIncident returns a port scanning incident with the description.
+func webhookIncident(description string) *Incident {
+	incident := NewIncident(net.IPv4(192, 0, 2, 1), PortScanning, time.Now(), nil)
+	incident.Description = description
+	return incident
+}
@@ -1,55 +1,424 @@
 package cmd
 
 import (
-	. "awesomeProject/alert_system"
-	. "awesomeProject/loggers"
+	"awesomeProject/aggregation"
 	. "awesomeProject/model"
+	"awesomeProject/outputs"
+	"awesomeProject/reassembly"
 	. "awesomeProject/rules"
+	"awesomeProject/utils"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // NIDS is the main class responsible for managing the detection system.
 type NIDS struct {
-	PacketSniffer *PacketSniffer
-	Rules         []Rule
-	Logger        *IncidentLogger
-	AlertSystem   *AlertSystem
+	PacketSniffers  []*PacketSniffer                 // Captures merged into a single packet stream
+	rules           atomic.Pointer[[]Rule]           // Swapped as a whole so rules can be replaced while packets are processed
+	Output          outputs.Sink                     // Receives the detected incidents, usually a FanOut to several sinks
+	Clock           utils.Clock                      // Time source shared by every rule
+	PoolConfig      WorkerPoolConfig                 // Sizing of the packet processing workers, can be changed before Start
+	TCPReassembly   *reassembly.TCPReassemblerConfig // Limits of the TCP stream reassembly, nil disables it
+	Defragmentation *reassembly.IPDefragmenterConfig // Limits of the IP defragmentation, nil drops fragments
+	Aggregation     *aggregation.AggregatorConfig    // Merging of repeated incidents, nil reports every incident on its own
+	workerPool      *WorkerPool
+	reassembler     *reassembly.TCPReassembler
+	defragmenter    *reassembly.IPDefragmenter
+	aggregator      *aggregation.Aggregator
+	packets         chan *Packet // Packets captured by the sniffers, waiting to be handed to the workers
+	detectLatency   sync.Map     // Time spent detecting per rule and method, see metrics.go
+	incidentCounts  sync.Map     // Incidents raised per type, see metrics.go
+	metricsServer   *http.Server
+	stopSweeper     func()
+	stopFlusher     func()
+	mu              sync.Mutex         // Guards cancel and done
+	cancel          context.CancelFunc // Cancels the context of the running Start call
+	done            chan struct{}      // Closed once the running Start call has shut down
 }
 
 // NewNIDS creates a new instance of the NIDS system with its dependencies.
-func NewNIDS(sniffer *PacketSniffer, rules []Rule, logger *IncidentLogger, alertSystem *AlertSystem) *NIDS {
-	return &NIDS{
-		PacketSniffer: sniffer,
-		Rules:         rules,
-		Logger:        logger,
-		AlertSystem:   alertSystem,
+// The clock is handed to every rule that evaluates time windows.
+func NewNIDS(sniffers []*PacketSniffer, rules []Rule, output outputs.Sink, clock utils.Clock) *NIDS {
+	nids := &NIDS{
+		PacketSniffers: sniffers,
+		Output:         output,
+		Clock:          clock,
+		PoolConfig:     DefaultWorkerPoolConfig(),
 	}
+	reassemblyConfig := reassembly.DefaultTCPReassemblerConfig()
+	nids.TCPReassembly = &reassemblyConfig
+	defragmentationConfig := reassembly.DefaultIPDefragmenterConfig()
+	nids.Defragmentation = &defragmentationConfig
+	aggregationConfig := aggregation.DefaultAggregatorConfig()
+	nids.Aggregation = &aggregationConfig
+	nids.SetRules(rules)
+	return nids
 }
 
-// Start begins capturing packets and processing them concurrently.
-func (n *NIDS) Start() {
-	packetChan := make(chan *Packet, 100) // limit the number of go routines
+// Rules returns the rules currently applied to packets.
+func (n *NIDS) Rules() []Rule {
+	if rules := n.rules.Load(); rules != nil {
+		return *rules
+	}
+	return nil
+}
+
+// SetRules atomically replaces the rules applied to packets, without pausing the capture.
+// Packets already being processed finish with the previous rules. New rules receive the NIDS clock
+// and rules that are not part of the new set have their background jobs stopped.
+func (n *NIDS) SetRules(rules []Rule) {
+	previous := n.Rules()
+
+	for _, rule := range rules {
+		if clockAware, ok := rule.(ClockAware); ok && !containsRule(previous, rule) {
+			clockAware.SetClock(n.Clock)
+		}
+	}
+
+	n.rules.Store(&rules)
+
+	for _, rule := range previous {
+		if stoppable, ok := rule.(Stoppable); ok && !containsRule(rules, rule) {
+			stoppable.Stop()
+		}
+	}
+}
+
+// containsRule reports whether the very same rule instance is part of the slice.
+func containsRule(rules []Rule, rule Rule) bool {
+	for _, candidate := range rules {
+		if candidate == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// Start begins capturing packets and processing them on a pool of workers sharded by flow.
+// It blocks until the context is cancelled, Stop is called or every sniffer ran out of packets
+// (at the end of capture files), and then shuts the system down: in-flight packets are drained,
+// open TCP streams are flushed to the rules, rule background jobs are stopped, pending merged incidents
+// are reported, the outputs are flushed and the sniffers are closed. A stopped NIDS can be started again.
+func (n *NIDS) Start(ctx context.Context) error {
+	n.mu.Lock()
+	if n.done != nil {
+		n.mu.Unlock()
+		return errors.New("NIDS is already running")
+	}
+
+	var aggregator *aggregation.Aggregator
+	if n.Aggregation != nil {
+		var err error
+		if aggregator, err = aggregation.NewAggregator(*n.Aggregation, n.emitIncident); err != nil {
+			n.mu.Unlock()
+			return err
+		}
+	}
+	n.aggregator = aggregator // read by the workers, which are started below
+
+	var reassembler *reassembly.TCPReassembler
+	if n.TCPReassembly != nil {
+		var err error
+		if reassembler, err = reassembly.NewTCPReassembler(*n.TCPReassembly, streamDispatcher{n}); err != nil {
+			n.mu.Unlock()
+			return err
+		}
+	}
+	n.reassembler = reassembler // read by the workers, which are started below
+
+	var defragmenter *reassembly.IPDefragmenter
+	if n.Defragmentation != nil {
+		var err error
+		if defragmenter, err = reassembly.NewIPDefragmenter(*n.Defragmentation); err != nil {
+			n.mu.Unlock()
+			return err
+		}
+	}
+
+	pool, err := NewWorkerPool(n.PoolConfig, n.ProcessPacket)
+	if err != nil {
+		n.mu.Unlock()
+		return err
+	}
+
+	// restart the rule background jobs a previous shutdown stopped
+	for _, rule := range n.Rules() {
+		if clockAware, ok := rule.(ClockAware); ok {
+			clockAware.SetClock(n.Clock)
+		}
+	}
+	ctx, n.cancel = context.WithCancel(ctx)
+	n.done = make(chan struct{})
+	n.workerPool = pool
+	n.defragmenter = defragmenter
+	n.packets = make(chan *Packet, 100)
+	packetChan := n.packets
+	n.stopSweeper = n.startSweeper(reassembler)
+	n.stopFlusher = n.startFlusher(aggregator)
+	n.mu.Unlock()
 
-	// push packets to the channel
+	// push packets of every sniffer to the channel and close it once all captures stopped
+	var captures sync.WaitGroup
+	for _, sniffer := range n.PacketSniffers {
+		captures.Add(1)
+		go func() {
+			defer captures.Done()
+			sniffer.Capture(ctx, packetChan)
+		}()
+	}
 	go func() {
-		n.PacketSniffer.Capture(packetChan)
+		captures.Wait()
+		close(packetChan)
 	}()
 
-	// for each packet create go routine
+	// reassemble fragmented datagrams and hand each packet to the worker owning its flow
 	for packet := range packetChan {
-		go n.ProcessPacket(packet)
+		if packet.IsFragment() {
+			if packet = n.defragment(defragmenter, packet); packet == nil {
+				continue
+			}
+		}
+		pool.Submit(packet)
+	}
+
+	return n.shutdown()
+}
+
+// Stop cancels a running Start call and waits until the shutdown has completed.
+func (n *NIDS) Stop() {
+	n.mu.Lock()
+	cancel, done := n.cancel, n.done
+	n.mu.Unlock()
+
+	if cancel == nil {
+		return // not running
+	}
+	cancel()
+	<-done
+}
+
+// shutdown drains the worker pool and releases every resource held by the system.
+func (n *NIDS) shutdown() error {
+	// wait for queued packets to be processed
+	n.workerPool.Close()
+	if dropped := n.workerPool.Dropped(); dropped > 0 {
+		fmt.Printf("Dropped %d packets because the worker queues were full\n", dropped)
+	}
+
+	// hand the data still buffered by the reassembly to the rules
+	n.stopSweeper()
+	if n.reassembler != nil {
+		n.reassembler.CloseAll()
+		if rejected := n.reassembler.Rejected(); rejected > 0 {
+			fmt.Printf("Skipped reassembly of %d TCP connections because the connection limit was reached\n", rejected)
+		}
+	}
+
+	// stop the rule background jobs
+	for _, rule := range n.Rules() {
+		if stoppable, ok := rule.(Stoppable); ok {
+			stoppable.Stop()
+		}
+	}
+
+	// report the incidents still being merged
+	n.stopFlusher()
+	if n.aggregator != nil {
+		n.aggregator.FlushAll()
+	}
+
+	var err error
+	if flusher, ok := n.Output.(outputs.Flusher); ok {
+		if err = flusher.Flush(); err != nil {
+			err = fmt.Errorf("error flushing outputs: %w", err)
+		}
+	}
+	for _, sniffer := range n.PacketSniffers {
+		sniffer.Close()
+	}
+
+	n.mu.Lock()
+	n.cancel()
+	close(n.done)
+	n.cancel, n.done = nil, nil
+	n.mu.Unlock()
+	return err
+}
+
+// defragment adds a fragment to its datagram and returns the reassembled datagram once it is complete.
+// Without a defragmenter fragments are dropped, as their transport header can't be inspected.
+func (n *NIDS) defragment(defragmenter *reassembly.IPDefragmenter, fragment *Packet) *Packet {
+	if defragmenter == nil {
+		ReleasePacket(fragment)
+		return nil
+	}
+
+	datagram, incidents := defragmenter.Process(fragment)
+	n.reportIncidents(incidents)
+	if datagram != nil && !decodeUpperLayer(datagram) {
+		ReleasePacket(datagram)
+		return nil
+	}
+	return datagram
+}
+
+// startSweeper periodically closes the timed out connections of the reassembler, following the NIDS clock.
+// It returns a function stopping the sweeps.
+func (n *NIDS) startSweeper(reassembler *reassembly.TCPReassembler) func() {
+	if reassembler == nil {
+		return func() {}
+	}
+
+	return n.runTicker(n.TCPReassembly.SweepInterval(), func() { reassembler.Sweep(n.Clock.Now()) })
+}
+
+// startFlusher periodically reports the merged incidents whose quiet period ended, following the NIDS clock.
+// It returns a function stopping the flushes.
+func (n *NIDS) startFlusher(aggregator *aggregation.Aggregator) func() {
+	if aggregator == nil {
+		return func() {}
+	}
+	return n.runTicker(n.Aggregation.FlushInterval(), func() { aggregator.Flush(n.Clock.Now()) })
+}
+
+// runTicker runs the job on every tick of the NIDS clock until the returned function is called.
+func (n *NIDS) runTicker(interval time.Duration, job func()) func() {
+	ticker := n.Clock.NewTicker(interval)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-ticker.C():
+				job()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+		<-stopped
 	}
 }
 
 // ProcessPacket processes each captured packet.
+// With TCP reassembly enabled, TCP segments are fed to the reassembler and stream rules only see their streams.
+// The packet is returned to the packet pool afterwards, unless an incident references it.
 func (n *NIDS) ProcessPacket(packet *Packet) {
-	for _, rule := range n.Rules {
+	n.Clock.Advance(packet.Timestamp) // drives the clock when running on event time
+
+	reassembled := n.reassembler != nil && packet.Protocol == ProtocolTCP
+	referenced := false
+	for _, rule := range n.Rules() {
+		if _, ok := rule.(StreamRule); ok && reassembled {
+			continue
+		}
+
+		started := time.Now()
 		incidents := rule.Detect(packet)
+		n.observeDetect(rule, "Detect", time.Since(started))
+		referenced = referenced || len(incidents) > 0
+		n.reportRuleIncidents(rule, incidents)
+	}
+
+	if reassembled {
+		n.reassembler.Process(packet)
+	}
+
+	if !referenced {
+		ReleasePacket(packet)
+	}
+}
+
+// reportRuleIncidents reports the incidents raised by the rule, naming the rule and tagging the ATT&CK
+// techniques if the rule didn't do so itself.
+func (n *NIDS) reportRuleIncidents(rule Rule, incidents []*Incident) {
+	for _, incident := range incidents {
+		if incident.Rule == "" {
+			incident.Rule = RuleName(rule)
+			incident.RuleVersion = RuleVersion(rule)
+		}
+		if incident.Techniques == nil {
+			incident.Techniques = TechniquesOf(rule, incident.Type)
+		}
+	}
+	n.reportIncidents(incidents)
+}
+
+// reportIncidents hands the incidents to the aggregator, or reports them right away when aggregation is disabled.
+func (n *NIDS) reportIncidents(incidents []*Incident) {
+	// can be a list without incidents
+	for _, incident := range incidents {
+		n.countIncident(incident.Type)
+		if n.aggregator != nil {
+			n.aggregator.Add(incident)
+		} else {
+			n.emitIncident(incident)
+		}
+	}
+}
+
+// emitIncident hands the incident to the output.
+func (n *NIDS) emitIncident(incident *Incident) {
+	if err := n.Output.Write(incident); err != nil {
+		fmt.Printf("Error reporting incident %s: %v\n", incident.ID, err)
+	}
+}
+
+// Reopen reopens the files written by the output, e.g. the incident log after logrotate renamed it.
+func (n *NIDS) Reopen() error {
+	if reopener, ok := n.Output.(outputs.Reopener); ok {
+		return reopener.Reopen()
+	}
+	return nil
+}
+
+// Close stops serving metrics and releases the output, e.g. closes the incident log, once the NIDS stopped.
+func (n *NIDS) Close() error {
+	var errs []error
+	if n.metricsServer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		errs = append(errs, n.metricsServer.Shutdown(ctx))
+	}
+	if closer, ok := n.Output.(io.Closer); ok {
+		errs = append(errs, closer.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// streamDispatcher hands the reassembled TCP streams to the stream rules.
+type streamDispatcher struct {
+	n *NIDS
+}
+
+// HandleStream implementation according to reassembly.StreamHandler
+func (dispatcher streamDispatcher) HandleStream(stream *StreamData) {
+	for _, rule := range dispatcher.n.Rules() {
+		if streamRule, ok := rule.(StreamRule); ok {
+			started := time.Now()
+			incidents := streamRule.DetectStream(stream)
+			dispatcher.n.observeDetect(rule, "DetectStream", time.Since(started))
+			dispatcher.n.reportRuleIncidents(rule, incidents)
+		}
+	}
+}
 
-		// can return a list without incidents
-		for _, incident := range incidents {
-			n.Logger.LogIncident(incident)
-			n.AlertSystem.Notify(fmt.Sprintf("Incident detected at %s from IP %s with type: %s", packet.Timestamp, incident.IP, incident.Type))
+// StreamClosed implementation according to reassembly.StreamHandler
+func (dispatcher streamDispatcher) StreamClosed(key StreamKey) {
+	for _, rule := range dispatcher.n.Rules() {
+		if streamRule, ok := rule.(StreamRule); ok {
+			streamRule.StreamClosed(key)
 		}
 	}
 }
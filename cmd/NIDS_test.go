@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	. "awesomeProject/model"
+	. "awesomeProject/rules"
+	"awesomeProject/utils"
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNIDSEvaluatesRulesOnPacketTime(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	ddos := NewDDoSRule(3, time.Minute)
+	defer ddos.Stop()
+	sink := &collectingSink{}
+	nids := NewNIDS(nil, []Rule{ddos}, sink, utils.NewEventClock())
+	nids.Aggregation = nil
+
+	// replayed at once, but 30 seconds of capture apart
+	for i := 0; i < 10; i++ {
+		nids.ProcessPacket(replayedPacket(192, start.Add(time.Duration(i)*30*time.Second)))
+	}
+	if len(sink.incidents) != 0 {
+		t.Fatalf("slow traffic raised %d incidents", len(sink.incidents))
+	}
+	for i := 0; i < 4; i++ {
+		nids.ProcessPacket(replayedPacket(192, start.Add(10*time.Minute+time.Duration(i)*time.Second)))
+	}
+	if len(sink.incidents) != 1 {
+		t.Fatalf("4 packets within a second of capture raised %d incidents, want 1", len(sink.incidents))
+	}
+
+	// the cleanup job runs on capture time as well, half an hour after the first packet
+	nids.ProcessPacket(replayedPacket(198, start.Add(40*time.Minute)))
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		ddos.Lock()
+		tracked := len(ddos.RequestLog)
+		ddos.Unlock()
+		if tracked == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d sources tracked, the expired one wasn't cleaned up", tracked)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestNIDSRestartsRuleJobs(t *testing.T) {
+	rule := &jobRule{}
+	nids := NewNIDS(nil, []Rule{rule}, nil, utils.NewEventClock())
+
+	for run := 0; run < 3; run++ {
+		if err := nids.Start(context.Background()); err != nil { // returns right away without sniffers
+			t.Fatal(err)
+		}
+		if running, stopped := rule.state(); running || stopped != run+1 {
+			t.Fatalf("run %d: job running %t after the shutdown, %d running jobs stopped, want %d", run, running, stopped, run+1)
+		}
+	}
+}
+
+// jobRule is a rule recording whether its background job runs.
+type jobRule struct {
+	mu      sync.Mutex
+	running bool
+	stopped int // Running jobs stopped
+}
+
+// Detect implementation according to Rule
+func (rule *jobRule) Detect(packet *Packet) []*Incident {
+	return nil
+}
+
+// SetClock implementation according to ClockAware
+func (rule *jobRule) SetClock(clock utils.Clock) {
+	rule.mu.Lock()
+	defer rule.mu.Unlock()
+	rule.running = true
+}
+
+// Stop implementation according to Stoppable
+func (rule *jobRule) Stop() {
+	rule.mu.Lock()
+	defer rule.mu.Unlock()
+	if rule.running {
+		rule.stopped++
+	}
+	rule.running = false
+}
+
+// state returns whether the job runs and how many running jobs were stopped.
+func (rule *jobRule) state() (bool, int) {
+	rule.mu.Lock()
+	defer rule.mu.Unlock()
+	return rule.running, rule.stopped
+}
+
+// replayedPacket returns a packet captured at the timestamp from a source in the network of the first octet.
+func replayedPacket(network byte, timestamp time.Time) *Packet {
+	return &Packet{SrcIP: net.IPv4(network, 0, 2, 1), DstIP: net.IPv4(203, 0, 113, 1), SrcPort: 40000, DstPort: 80,
+		Protocol: ProtocolUDP, Timestamp: timestamp}
+}
+
+// collectingSink keeps the incidents written to it.
+type collectingSink struct {
+	mu        sync.Mutex
+	incidents []*Incident
+}
+
+// Write implementation according to outputs.Sink
+func (sink *collectingSink) Write(incident *Incident) error {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	sink.incidents = append(sink.incidents, incident)
+	return nil
+}
@@ -0,0 +1,244 @@
+package cmd
+
+import (
+	. "awesomeProject/model"
+	. "awesomeProject/rules"
+	"awesomeProject/utils"
+	"encoding/binary"
+	"fmt"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"maps"
+	"os"
+	"slices"
+	"testing"
+	"time"
+)
+
+// The IPv6 captures in testdata:
+//
+//   - ipv6_extension_headers.pcap: packets from 2001:db8::1 to 2001:db8::2 behind a hop-by-hop header (TCP to
+//     port 80), a routing header (UDP to port 53), a destination options header (UDP to port 514), an
+//     authentication header (TCP to port 443 carrying an HTTP request line) and a chain of all but the last.
+//   - ipv6_rotating_sources.pcap: a SYN scan of ports 1-20 of 2001:db8:ffff::1 and 20 datagrams to port 53 of
+//     2001:db8:ffff::2, one per second, every packet sent from another address of 2001:db8:1:2::/64
+//     respectively 2001:db8:5:6::/64.
+//   - ipv6_link_local.pcap: 10 datagrams from fe80::1 to ff02::1:2, one per second.
+
+func TestDecodeIPv6ExtensionHeaders(t *testing.T) {
+	expected := []struct {
+		protocol   Protocol
+		extensions []Protocol
+		dstPort    uint16
+		payload    string
+	}{
+		{ProtocolTCP, []Protocol{ProtocolIPv6HopByHop}, 80, ""},
+		{ProtocolUDP, []Protocol{ProtocolIPv6Routing}, 53, "x"},
+		{ProtocolUDP, []Protocol{ProtocolIPv6Destination}, 514, "hello"},
+		{ProtocolTCP, []Protocol{ProtocolAH}, 443, "GET / HTTP/1.1\r\n"},
+		{ProtocolTCP, []Protocol{ProtocolIPv6HopByHop, ProtocolIPv6Routing, ProtocolIPv6Destination}, 22, ""},
+	}
+
+	linkType, frames := readCapture(t, "testdata/ipv6_extension_headers.pcap")
+	fast, _ := newPacketDecoder(linkType, "eth0")
+	for name, decode := range map[string]func([]byte, gopacket.CaptureInfo) *Packet{
+		"DecodingLayerParser": fast.decode,
+		"gopacket":            genericDecoder("eth0"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if len(frames) != len(expected) {
+				t.Fatalf("capture holds %d packets, want %d", len(frames), len(expected))
+			}
+			for i, frame := range frames {
+				packet := decode(frame.data, frame.info)
+				if packet == nil {
+					t.Fatalf("packet %d wasn't decoded", i)
+				}
+				want := expected[i]
+				if packet.SrcIP.To4() != nil || packet.Protocol != want.protocol || !slices.Equal(packet.Extensions, want.extensions) ||
+					packet.SrcPort != 40000+uint16(i) || packet.DstPort != want.dstPort || string(packet.Payload) != want.payload {
+					t.Errorf("packet %d: got %s %v ports %d-%d payload %q, want %s %v port %d payload %q", i,
+						packet.Protocol, packet.Extensions, packet.SrcPort, packet.DstPort, packet.Payload,
+						want.protocol, want.extensions, want.dstPort, want.payload)
+				}
+				if packet.SrcIP.String() != "2001:db8::1" || packet.DstIP.String() != "2001:db8::2" {
+					t.Errorf("packet %d: got addresses %s and %s", i, packet.SrcIP, packet.DstIP)
+				}
+				ReleasePacket(packet)
+			}
+		})
+	}
+}
+
+func TestIPv6SourcesAggregatedPerPrefix(t *testing.T) {
+	tests := []struct {
+		prefixLength    int
+		scanPrefixes    []string // Source prefixes of the port scanning incidents
+		floodPrefixes   []string // Source prefixes of the DDoS incidents
+		trackedSources  int      // Keys of the DDoS request log
+		trackedScanners int      // Keys of the port scanning connection attempts
+	}{
+		{
+			prefixLength:    64,
+			scanPrefixes:    []string{"2001:db8:1:2::/64"},
+			floodPrefixes:   []string{"2001:db8:1:2::/64", "2001:db8:5:6::/64"},
+			trackedSources:  2,
+			trackedScanners: 2,
+		},
+		{
+			prefixLength:    128, // every address counted on its own stays below the thresholds
+			trackedSources:  40,
+			trackedScanners: 40,
+		},
+	}
+
+	_, frames := readCapture(t, "testdata/ipv6_rotating_sources.pcap")
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("prefix length %d", test.prefixLength), func(t *testing.T) {
+			scan := NewPortScanningRuleWithIPv6Prefix(10, time.Minute, test.prefixLength)
+			flood := NewDDoSRuleWithIPv6Prefix(15, time.Minute, test.prefixLength)
+			incidents := replay(t, []Rule{scan, flood}, frames, "eth0")
+
+			scanPrefixes, floodPrefixes := map[string]bool{}, map[string]bool{}
+			for _, incident := range incidents {
+				switch incident.Type {
+				case PortScanning:
+					scanPrefixes[incident.SourcePrefix.String()] = true
+				case DDoSAttack:
+					floodPrefixes[incident.SourcePrefix.String()] = true
+				}
+			}
+			if got := slices.Sorted(maps.Keys(scanPrefixes)); !slices.Equal(got, test.scanPrefixes) {
+				t.Errorf("port scans reported from %v, want %v", got, test.scanPrefixes)
+			}
+			if got := slices.Sorted(maps.Keys(floodPrefixes)); !slices.Equal(got, test.floodPrefixes) {
+				t.Errorf("floods reported from %v, want %v", got, test.floodPrefixes)
+			}
+			flood.Lock()
+			trackedSources := len(flood.RequestLog)
+			flood.Unlock()
+			if trackedSources != test.trackedSources {
+				t.Errorf("DDoS rule tracks %d sources, want %d", trackedSources, test.trackedSources)
+			}
+			scan.Lock()
+			trackedScanners := len(scan.ConnectionAttempts)
+			scan.Unlock()
+			if trackedScanners != test.trackedScanners {
+				t.Errorf("port scanning rule tracks %d sources, want %d", trackedScanners, test.trackedScanners)
+			}
+		})
+	}
+}
+
+func TestIPv6LinkLocalSourcesQualifiedByInterface(t *testing.T) {
+	tests := []struct {
+		name       string
+		interfaces []string // The capture is replayed once per interface
+		keys       []string
+		incidents  int
+	}{
+		{"same address on two links", []string{"eth0", "eth1"}, []string{"fe80::1%eth0", "fe80::1%eth1"}, 0},
+		{"same address on one link", []string{"eth0", "eth0"}, []string{"fe80::1%eth0"}, 5},
+	}
+
+	_, frames := readCapture(t, "testdata/ipv6_link_local.pcap")
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			flood := NewDDoSRule(15, time.Minute)
+			incidents := []*Incident{}
+			for _, iface := range test.interfaces {
+				incidents = append(incidents, replay(t, []Rule{flood}, frames, iface)...)
+			}
+
+			flood.Lock()
+			keys := slices.Sorted(maps.Keys(flood.RequestLog))
+			flood.Unlock()
+			if !slices.Equal(keys, test.keys) {
+				t.Errorf("DDoS rule tracks %v, want %v", keys, test.keys)
+			}
+			if len(incidents) != test.incidents {
+				t.Errorf("got %d incidents, want %d", len(incidents), test.incidents)
+			}
+			for _, incident := range incidents {
+				if incident.Interface != test.interfaces[0] {
+					t.Errorf("incident on interface %q, want %q", incident.Interface, test.interfaces[0])
+				}
+			}
+		})
+	}
+}
+
+// captureFrame is a packet read from a capture file.
+type captureFrame struct {
+	data []byte
+	info gopacket.CaptureInfo
+}
+
+// readCapture reads a classic little-endian .pcap file with microsecond timestamps, the format of the captures
+// in testdata. The files are read without libpcap, so the tests don't depend on the libpcap version.
+func readCapture(t *testing.T, path string) (layers.LinkType, []captureFrame) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) < 24 || binary.LittleEndian.Uint32(data) != 0xa1b2c3d4 {
+		t.Fatalf("%s isn't a little-endian pcap file", path)
+	}
+	linkType := layers.LinkType(binary.LittleEndian.Uint32(data[20:]))
+
+	frames := []captureFrame{}
+	for offset := 24; offset < len(data); {
+		if offset+16 > len(data) {
+			t.Fatalf("%s: truncated record header at offset %d", path, offset)
+		}
+		header := data[offset : offset+16]
+		captured := int(binary.LittleEndian.Uint32(header[8:]))
+		if offset+16+captured > len(data) {
+			t.Fatalf("%s: truncated packet at offset %d", path, offset)
+		}
+		frames = append(frames, captureFrame{
+			data: data[offset+16 : offset+16+captured],
+			info: gopacket.CaptureInfo{
+				Timestamp:     time.Unix(int64(binary.LittleEndian.Uint32(header)), int64(binary.LittleEndian.Uint32(header[4:]))*1000),
+				CaptureLength: captured,
+				Length:        int(binary.LittleEndian.Uint32(header[12:])),
+			},
+		})
+		offset += 16 + captured
+	}
+	return linkType, frames
+}
+
+// replay decodes the frames as captured on the interface and processes them with the rules on event time.
+// It returns the incidents raised, the rules keep the state they recorded.
+func replay(t *testing.T, rules []Rule, frames []captureFrame, iface string) []*Incident {
+	t.Helper()
+	clock := utils.NewEventClock()
+	for _, rule := range rules {
+		if clockAware, ok := rule.(ClockAware); ok {
+			clockAware.SetClock(clock)
+		}
+	}
+	t.Cleanup(func() {
+		for _, rule := range rules {
+			if stoppable, ok := rule.(Stoppable); ok {
+				stoppable.Stop()
+			}
+		}
+	})
+
+	incidents := []*Incident{}
+	decoder, _ := newPacketDecoder(layers.LinkTypeEthernet, iface)
+	for i, frame := range frames {
+		packet := decoder.decode(frame.data, frame.info)
+		if packet == nil {
+			t.Fatalf("packet %d wasn't decoded", i)
+		}
+		clock.Advance(packet.Timestamp)
+		for _, rule := range rules {
+			incidents = append(incidents, rule.Detect(packet)...)
+		}
+	}
+	return incidents
+}
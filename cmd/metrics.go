@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"awesomeProject/metrics"
+	. "awesomeProject/model"
+	. "awesomeProject/rules"
+	"cmp"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/http"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// detectKey identifies the latency histogram of a detection method of a rule.
+type detectKey struct {
+	rule   string
+	method string // Detect or DetectStream
+}
+
+// observeDetect records the time a rule spent detecting incidents in a packet or stream.
+func (n *NIDS) observeDetect(rule Rule, method string, duration time.Duration) {
+	key := detectKey{rule: RuleName(rule), method: method}
+	histogram, ok := n.detectLatency.Load(key)
+	if !ok {
+		histogram, _ = n.detectLatency.LoadOrStore(key, metrics.NewHistogram(metrics.LatencyBuckets))
+	}
+	histogram.(*metrics.Histogram).ObserveDuration(duration)
+}
+
+// countIncident counts an incident raised by a rule or the defragmentation.
+func (n *NIDS) countIncident(incidentType IncidentType) {
+	count, ok := n.incidentCounts.Load(incidentType)
+	if !ok {
+		count, _ = n.incidentCounts.LoadOrStore(incidentType, &atomic.Uint64{})
+	}
+	count.(*atomic.Uint64).Add(1)
+}
+
+// ListenMetrics serves the metrics of the NIDS in the Prometheus text format on the address, under /metrics,
+// until the NIDS is closed.
+func (n *NIDS) ListenMetrics(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler(n))
+	n.metricsServer = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := n.metricsServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Printf("Error serving metrics: %v\n", err)
+		}
+	}()
+	return nil
+}
+
+// Collect implementation according to metrics.Collector
+func (n *NIDS) Collect() []*metrics.Family {
+	families := n.collectCaptures()
+
+	n.mu.Lock()
+	pool, reassembler, defragmenter, aggregator, packets := n.workerPool, n.reassembler, n.defragmenter, n.aggregator, n.packets
+	n.mu.Unlock()
+
+	dropped := metrics.NewFamily("nids_packets_dropped_total", "Packets discarded by the pipeline.", metrics.CounterType)
+	queueDepth := metrics.NewFamily("nids_packet_queue_depth", "Packets waiting to be processed.", metrics.GaugeType)
+	queueDepth.Add(float64(len(packets)), metrics.Label{Name: "queue", Value: "capture"})
+	if pool != nil {
+		dropped.Add(float64(pool.Dropped()), metrics.Label{Name: "reason", Value: "worker_queue_full"})
+		queueDepth.Add(float64(pool.QueueDepth()), metrics.Label{Name: "queue", Value: "workers"})
+	}
+	if defragmenter != nil {
+		dropped.Add(float64(defragmenter.Dropped()), metrics.Label{Name: "reason", Value: "defragmentation"})
+	}
+	families = append(families, dropped, queueDepth)
+
+	if reassembler != nil {
+		connections := metrics.NewFamily("nids_tcp_connections", "TCP connections being reassembled.", metrics.GaugeType)
+		connections.Add(float64(reassembler.Connections()))
+		buffered := metrics.NewFamily("nids_tcp_buffered_bytes", "Out-of-order TCP bytes buffered by the reassembly.", metrics.GaugeType)
+		buffered.Add(float64(reassembler.BufferedBytes()))
+		rejected := metrics.NewFamily("nids_tcp_connections_rejected_total", "TCP connections not reassembled because the connection limit was reached.", metrics.CounterType)
+		rejected.Add(float64(reassembler.Rejected()))
+		families = append(families, connections, buffered, rejected)
+	}
+	if aggregator != nil {
+		pending := metrics.NewFamily("nids_aggregated_incidents_pending", "Merged incidents waiting to be reported.", metrics.GaugeType)
+		pending.Add(float64(aggregator.Pending()))
+		families = append(families, pending)
+	}
+
+	return append(families, n.collectRules()...)
+}
+
+// collectCaptures returns the packet counts of the sniffers, labelled with their interface or capture file.
+func (n *NIDS) collectCaptures() []*metrics.Family {
+	captured := metrics.NewFamily("nids_packets_captured_total", "Packets read from the capture.", metrics.CounterType)
+	decoded := metrics.NewFamily("nids_packets_decoded_total", "Packets decoded and handed to the pipeline.", metrics.CounterType)
+	skipped := metrics.NewFamily("nids_packets_skipped_total", "Packets skipped for lack of an IP or ARP layer or a valid transport header.", metrics.CounterType)
+	received := metrics.NewFamily("nids_pcap_received_total", "Packets received by the kernel, as reported by pcap.", metrics.CounterType)
+	kernelDropped := metrics.NewFamily("nids_pcap_dropped_total", "Packets dropped by the kernel for lack of buffer space, as reported by pcap.", metrics.CounterType)
+	interfaceDropped := metrics.NewFamily("nids_pcap_if_dropped_total", "Packets dropped by the network interface, as reported by pcap.", metrics.CounterType)
+
+	for _, sniffer := range n.PacketSniffers {
+		label := metrics.Label{Name: "interface", Value: sniffer.Name()}
+		stats := sniffer.Stats()
+		captured.Add(float64(stats.Captured), label)
+		decoded.Add(float64(stats.Decoded), label)
+		skipped.Add(float64(stats.Skipped), label)
+		if stats.Kernel != nil {
+			received.Add(float64(stats.Kernel.PacketsReceived), label)
+			kernelDropped.Add(float64(stats.Kernel.PacketsDropped), label)
+			interfaceDropped.Add(float64(stats.Kernel.PacketsIfDropped), label)
+		}
+	}
+	return []*metrics.Family{captured, decoded, skipped, received, kernelDropped, interfaceDropped}
+}
+
+// collectRules returns the detection latencies, the incidents raised and the state tracked by the rules.
+func (n *NIDS) collectRules() []*metrics.Family {
+	latency := metrics.NewFamily("nids_rule_detect_duration_seconds", "Time a rule spent inspecting a packet or stream.", metrics.HistogramType)
+	keys := []detectKey{}
+	n.detectLatency.Range(func(key, _ any) bool {
+		keys = append(keys, key.(detectKey))
+		return true
+	})
+	slices.SortFunc(keys, func(a, b detectKey) int {
+		return cmp.Or(cmp.Compare(a.rule, b.rule), cmp.Compare(a.method, b.method))
+	})
+	for _, key := range keys {
+		histogram, _ := n.detectLatency.Load(key)
+		histogram.(*metrics.Histogram).AddTo(latency,
+			metrics.Label{Name: "rule", Value: key.rule}, metrics.Label{Name: "method", Value: key.method})
+	}
+
+	incidents := metrics.NewFamily("nids_incidents_total", "Incidents raised by the rules and the defragmentation, before aggregation.", metrics.CounterType)
+	incidentTypes := []IncidentType{}
+	n.incidentCounts.Range(func(incidentType, _ any) bool {
+		incidentTypes = append(incidentTypes, incidentType.(IncidentType))
+		return true
+	})
+	slices.Sort(incidentTypes)
+	for _, incidentType := range incidentTypes {
+		count, _ := n.incidentCounts.Load(incidentType)
+		incidents.Add(float64(count.(*atomic.Uint64).Load()), metrics.Label{Name: "type", Value: incidentType.Name()})
+	}
+
+	tracked := metrics.NewFamily("nids_rule_tracked_keys", "Keys in the state maps of a rule, e.g. the sources it counts requests of.", metrics.GaugeType)
+	for _, rule := range n.Rules() {
+		tracking, ok := rule.(Tracking)
+		if !ok {
+			continue
+		}
+		states := tracking.TrackedKeys()
+		for _, state := range slices.Sorted(maps.Keys(states)) {
+			tracked.Add(float64(states[state]),
+				metrics.Label{Name: "rule", Value: RuleName(rule)}, metrics.Label{Name: "map", Value: state})
+		}
+	}
+
+	return []*metrics.Family{latency, incidents, tracked}
+}
@@ -0,0 +1,316 @@
+package cmd
+
+import (
+	. "awesomeProject/model"
+	"encoding/binary"
+	"fmt"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// packetDecoder converts raw frames to Packets without allocating per packet.
+// It decodes into preallocated layers with a gopacket.DecodingLayerParser and fills Packets taken from the
+// packet pool. A packetDecoder is not safe for concurrent use, each capture goroutine owns one.
+type packetDecoder struct {
+	parser   *gopacket.DecodingLayerParser
+	decoded  []gopacket.LayerType
+	iface    string
+	loopback layers.Loopback
+	linuxSLL layers.LinuxSLL
+	ethernet layers.Ethernet
+	dot1q    layers.Dot1Q
+	arp      layers.ARP
+	ipv4     layers.IPv4
+	ipv6     layers.IPv6
+	ipv6Ext  layers.IPv6ExtensionSkipper
+	ipv6Frag ipv6Fragment
+	ah       authenticationHeader
+	tcp      layers.TCP
+	udp      layers.UDP
+	sctp     layers.SCTP
+}
+
+// newPacketDecoder creates a decoder for frames of the given link type.
+// It returns false if the link type is not supported, the generic gopacket decoding has to be used instead.
+func newPacketDecoder(linkType layers.LinkType, iface string) (*packetDecoder, bool) {
+	var first gopacket.LayerType
+	switch linkType {
+	case layers.LinkTypeEthernet:
+		first = layers.LayerTypeEthernet
+	case layers.LinkTypeLinuxSLL:
+		first = layers.LayerTypeLinuxSLL
+	case layers.LinkTypeNull, layers.LinkTypeLoop:
+		first = layers.LayerTypeLoopback
+	case layers.LinkTypeRaw, layers.LinkTypeIPv4:
+		first = layers.LayerTypeIPv4
+	case layers.LinkTypeIPv6:
+		first = layers.LayerTypeIPv6
+	default:
+		return nil, false
+	}
+
+	decoder := &packetDecoder{
+		decoded: make([]gopacket.LayerType, 0, 10),
+		iface:   iface,
+	}
+	decoder.parser = gopacket.NewDecodingLayerParser(first,
+		&decoder.loopback, &decoder.linuxSLL, &decoder.ethernet, &decoder.dot1q, &decoder.arp,
+		&decoder.ipv4, &decoder.ipv6, &decoder.ipv6Ext, &decoder.ipv6Frag, &decoder.ah,
+		&decoder.tcp, &decoder.udp, &decoder.sctp)
+	decoder.parser.IgnoreUnsupported = true // stop at the application payload and at unknown protocols
+	return decoder, true
+}
+
+// decode converts a raw frame to a Packet from the pool or returns nil if it should be ignored.
+// The data may be reused by the caller afterwards, everything kept by the Packet is copied.
+func (decoder *packetDecoder) decode(data []byte, captureInfo gopacket.CaptureInfo) *Packet {
+	// malformed or truncated frames still produce the layers decoded before the error
+	_ = decoder.parser.DecodeLayers(data, &decoder.decoded)
+
+	var network, transport, lastExtension gopacket.LayerType
+	fragmented := false
+	for _, layerType := range decoder.decoded {
+		switch layerType {
+		case layers.LayerTypeIPv4, layers.LayerTypeIPv6, layers.LayerTypeARP:
+			network = layerType
+		case layers.LayerTypeIPv6Fragment:
+			fragmented = true
+		case layers.LayerTypeTCP, layers.LayerTypeUDP, layers.LayerTypeSCTP:
+			transport = layerType
+		}
+		if _, ok := extensionProtocols[layerType]; ok {
+			lastExtension = layerType
+		}
+	}
+	if network == 0 {
+		return nil // Skip packets without an IP or ARP layer
+	}
+
+	packet := AcquirePacket()
+	packet.Timestamp = captureInfo.Timestamp
+	packet.Interface = decoder.iface
+	packet.Length = captureInfo.Length
+	if packet.Length == 0 {
+		packet.Length = len(data) // capture files may not record the wire length
+	}
+
+	if network == layers.LayerTypeARP {
+		arp := &decoder.arp
+		packet.Network = NetworkARP
+		packet.ARPOperation = ARPOperation(arp.Operation)
+		packet.SrcIP = append(packet.SrcIP[:0], arp.SourceProtAddress...)
+		packet.DstIP = append(packet.DstIP[:0], arp.DstProtAddress...)
+		packet.SenderMAC = append(packet.SenderMAC[:0], arp.SourceHwAddress...)
+		packet.TargetMAC = append(packet.TargetMAC[:0], arp.DstHwAddress...)
+		return packet
+	}
+
+	if network == layers.LayerTypeIPv6 && decoder.ipv6.HopByHop != nil {
+		packet.Extensions = append(packet.Extensions, ProtocolIPv6HopByHop) // decoded as part of the IPv6 header
+	}
+	for _, layerType := range decoder.decoded {
+		if protocol, ok := extensionProtocols[layerType]; ok {
+			packet.Extensions = append(packet.Extensions, protocol)
+		}
+	}
+
+	// network layer header fields
+	var ipPayload []byte
+	if network == layers.LayerTypeIPv4 {
+		ip := &decoder.ipv4
+		packet.Network = NetworkIPv4
+		packet.SrcIP = append(packet.SrcIP[:0], ip.SrcIP.To4()...)
+		packet.DstIP = append(packet.DstIP[:0], ip.DstIP.To4()...)
+		packet.Protocol = Protocol(ip.Protocol)
+		packet.TTL = ip.TTL
+		packet.IPID = uint32(ip.Id)
+		packet.FragmentOffset = ip.FragOffset * 8
+		packet.MoreFragments = ip.Flags&layers.IPv4MoreFragments != 0
+		packet.DontFragment = ip.Flags&layers.IPv4DontFragment != 0
+		ipPayload = ip.Payload
+	} else {
+		ip := &decoder.ipv6
+		packet.Network = NetworkIPv6
+		packet.SrcIP = append(packet.SrcIP[:0], ip.SrcIP...)
+		packet.DstIP = append(packet.DstIP[:0], ip.DstIP...)
+		packet.Protocol = Protocol(ip.NextHeader)
+		if ip.HopByHop != nil {
+			packet.Protocol = Protocol(ip.HopByHop.NextHeader)
+		}
+		packet.TTL = ip.HopLimit
+		if fragmented {
+			packet.IPID = decoder.ipv6Frag.Identification
+			packet.FragmentOffset = decoder.ipv6Frag.FragmentOffset * 8
+			packet.MoreFragments = decoder.ipv6Frag.MoreFragments
+		}
+		ipPayload = ip.Payload
+	}
+
+	// the protocol and data following the extension headers, the skipper holds the last header it skipped
+	switch lastExtension {
+	case 0:
+	case layers.LayerTypeIPv6Fragment:
+		packet.Protocol = Protocol(decoder.ipv6Frag.NextHeader)
+		ipPayload = decoder.ipv6Frag.Payload
+	case layers.LayerTypeIPSecAH:
+		packet.Protocol = Protocol(decoder.ah.NextHeader)
+		ipPayload = decoder.ah.Payload
+	default:
+		packet.Protocol = Protocol(decoder.ipv6Ext.NextHeader)
+		ipPayload = decoder.ipv6Ext.Payload
+	}
+
+	// fragments keep their raw IP payload for the defragmentation, everything but TCP, UDP and SCTP
+	// (e.g. ICMP, IPv6 atomic fragments, truncated headers) is decoded from the IP payload
+	if packet.IsFragment() || transport == 0 {
+		packet.Payload = append(packet.Payload[:0], ipPayload...)
+		if packet.IsFragment() || decodeUpperLayer(packet) {
+			return packet
+		}
+		ReleasePacket(packet)
+		return nil // Skip malformed packets
+	}
+
+	// transport layer header fields
+	var payload []byte
+	switch transport {
+	case layers.LayerTypeTCP:
+		tcp := &decoder.tcp
+		packet.Protocol = ProtocolTCP
+		packet.SrcPort, packet.DstPort = uint16(tcp.SrcPort), uint16(tcp.DstPort)
+		packet.TCPFlags = tcpFlags(tcp)
+		packet.Seq, packet.Ack = tcp.Seq, tcp.Ack
+		payload = tcp.Payload
+	case layers.LayerTypeUDP:
+		udp := &decoder.udp
+		packet.Protocol = ProtocolUDP
+		packet.SrcPort, packet.DstPort = uint16(udp.SrcPort), uint16(udp.DstPort)
+		payload = udp.Payload
+	case layers.LayerTypeSCTP:
+		sctp := &decoder.sctp
+		packet.Protocol = ProtocolSCTP
+		packet.SrcPort, packet.DstPort = uint16(sctp.SrcPort), uint16(sctp.DstPort)
+	}
+
+	// only the application data is kept, copied into the buffer of the pooled packet
+	packet.Payload = append(packet.Payload[:0], payload...)
+	return packet
+}
+
+// decodeUpperLayer decodes the header following the IP header (and its extensions) at the start of the payload,
+// as found in reassembled datagrams. It fills the TCP, UDP, SCTP or ICMP fields and keeps only the data following
+// the header as payload, the payload of other protocols is kept as is.
+// It returns false if the header is malformed.
+func decodeUpperLayer(packet *Packet) bool {
+	var payload []byte
+	switch packet.Protocol {
+	case ProtocolTCP:
+		tcp := &layers.TCP{}
+		if err := tcp.DecodeFromBytes(packet.Payload, gopacket.NilDecodeFeedback); err != nil {
+			return false
+		}
+		packet.SrcPort, packet.DstPort = uint16(tcp.SrcPort), uint16(tcp.DstPort)
+		packet.TCPFlags = tcpFlags(tcp)
+		packet.Seq, packet.Ack = tcp.Seq, tcp.Ack
+		payload = tcp.Payload
+	case ProtocolUDP:
+		udp := &layers.UDP{}
+		if err := udp.DecodeFromBytes(packet.Payload, gopacket.NilDecodeFeedback); err != nil {
+			return false
+		}
+		packet.SrcPort, packet.DstPort = uint16(udp.SrcPort), uint16(udp.DstPort)
+		payload = udp.Payload
+	case ProtocolSCTP:
+		sctp := &layers.SCTP{}
+		if err := sctp.DecodeFromBytes(packet.Payload, gopacket.NilDecodeFeedback); err != nil {
+			return false
+		}
+		packet.SrcPort, packet.DstPort = uint16(sctp.SrcPort), uint16(sctp.DstPort)
+	case ProtocolICMPv4, ProtocolICMPv6:
+		if len(packet.Payload) < 4 {
+			return false
+		}
+		packet.ICMPType, packet.ICMPCode = packet.Payload[0], packet.Payload[1]
+		payload = packet.Payload[4:] // after type, code and checksum
+	default:
+		return true
+	}
+
+	// the data follows the header in the same buffer
+	packet.Payload = append(packet.Payload[:0], payload...)
+	return true
+}
+
+// extensionProtocols maps the layer types of IPv6 extension headers and IPsec AH to their protocol numbers.
+var extensionProtocols = map[gopacket.LayerType]Protocol{
+	layers.LayerTypeIPv6HopByHop:    ProtocolIPv6HopByHop,
+	layers.LayerTypeIPv6Routing:     ProtocolIPv6Routing,
+	layers.LayerTypeIPv6Fragment:    ProtocolIPv6Fragment,
+	layers.LayerTypeIPv6Destination: ProtocolIPv6Destination,
+	layers.LayerTypeIPSecAH:         ProtocolAH,
+}
+
+// ipv6Fragment makes layers.IPv6Fragment usable with a DecodingLayerParser.
+// Like the generic gopacket decoding, the data following the fragment header is not decoded any further.
+type ipv6Fragment struct {
+	layers.IPv6Fragment
+}
+
+// DecodeFromBytes implementation according to gopacket.DecodingLayer
+func (fragment *ipv6Fragment) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 8 {
+		df.SetTruncated()
+		return fmt.Errorf("invalid ip6-fragment header, length %d less than 8", len(data))
+	}
+	fragment.BaseLayer = layers.BaseLayer{Contents: data[:8], Payload: data[8:]}
+	fragment.NextHeader = layers.IPProtocol(data[0])
+	fragment.Reserved1 = data[1]
+	fragment.FragmentOffset = binary.BigEndian.Uint16(data[2:4]) >> 3
+	fragment.Reserved2 = data[3] & 0x6 >> 1
+	fragment.MoreFragments = data[3]&0x1 != 0
+	fragment.Identification = binary.BigEndian.Uint32(data[4:8])
+	return nil
+}
+
+// CanDecode implementation according to gopacket.DecodingLayer
+func (fragment *ipv6Fragment) CanDecode() gopacket.LayerClass {
+	return layers.LayerTypeIPv6Fragment
+}
+
+// NextLayerType implementation according to gopacket.DecodingLayer
+func (fragment *ipv6Fragment) NextLayerType() gopacket.LayerType {
+	return gopacket.LayerTypeFragment
+}
+
+// authenticationHeader decodes an IPsec authentication header (RFC 4302) with a DecodingLayerParser.
+// The header is authenticated but not encrypted, so the transport header following it can be inspected.
+type authenticationHeader struct {
+	layers.BaseLayer
+	NextHeader layers.IPProtocol
+}
+
+// DecodeFromBytes implementation according to gopacket.DecodingLayer
+func (header *authenticationHeader) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 12 {
+		df.SetTruncated()
+		return fmt.Errorf("invalid authentication header, length %d less than 12", len(data))
+	}
+	length := (int(data[1]) + 2) * 4
+	if len(data) < length {
+		df.SetTruncated()
+		return fmt.Errorf("invalid authentication header, length %d less than %d", len(data), length)
+	}
+	header.BaseLayer = layers.BaseLayer{Contents: data[:length], Payload: data[length:]}
+	header.NextHeader = layers.IPProtocol(data[0])
+	return nil
+}
+
+// CanDecode implementation according to gopacket.DecodingLayer
+func (header *authenticationHeader) CanDecode() gopacket.LayerClass {
+	return layers.LayerTypeIPSecAH
+}
+
+// NextLayerType implementation according to gopacket.DecodingLayer
+func (header *authenticationHeader) NextLayerType() gopacket.LayerType {
+	return header.NextHeader.LayerType()
+}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	. "awesomeProject/model"
+	"bytes"
+	"fmt"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPacketDecoderMatchesGopacket(t *testing.T) {
+	frames, err := syntheticCapture(30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoder, _ := newPacketDecoder(layers.LinkTypeEthernet, "synthetic")
+	generic := genericDecoder("synthetic")
+
+	for i, frame := range frames {
+		captureInfo := gopacket.CaptureInfo{Timestamp: time.Unix(int64(i), 0), CaptureLength: len(frame), Length: len(frame)}
+		want := generic(frame, captureInfo)
+		got := decoder.decode(frame, captureInfo)
+		if want == nil || got == nil {
+			t.Fatalf("frame %d: decoded %v with gopacket and %v with the DecodingLayerParser", i, want, got)
+		}
+		if !got.SrcIP.Equal(want.SrcIP) || !got.DstIP.Equal(want.DstIP) || got.SrcPort != want.SrcPort ||
+			got.DstPort != want.DstPort || got.Protocol != want.Protocol || got.TCPFlags != want.TCPFlags ||
+			got.Length != want.Length || !bytes.Equal(got.Payload, want.Payload) {
+			t.Errorf("frame %d: DecodingLayerParser decoded %+v, gopacket %+v", i, got, want)
+		}
+		ReleasePacket(got)
+	}
+}
+
+func BenchmarkPacketDecoder(b *testing.B) {
+	decoder, _ := newPacketDecoder(layers.LinkTypeEthernet, "synthetic")
+	benchmarkDecoder(b, decoder.decode)
+}
+
+func BenchmarkGopacketDecode(b *testing.B) {
+	benchmarkDecoder(b, genericDecoder("synthetic"))
+}
+
+// genericDecoder returns the gopacket.NewPacket based decoding used for link types the packetDecoder doesn't support.
+func genericDecoder(name string) func(data []byte, captureInfo gopacket.CaptureInfo) *Packet {
+	sniffer := &PacketSniffer{name: name}
+	return func(data []byte, captureInfo gopacket.CaptureInfo) *Packet {
+		packet := gopacket.NewPacket(data, layers.LinkTypeEthernet, gopacket.Default)
+		packet.Metadata().CaptureInfo = captureInfo
+		return sniffer.convertToPacketDTO(packet)
+	}
+}
+
+// benchmarkDecoder runs decode over a synthetic capture, releasing the packets like the NIDS does.
+func benchmarkDecoder(b *testing.B, decode func(data []byte, captureInfo gopacket.CaptureInfo) *Packet) {
+	frames, err := syntheticCapture(3000)
+	if err != nil {
+		b.Fatal(err)
+	}
+	captureInfo := gopacket.CaptureInfo{Timestamp: time.Now()}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		frame := frames[i%len(frames)]
+		captureInfo.CaptureLength, captureInfo.Length = len(frame), len(frame)
+		if packet := decode(frame, captureInfo); packet != nil {
+			ReleasePacket(packet)
+		}
+	}
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "pkts/s")
+}
+
+// syntheticCapture builds count Ethernet frames alternating HTTP requests over TCP/IPv4,
+// DNS-sized datagrams over UDP/IPv4 and TCP segments over IPv6.
+func syntheticCapture(count int) ([][]byte, error) {
+	httpRequest := gopacket.Payload("GET /index.html?id=1 HTTP/1.1\r\nHost: example.com\r\nUser-Agent: nids\r\n\r\n")
+	dnsQuery := gopacket.Payload(make([]byte, 48))
+	options := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+
+	frames := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		ethernet := &layers.Ethernet{
+			SrcMAC:       net.HardwareAddr{0x02, 0, 0, 0, 0, 1},
+			DstMAC:       net.HardwareAddr{0x02, 0, 0, 0, 0, 2},
+			EthernetType: layers.EthernetTypeIPv4,
+		}
+		ipv4 := &layers.IPv4{
+			Version: 4, TTL: 64, Id: uint16(i),
+			SrcIP: net.IPv4(10, 0, byte(i>>8), byte(i)), DstIP: net.IPv4(10, 1, 0, 1),
+		}
+		srcPort := layers.TCPPort(1024 + i%60000)
+
+		var serializable []gopacket.SerializableLayer
+		switch i % 3 {
+		case 0:
+			ipv4.Protocol = layers.IPProtocolTCP
+			tcp := &layers.TCP{SrcPort: srcPort, DstPort: 80, Seq: uint32(i), ACK: true, PSH: true, Window: 65535}
+			tcp.SetNetworkLayerForChecksum(ipv4)
+			serializable = []gopacket.SerializableLayer{ethernet, ipv4, tcp, httpRequest}
+		case 1:
+			ipv4.Protocol = layers.IPProtocolUDP
+			udp := &layers.UDP{SrcPort: layers.UDPPort(srcPort), DstPort: 53}
+			udp.SetNetworkLayerForChecksum(ipv4)
+			serializable = []gopacket.SerializableLayer{ethernet, ipv4, udp, dnsQuery}
+		default:
+			ethernet.EthernetType = layers.EthernetTypeIPv6
+			ipv6 := &layers.IPv6{
+				Version: 6, HopLimit: 64, NextHeader: layers.IPProtocolTCP,
+				SrcIP: net.ParseIP(fmt.Sprintf("2001:db8::%x", i&0xffff)), DstIP: net.ParseIP("2001:db8:1::1"),
+			}
+			tcp := &layers.TCP{SrcPort: srcPort, DstPort: 443, Seq: uint32(i), SYN: true, Window: 65535}
+			tcp.SetNetworkLayerForChecksum(ipv6)
+			serializable = []gopacket.SerializableLayer{ethernet, ipv6, tcp}
+		}
+
+		buffer := gopacket.NewSerializeBuffer()
+		if err := gopacket.SerializeLayers(buffer, options, serializable...); err != nil {
+			return nil, fmt.Errorf("error building synthetic frame %d: %w", i, err)
+		}
+		frames = append(frames, buffer.Bytes())
+	}
+	return frames, nil
+}
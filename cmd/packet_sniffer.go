@@ -2,74 +2,368 @@ package cmd
 
 import (
 	. "awesomeProject/model"
+	"context"
+	"errors"
 	"fmt"
 	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
 	"github.com/google/gopacket/pcap"
+	"io"
 	"net"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// captureTimeout bounds how long a read on a live interface blocks, so a cancelled capture is noticed quickly.
+const captureTimeout = 500 * time.Millisecond
+
+// MaxSnapLen is the largest snapshot length accepted by CaptureOptions.
+const MaxSnapLen = 262144
+
+// CaptureOptions configures how packets are captured from a live interface.
+type CaptureOptions struct {
+	SnapLen     int    // Maximum number of bytes captured per packet
+	Promiscuous bool   // Capture all traffic seen by the interface, not only traffic addressed to it
+	Filter      string // BPF filter expression, e.g. "not net 10.1.0.0/16"; empty captures everything
+}
+
+// DefaultCaptureOptions returns options capturing every packet in promiscuous mode with a 1600 bytes snapshot.
+func DefaultCaptureOptions() CaptureOptions {
+	return CaptureOptions{
+		SnapLen:     1600,
+		Promiscuous: true,
+	}
+}
+
+// CaptureStats counts the packets read by a PacketSniffer.
+type CaptureStats struct {
+	Captured uint64      // Packets read from the handle
+	Decoded  uint64      // Packets handed to the pipeline
+	Skipped  uint64      // Packets without an IP or ARP layer, or with a malformed transport header
+	Kernel   *pcap.Stats // Packets received and dropped by the kernel, nil for capture files
+}
+
 // PacketSniffer handles the logic of capturing network packets.
 type PacketSniffer struct {
-	handle *pcap.Handle
+	handle   *pcap.Handle
+	name     string // Ingress interface (or capture file) the packets are tagged with
+	captured atomic.Uint64
+	decoded  atomic.Uint64
+	skipped  atomic.Uint64
+	mu       sync.Mutex // Guards the handle against reading its statistics while it is closed
+	closed   bool
+	kernel   *pcap.Stats // Kernel statistics read when the handle was closed
 }
 
-// NewPacketSniffer initializes the packet sniffer and returns an error if it fails.
+// NewPacketSniffer initializes the packet sniffer with the default capture options and returns an error if it fails.
 func NewPacketSniffer(device string) (*PacketSniffer, error) {
-	handle, err := pcap.OpenLive(device, 1600, true, pcap.BlockForever)
+	return NewPacketSnifferWithOptions(device, DefaultCaptureOptions())
+}
+
+// NewPacketSnifferWithOptions initializes a packet sniffer on a live interface with the given capture options.
+// The BPF filter is attached to the pcap handle, so the kernel discards non-matching packets before they are copied
+// to user space.
+func NewPacketSnifferWithOptions(device string, options CaptureOptions) (*PacketSniffer, error) {
+	if options.SnapLen <= 0 || options.SnapLen > MaxSnapLen {
+		return nil, fmt.Errorf("snapshot length must be between 1 and %d, got %d", MaxSnapLen, options.SnapLen)
+	}
+
+	inactive, err := pcap.NewInactiveHandle(device)
+	if err != nil {
+		return nil, fmt.Errorf("error opening device %s: %w", device, err)
+	}
+	defer inactive.CleanUp()
+
+	if err := inactive.SetSnapLen(options.SnapLen); err != nil {
+		return nil, fmt.Errorf("error setting snapshot length on %s: %w", device, err)
+	}
+	if err := inactive.SetPromisc(options.Promiscuous); err != nil {
+		return nil, fmt.Errorf("error setting promiscuous mode on %s: %w", device, err)
+	}
+	if err := inactive.SetTimeout(captureTimeout); err != nil {
+		return nil, fmt.Errorf("error setting read timeout on %s: %w", device, err)
+	}
+
+	handle, err := inactive.Activate()
 	if err != nil {
 		return nil, fmt.Errorf("error opening device %s: %w", device, err)
 	}
-	return &PacketSniffer{handle: handle}, nil
+
+	sniffer := &PacketSniffer{handle: handle, name: device}
+	if options.Filter != "" {
+		if err := sniffer.SetFilter(options.Filter); err != nil {
+			sniffer.Close()
+			return nil, err
+		}
+	}
+	return sniffer, nil
+}
+
+// NewPacketSnifferFromFile initializes a packet sniffer that replays a saved .pcap or .pcapng capture file.
+// Capture returns once every packet of the file has been read.
+func NewPacketSnifferFromFile(path string) (*PacketSniffer, error) {
+	handle, err := pcap.OpenOffline(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening capture file %s: %w", path, err)
+	}
+	return &PacketSniffer{handle: handle, name: path}, nil
+}
+
+// Name returns the interface (or capture file) the sniffer reads from.
+func (sniffer *PacketSniffer) Name() string {
+	return sniffer.name
+}
+
+// SetFilter applies a BPF filter expression to the capture handle, e.g. "tcp and not port 22".
+// On live interfaces the filter runs in the kernel, on capture files it is evaluated by libpcap.
+func (sniffer *PacketSniffer) SetFilter(expression string) error {
+	if err := sniffer.handle.SetBPFFilter(expression); err != nil {
+		return fmt.Errorf("error applying filter %q: %w", expression, err)
+	}
+	return nil
+}
+
+// ValidateFilter checks that a BPF filter expression compiles for captures of the link type,
+// e.g. layers.LinkTypeLinuxSLL for captures on the "any" device.
+func ValidateFilter(expression string, linkType layers.LinkType) error {
+	if _, err := pcap.CompileBPFFilter(linkType, MaxSnapLen, expression); err != nil {
+		return fmt.Errorf("invalid BPF filter %q for %s captures: %w", expression, linkType, err)
+	}
+	return nil
+}
+
+// CaptureFileLinkType returns the link type of the packets saved in a .pcap or .pcapng capture file.
+func CaptureFileLinkType(path string) (layers.LinkType, error) {
+	handle, err := pcap.OpenOffline(path)
+	if err != nil {
+		return 0, fmt.Errorf("error opening capture file %s: %w", path, err)
+	}
+	defer handle.Close()
+	return handle.LinkType(), nil
 }
 
 // Capture captures packets and sends them to a channel for processing.
-func (sniffer *PacketSniffer) Capture(packetChan chan<- *Packet) {
-	packetSource := gopacket.NewPacketSource(sniffer.handle, sniffer.handle.LinkType())
-	for packet := range packetSource.Packets() {
+// It returns when the context is cancelled or the packet source is exhausted (e.g. at the end of a capture file).
+func (sniffer *PacketSniffer) Capture(ctx context.Context, packetChan chan<- *Packet) {
+	decode := sniffer.decoderFor(sniffer.handle.LinkType())
+	for ctx.Err() == nil {
+		// the data is only valid until the next read, the decoders copy what they keep
+		data, captureInfo, err := sniffer.handle.ZeroCopyReadPacketData()
+		if err != nil {
+			if isEndOfCapture(err) {
+				return
+			}
+			if !errors.Is(err, pcap.NextErrorTimeoutExpired) {
+				fmt.Printf("Error reading packet: %v\n", err)
+				time.Sleep(5 * time.Millisecond) // avoid spinning on a persistent error
+			}
+			continue
+		}
 
-		// To process packets synchronously (not using goroutines), you can do:
-		if convertedPacket := sniffer.convertToPacketDTO(packet); convertedPacket != nil {
-			packetChan <- convertedPacket
+		sniffer.captured.Add(1)
+		convertedPacket := decode(data, captureInfo)
+		if convertedPacket == nil {
+			sniffer.skipped.Add(1)
+			continue
 		}
+		sniffer.decoded.Add(1)
+		select {
+		case packetChan <- convertedPacket:
+		case <-ctx.Done():
+			ReleasePacket(convertedPacket)
+			return
+		}
+	}
+}
+
+// Stats returns the packet counts of the sniffer. The kernel statistics of a closed sniffer are the ones
+// read when it was closed.
+func (sniffer *PacketSniffer) Stats() CaptureStats {
+	stats := CaptureStats{
+		Captured: sniffer.captured.Load(),
+		Decoded:  sniffer.decoded.Load(),
+		Skipped:  sniffer.skipped.Load(),
+	}
+
+	sniffer.mu.Lock()
+	defer sniffer.mu.Unlock()
+	if sniffer.closed {
+		stats.Kernel = sniffer.kernel
+	} else {
+		stats.Kernel = sniffer.kernelStats()
+	}
+	return stats
+}
+
+// kernelStats reads the statistics of the handle, nil if it doesn't have any, as is the case for capture files.
+func (sniffer *PacketSniffer) kernelStats() *pcap.Stats {
+	kernel, err := sniffer.handle.Stats()
+	if err != nil {
+		return nil
+	}
+	return kernel
+}
 
-		// To process packet asynchronously (by go routines), you can do:
-		//go func(p gopacket.Packet) {
-		//	if convertedPacket := sniffer.convertToPacketDTO(p); convertedPacket != nil {
-		//		packetChan <- convertedPacket
-		//	}
-		//}(packet) // Pass the current packet to the goroutine
+// decoderFor returns the function converting raw frames of the link type to Packets.
+// Common link types use the allocation free packetDecoder, others fall back to the generic gopacket decoding.
+func (sniffer *PacketSniffer) decoderFor(linkType layers.LinkType) func(data []byte, captureInfo gopacket.CaptureInfo) *Packet {
+	if decoder, ok := newPacketDecoder(linkType, sniffer.name); ok {
+		return decoder.decode
 	}
+
+	return func(data []byte, captureInfo gopacket.CaptureInfo) *Packet {
+		packet := gopacket.NewPacket(data, linkType, gopacket.Default) // copies the data
+		packet.Metadata().CaptureInfo = captureInfo
+		return sniffer.convertToPacketDTO(packet)
+	}
+}
+
+// isEndOfCapture reports whether a read error means that no more packets will be delivered.
+func isEndOfCapture(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.ErrClosedPipe)
 }
 
 // convertToPacketDTO converts a gopacket.Packet to our Packet DTO or returns nil if it should be ignored.
+// It is the generic decoding path used for link types the packetDecoder doesn't support.
 func (sniffer *PacketSniffer) convertToPacketDTO(packet gopacket.Packet) *Packet {
+	converted := &Packet{
+		Timestamp: packet.Metadata().Timestamp,
+		Interface: sniffer.name,
+		Length:    packet.Metadata().Length,
+	}
+	if converted.Length == 0 {
+		converted.Length = len(packet.Data()) // capture files may not record the wire length
+	}
+
+	if arp, ok := packet.Layer(layers.LayerTypeARP).(*layers.ARP); ok {
+		converted.Network = NetworkARP
+		converted.ARPOperation = ARPOperation(arp.Operation)
+		converted.SrcIP = append(net.IP(nil), arp.SourceProtAddress...)
+		converted.DstIP = append(net.IP(nil), arp.DstProtAddress...)
+		converted.SenderMAC = append(net.HardwareAddr(nil), arp.SourceHwAddress...)
+		converted.TargetMAC = append(net.HardwareAddr(nil), arp.DstHwAddress...)
+		return converted
+	}
+
 	ipLayer := packet.NetworkLayer()
 	if ipLayer == nil {
-		return nil // Skip packets without an IP layer
+		return nil // Skip packets without an IP or ARP layer
+	}
+	srcIP, dstIP := ipLayer.NetworkFlow().Src().Raw(), ipLayer.NetworkFlow().Dst().Raw()
+	converted.SrcIP = append(net.IP(nil), srcIP...) // 4 bytes for IPv4, like the packetDecoder
+	converted.DstIP = append(net.IP(nil), dstIP...)
+
+	// network layer header fields
+	var ipPayload []byte
+	switch ip := ipLayer.(type) {
+	case *layers.IPv4:
+		converted.Network = NetworkIPv4
+		converted.Protocol = Protocol(ip.Protocol)
+		converted.TTL = ip.TTL
+		converted.IPID = uint32(ip.Id)
+		converted.FragmentOffset = ip.FragOffset * 8
+		converted.MoreFragments = ip.Flags&layers.IPv4MoreFragments != 0
+		converted.DontFragment = ip.Flags&layers.IPv4DontFragment != 0
+		ipPayload = ip.Payload
+	case *layers.IPv6:
+		converted.Network = NetworkIPv6
+		converted.Protocol = Protocol(ip.NextHeader)
+		converted.TTL = ip.HopLimit
+		if fragment, ok := packet.Layer(layers.LayerTypeIPv6Fragment).(*layers.IPv6Fragment); ok {
+			converted.IPID = fragment.Identification
+			converted.FragmentOffset = fragment.FragmentOffset * 8
+			converted.MoreFragments = fragment.MoreFragments
+		}
+		ipPayload = ip.Payload
+	default:
+		return nil
 	}
 
-	srcIP, dstIP := ipLayer.NetworkFlow().Src().String(), ipLayer.NetworkFlow().Dst().String()
+	// extension headers, the last one tells the protocol and data following them
+	for _, layer := range packet.Layers() {
+		if protocol, next, ok := extensionHeader(layer); ok {
+			converted.Extensions = append(converted.Extensions, protocol)
+			converted.Protocol = Protocol(next)
+			ipPayload = layer.LayerPayload()
+		}
+	}
+
+	// fragments keep their raw IP payload for the defragmentation, everything but TCP, UDP and SCTP
+	// (e.g. ICMP, IPv6 atomic fragments, truncated headers) is decoded from the IP payload
 	transportLayer := packet.TransportLayer()
-	if transportLayer == nil {
-		return nil // Skip packets without a transport layer
+	if converted.IsFragment() || transportLayer == nil {
+		converted.Payload = append([]byte(nil), ipPayload...)
+		if converted.IsFragment() || decodeUpperLayer(converted) {
+			return converted
+		}
+		return nil // Skip malformed packets
+	}
+
+	// transport layer header fields
+	switch transport := transportLayer.(type) {
+	case *layers.TCP:
+		converted.Protocol = ProtocolTCP
+		converted.SrcPort, converted.DstPort = uint16(transport.SrcPort), uint16(transport.DstPort)
+		converted.TCPFlags = tcpFlags(transport)
+		converted.Seq, converted.Ack = transport.Seq, transport.Ack
+	case *layers.UDP:
+		converted.Protocol = ProtocolUDP
+		converted.SrcPort, converted.DstPort = uint16(transport.SrcPort), uint16(transport.DstPort)
+	case *layers.SCTP:
+		converted.Protocol = ProtocolSCTP
+		converted.SrcPort, converted.DstPort = uint16(transport.SrcPort), uint16(transport.DstPort)
 	}
 
-	srcPort, dstPort := transportLayer.TransportFlow().Src().String(), transportLayer.TransportFlow().Dst().String()
+	// only the application data is kept, the headers are described by the fields above
+	converted.Payload = transportLayer.LayerPayload()
 
-	return &Packet{
-		Timestamp: packet.Metadata().Timestamp,
-		SrcIP:     net.ParseIP(srcIP),
-		SrcPort:   srcPort,
-		DstIP:     net.ParseIP(dstIP),
-		DstPort:   dstPort,
-		Length:    len(packet.Data()),
-		Payload:   string(packet.Data()), // Convert the byte slice to string for Payload
+	return converted
+}
+
+// extensionHeader returns the protocol number and the next header of IPv6 extension header and IPsec AH layers.
+func extensionHeader(layer gopacket.Layer) (Protocol, layers.IPProtocol, bool) {
+	switch header := layer.(type) {
+	case *layers.IPv6HopByHop:
+		return ProtocolIPv6HopByHop, header.NextHeader, true
+	case *layers.IPv6Routing:
+		return ProtocolIPv6Routing, header.NextHeader, true
+	case *layers.IPv6Fragment:
+		return ProtocolIPv6Fragment, header.NextHeader, true
+	case *layers.IPv6Destination:
+		return ProtocolIPv6Destination, header.NextHeader, true
+	case *layers.IPSecAH:
+		return ProtocolAH, header.NextHeader, true
+	default:
+		return 0, 0, false
+	}
+}
+
+// tcpFlags collects the control flags of a TCP segment.
+func tcpFlags(tcp *layers.TCP) TCPFlags {
+	var flags TCPFlags
+	for _, flag := range []struct {
+		set  bool
+		flag TCPFlags
+	}{
+		{tcp.FIN, TCPFlagFIN}, {tcp.SYN, TCPFlagSYN}, {tcp.RST, TCPFlagRST}, {tcp.PSH, TCPFlagPSH},
+		{tcp.ACK, TCPFlagACK}, {tcp.URG, TCPFlagURG}, {tcp.ECE, TCPFlagECE}, {tcp.CWR, TCPFlagCWR},
+	} {
+		if flag.set {
+			flags |= flag.flag
+		}
 	}
+	return flags
 }
 
-//// Close releases the resources held by the packet sniffer.
-//func (sniffer *PacketSniffer) Close() {
-//	if err := sniffer.handle.Close(); err != nil {
-//		fmt.Printf("Error closing pcap handle: %v\n", err)
-//	}
-//}
+// Close releases the resources held by the packet sniffer.
+func (sniffer *PacketSniffer) Close() {
+	sniffer.mu.Lock()
+	defer sniffer.mu.Unlock()
+	if sniffer.closed {
+		return
+	}
+	sniffer.kernel = sniffer.kernelStats()
+	sniffer.closed = true
+	sniffer.handle.Close()
+}
@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	. "awesomeProject/model"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// DropPolicy decides what happens to a packet when the queue of its worker is full.
+type DropPolicy int
+
+const (
+	BlockWhenFull DropPolicy = iota // Wait for room in the queue, slowing down the capture
+	DropNewest                      // Discard the incoming packet
+	DropOldest                      // Discard the oldest queued packet to make room for the incoming one
+)
+
+// String method for better readability
+func (policy DropPolicy) String() string {
+	switch policy {
+	case BlockWhenFull:
+		return "block"
+	case DropNewest:
+		return "drop-newest"
+	case DropOldest:
+		return "drop-oldest"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseDropPolicy converts the name of a drop policy ("block", "drop-newest", "drop-oldest") to a DropPolicy.
+func ParseDropPolicy(name string) (DropPolicy, error) {
+	for _, policy := range []DropPolicy{BlockWhenFull, DropNewest, DropOldest} {
+		if policy.String() == name {
+			return policy, nil
+		}
+	}
+	return BlockWhenFull, fmt.Errorf("unknown drop policy %q (expected block, drop-newest or drop-oldest)", name)
+}
+
+// WorkerPoolConfig holds the sizing of the packet processing worker pool.
+type WorkerPoolConfig struct {
+	Workers    int        // Number of worker goroutines
+	QueueDepth int        // Number of packets each worker can queue
+	DropPolicy DropPolicy // What to do with packets when a worker queue is full
+}
+
+// DefaultWorkerPoolConfig returns a configuration with one worker per CPU.
+func DefaultWorkerPoolConfig() WorkerPoolConfig {
+	return WorkerPoolConfig{
+		Workers:    runtime.NumCPU(),
+		QueueDepth: 1000,
+		DropPolicy: BlockWhenFull,
+	}
+}
+
+// Validate checks that the configuration describes a usable pool.
+func (config WorkerPoolConfig) Validate() error {
+	if config.Workers < 1 {
+		return fmt.Errorf("worker count must be at least 1, got %d", config.Workers)
+	}
+	if config.QueueDepth < 1 {
+		return fmt.Errorf("queue depth must be at least 1, got %d", config.QueueDepth)
+	}
+	if config.DropPolicy.String() == "unknown" {
+		return errors.New("unknown drop policy")
+	}
+	return nil
+}
+
+// WorkerPool processes packets on a fixed number of workers.
+// Packets of the same flow are always assigned to the same worker, which keeps them in order.
+type WorkerPool struct {
+	config  WorkerPoolConfig
+	queues  []chan *Packet
+	wg      sync.WaitGroup
+	dropped atomic.Uint64
+}
+
+// NewWorkerPool starts the workers of the pool, each calling process for the packets of its queue.
+func NewWorkerPool(config WorkerPoolConfig, process func(packet *Packet)) (*WorkerPool, error) {
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid worker pool configuration: %w", err)
+	}
+
+	pool := &WorkerPool{
+		config: config,
+		queues: make([]chan *Packet, config.Workers),
+	}
+	for i := range pool.queues {
+		queue := make(chan *Packet, config.QueueDepth)
+		pool.queues[i] = queue
+
+		pool.wg.Add(1)
+		go func() {
+			defer pool.wg.Done()
+			for packet := range queue {
+				process(packet)
+			}
+		}()
+	}
+	return pool, nil
+}
+
+// Submit queues the packet on the worker owning its flow.
+// It returns false if the packet was dropped because of the drop policy.
+func (pool *WorkerPool) Submit(packet *Packet) bool {
+	queue := pool.queues[flowHash(packet)%uint32(len(pool.queues))]
+
+	switch pool.config.DropPolicy {
+	case DropNewest:
+		select {
+		case queue <- packet:
+			return true
+		default:
+			pool.dropped.Add(1)
+			ReleasePacket(packet)
+			return false
+		}
+	case DropOldest:
+		for {
+			select {
+			case queue <- packet:
+				return true
+			default:
+			}
+
+			// make room by discarding the oldest packet, the worker may have emptied the queue meanwhile
+			select {
+			case oldest := <-queue:
+				pool.dropped.Add(1)
+				ReleasePacket(oldest)
+			default:
+			}
+		}
+	default:
+		queue <- packet
+		return true
+	}
+}
+
+// Dropped returns the number of packets discarded because a worker queue was full.
+func (pool *WorkerPool) Dropped() uint64 {
+	return pool.dropped.Load()
+}
+
+// QueueDepth returns the number of packets currently waiting in the worker queues.
+func (pool *WorkerPool) QueueDepth() int {
+	depth := 0
+	for _, queue := range pool.queues {
+		depth += len(queue)
+	}
+	return depth
+}
+
+// Close stops accepting packets and waits for the workers to process every queued packet.
+func (pool *WorkerPool) Close() {
+	for _, queue := range pool.queues {
+		close(queue)
+	}
+	pool.wg.Wait()
+}
+
+// flowHash hashes the 5-tuple (addresses, ports and protocol) of the packet.
+// The endpoints are ordered first so both directions of a connection land on the same worker.
+func flowHash(packet *Packet) uint32 {
+	src := binary.BigEndian.AppendUint16(append(make([]byte, 0, 18), packet.SrcIP.To16()...), packet.SrcPort)
+	dst := binary.BigEndian.AppendUint16(append(make([]byte, 0, 18), packet.DstIP.To16()...), packet.DstPort)
+	if bytes.Compare(src, dst) > 0 {
+		src, dst = dst, src
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte{byte(packet.Protocol)})
+	hash.Write(src)
+	hash.Write(dst)
+	return hash.Sum32()
+}
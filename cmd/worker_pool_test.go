@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	. "awesomeProject/model"
+	"net"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWorkerPoolKeepsFlowsInOrder(t *testing.T) {
+	const flows, packets = 50, 100
+	var mu sync.Mutex
+	processed := map[uint16][]int{} // Sequence numbers per flow, keyed by the client port
+	pool, err := NewWorkerPool(WorkerPoolConfig{Workers: 8, QueueDepth: 4, DropPolicy: BlockWhenFull}, func(packet *Packet) {
+		client := packet.SrcPort
+		if packet.SrcPort == 80 {
+			client = packet.DstPort
+		}
+		mu.Lock()
+		processed[client] = append(processed[client], packet.Length)
+		mu.Unlock()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for sequence := 0; sequence < packets; sequence++ {
+		for flow := uint16(0); flow < flows; flow++ {
+			// the client and the server take turns, both directions belong to the flow
+			packet := &Packet{SrcIP: net.IPv4(192, 0, 2, 1), DstIP: net.IPv4(192, 0, 2, 2), SrcPort: 40000 + flow, DstPort: 80,
+				Protocol: ProtocolTCP, Length: sequence}
+			if sequence%2 == 1 {
+				packet.SrcIP, packet.DstIP, packet.SrcPort, packet.DstPort = packet.DstIP, packet.SrcIP, packet.DstPort, packet.SrcPort
+			}
+			pool.Submit(packet)
+		}
+	}
+	pool.Close()
+
+	want := make([]int, packets)
+	for i := range want {
+		want[i] = i
+	}
+	for flow := uint16(0); flow < flows; flow++ {
+		if got := processed[40000+flow]; !slices.Equal(got, want) {
+			t.Errorf("flow %d processed in the order %v", flow, got)
+		}
+	}
+}
+
+func TestWorkerPoolDropPolicies(t *testing.T) {
+	tests := []struct {
+		policy    DropPolicy
+		accepted  bool  // Whether the packet submitted to the full queue is accepted
+		processed []int // Packets processed, in order
+	}{
+		{BlockWhenFull, true, []int{0, 1, 2, 3}},
+		{DropNewest, false, []int{0, 1, 2}},
+		{DropOldest, true, []int{0, 2, 3}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.policy.String(), func(t *testing.T) {
+			started, release := make(chan struct{}, 4), make(chan struct{})
+			processed := []int{}
+			pool, err := NewWorkerPool(WorkerPoolConfig{Workers: 1, QueueDepth: 2, DropPolicy: test.policy}, func(packet *Packet) {
+				processed = append(processed, packet.Length) // a single worker appends
+				started <- struct{}{}
+				<-release
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the worker holds packet 0 while packets 1 and 2 fill its queue
+			pool.Submit(poolPacket(0))
+			<-started
+			pool.Submit(poolPacket(1))
+			pool.Submit(poolPacket(2))
+
+			accepted := make(chan bool)
+			go func() { accepted <- pool.Submit(poolPacket(3)) }()
+			if test.policy == BlockWhenFull {
+				select {
+				case <-accepted:
+					t.Fatal("packet submitted to the full queue wasn't blocked")
+				case <-time.After(20 * time.Millisecond):
+				}
+				close(release)
+				if !<-accepted {
+					t.Errorf("blocked packet was dropped")
+				}
+			} else {
+				if got := <-accepted; got != test.accepted {
+					t.Errorf("packet submitted to the full queue accepted %t, want %t", got, test.accepted)
+				}
+				close(release)
+			}
+			pool.Close()
+
+			if !slices.Equal(processed, test.processed) {
+				t.Errorf("processed packets %v, want %v", processed, test.processed)
+			}
+			if dropped := pool.Dropped(); dropped != uint64(4-len(test.processed)) {
+				t.Errorf("counted %d dropped packets, want %d", dropped, 4-len(test.processed))
+			}
+		})
+	}
+}
+
+// poolPacket returns a packet of a single flow, numbered by its length.
+func poolPacket(number int) *Packet {
+	return &Packet{SrcIP: net.IPv4(192, 0, 2, 1), DstIP: net.IPv4(192, 0, 2, 2), SrcPort: 40000, DstPort: 80,
+		Protocol: ProtocolTCP, Length: number}
+}
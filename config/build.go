@@ -0,0 +1,626 @@
+package config
+
+import (
+	"awesomeProject/aggregation"
+	"awesomeProject/alert_system"
+	"awesomeProject/cmd"
+	"awesomeProject/loggers"
+	"awesomeProject/model"
+	"awesomeProject/outputs"
+	"awesomeProject/reassembly"
+	"awesomeProject/rules"
+	"awesomeProject/utils"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+)
+
+// signatureTypes maps the incident type names used in http_vulnerability signatures to incident types.
+var signatureTypes = map[string]model.IncidentType{
+	"sql_injection":  model.SQLInjection,
+	"file_read":      model.FileRead,
+	"code_execution": model.CodeExecution,
+}
+
+// Build creates the NIDS described by the configuration, along with the RuleSet its rules were built by.
+// The caller closes the outputs, the incident log among them, through NIDS.Close once the NIDS stopped.
+func (cfg *Config) Build() (*cmd.NIDS, *RuleSet, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	poolConfig, err := cfg.Pipeline.workerPoolConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sniffers, err := cfg.openSensors()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	logFile, err := loggers.OpenRotatingFile(cfg.Logger.Path, cfg.Logger.rotationConfig())
+	if err != nil {
+		closeSniffers(sniffers)
+		return nil, nil, fmt.Errorf("error opening log file: %w", err)
+	}
+
+	clock := cfg.clock()
+	output, err := cfg.buildOutput(logFile, clock)
+	if err != nil {
+		logFile.Close()
+		closeSniffers(sniffers)
+		return nil, nil, err
+	}
+
+	ruleSet := NewRuleSet()
+	nids := cmd.NewNIDS(sniffers, ruleSet.Build(cfg.Rules), output, clock)
+	nids.PoolConfig = poolConfig
+	nids.TCPReassembly = cfg.Reassembly.reassemblerConfig()
+	nids.Defragmentation = cfg.Defragmentation.defragmenterConfig()
+	nids.Aggregation = cfg.Aggregation.aggregatorConfig()
+	if cfg.Metrics.Address != "" {
+		if err := nids.ListenMetrics(cfg.Metrics.Address); err != nil {
+			for _, rule := range nids.Rules() {
+				if stoppable, ok := rule.(rules.Stoppable); ok {
+					stoppable.Stop()
+				}
+			}
+			nids.Close()
+			closeSniffers(sniffers)
+			return nil, nil, fmt.Errorf("error serving metrics: %w", err)
+		}
+	}
+	return nids, ruleSet, nil
+}
+
+// buildOutput creates the fan-out to the incident log, the syslog receivers and the alert channels,
+// each with its own filter and queue. With routes, the alert channels are reached through a router.
+func (cfg *Config) buildOutput(logFile loggers.LogFile, clock utils.Clock) (*outputs.FanOut, error) {
+	// the incident log is the record of every incident, so it is written synchronously unless a queue is configured
+	all := []outputs.Output{cfg.Logger.output("logger", &loggers.IncidentLogger{LogFile: logFile}, 0)}
+	for i, syslog := range cfg.Syslog {
+		sinkConfig, err := syslog.sinkConfig()
+		if err != nil {
+			closeOutputs(all)
+			return nil, fmt.Errorf("error configuring syslog[%d]: %w", i, err)
+		}
+		sink, err := loggers.NewSyslogSink(sinkConfig)
+		if err != nil {
+			closeOutputs(all)
+			return nil, fmt.Errorf("error configuring syslog[%d]: %w", i, err)
+		}
+		all = append(all, syslog.output(fmt.Sprintf("syslog[%d] (%s://%s)", i, syslog.Network, syslog.Address), sink, outputs.DefaultQueueSize))
+	}
+
+	alerts := []outputs.Output{}
+	for i, channelConfig := range cfg.Alerts {
+		channel, err := channelConfig.channel()
+		if err != nil {
+			closeOutputs(append(all, alerts...))
+			return nil, fmt.Errorf("error configuring alerts[%d]: %w", i, err)
+		}
+		sink := alert_system.NewAlertSystem(channel)
+		alerts = append(alerts, channelConfig.output(fmt.Sprintf("alerts[%d] (%s)", i, channelConfig.Type), sink, outputs.DefaultQueueSize))
+	}
+	if len(cfg.Routing.Routes) == 0 {
+		return outputs.NewFanOut(append(all, alerts...)...), nil
+	}
+
+	router, err := cfg.buildRouter(alerts, clock)
+	if err != nil {
+		closeOutputs(append(all, alerts...))
+		return nil, err
+	}
+	return outputs.NewFanOut(append(all, outputs.Output{Name: "router", Sink: router})...), nil
+}
+
+// buildRouter creates the router to the alert channels. Each channel keeps its filter and queue.
+func (cfg *Config) buildRouter(alerts []outputs.Output, clock utils.Clock) (*alert_system.Router, error) {
+	location, _ := cfg.Routing.location()
+	routes := make([]alert_system.Route, len(cfg.Routing.Routes))
+	for i, routeConfig := range cfg.Routing.Routes {
+		routes[i], _ = routeConfig.route(i, location)
+	}
+	channels := map[string]outputs.Sink{}
+	for i, output := range alerts {
+		channels[cfg.Alerts[i].ChannelName()] = outputs.NewFanOut(output)
+	}
+
+	router, err := alert_system.NewRouter(routes, channels, clock)
+	if err != nil {
+		return nil, fmt.Errorf("error configuring routing: %w", err)
+	}
+	if cfg.Routing.AckAddress != "" {
+		if err := router.Listen(cfg.Routing.AckAddress); err != nil {
+			router.Close()
+			return nil, fmt.Errorf("error serving acknowledgements: %w", err)
+		}
+	}
+	return router, nil
+}
+
+// location returns the time zone of the quiet hours.
+func (settings RoutingConfig) location() (*time.Location, error) {
+	if settings.Timezone == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(settings.Timezone)
+}
+
+// route converts the settings of the route at the index. Errors start with the invalid setting.
+func (settings RouteConfig) route(index int, location *time.Location) (alert_system.Route, error) {
+	route := alert_system.Route{
+		Name:       settings.RouteName(index),
+		Channels:   settings.Channels,
+		RateLimit:  settings.RateLimit,
+		RateWindow: time.Duration(settings.RateWindow),
+		Continue:   settings.Continue,
+	}
+	route.Match.Rules = settings.Rules
+	for _, name := range settings.Types {
+		incidentType, err := model.ParseIncidentType(name)
+		if err != nil {
+			return route, fmt.Errorf("types: %w", err)
+		}
+		route.Match.Types = append(route.Match.Types, incidentType)
+	}
+	if settings.MinSeverity != "" {
+		if err := route.Match.MinSeverity.UnmarshalText([]byte(settings.MinSeverity)); err != nil {
+			return route, fmt.Errorf("min_severity: %w", err)
+		}
+	}
+	for _, subnet := range settings.Subnets {
+		prefix, err := netip.ParsePrefix(subnet)
+		if err != nil {
+			return route, fmt.Errorf("subnets: %w", err)
+		}
+		route.Match.Subnets = append(route.Match.Subnets, prefix.Masked())
+	}
+	for i, quiet := range settings.QuietHours {
+		quietHours, err := quiet.quietHours(location)
+		if err != nil {
+			return route, fmt.Errorf("quiet_hours[%d].%w", i, err)
+		}
+		route.QuietHours = append(route.QuietHours, quietHours)
+	}
+	if settings.EscalateAfter > 0 {
+		route.Escalation = &alert_system.Escalation{After: time.Duration(settings.EscalateAfter), Channels: settings.EscalateTo}
+	}
+	return route, nil
+}
+
+// weekdays maps the abbreviated weekday names used in quiet hours to weekdays.
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// quietHours converts the quiet hours settings. Errors start with the invalid setting.
+func (settings QuietHoursConfig) quietHours(location *time.Location) (alert_system.QuietHours, error) {
+	quiet := alert_system.QuietHours{Location: location}
+	for _, bound := range []struct {
+		field string
+		text  string
+		value *time.Duration
+	}{
+		{"start", settings.Start, &quiet.Start},
+		{"end", settings.End, &quiet.End},
+	} {
+		clock, err := time.Parse("15:04", bound.text)
+		if err != nil {
+			return quiet, fmt.Errorf("%s: expected hh:mm, got %q", bound.field, bound.text)
+		}
+		*bound.value = time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute
+	}
+	for _, name := range settings.Weekdays {
+		weekday, ok := weekdays[strings.ToLower(name)]
+		if !ok {
+			return quiet, fmt.Errorf("weekdays: unknown weekday %q (expected mon, tue, wed, thu, fri, sat or sun)", name)
+		}
+		quiet.Weekdays = append(quiet.Weekdays, weekday)
+	}
+	return quiet, nil
+}
+
+// closeOutputs closes the sinks created before building the output failed, except the incident log.
+func closeOutputs(built []outputs.Output) {
+	for _, output := range built[1:] {
+		if closer, ok := output.Sink.(io.Closer); ok {
+			closer.Close()
+		}
+	}
+}
+
+// channel creates the alert channel of a validated configuration.
+func (settings ChannelConfig) channel() (alert_system.Channel, error) {
+	switch settings.Type {
+	case WebhookChannelType:
+		config, err := settings.webhookConfig()
+		if err != nil {
+			return nil, err
+		}
+		return alert_system.NewWebhookChannel(config)
+	case EmailChannelType:
+		config, err := settings.emailConfig()
+		if err != nil {
+			return nil, err
+		}
+		return alert_system.NewEmailChannel(config)
+	default:
+		return &alert_system.StdoutChannel{}, nil
+	}
+}
+
+// emailConfig converts the email settings, filling in defaults for unset values.
+func (settings ChannelConfig) emailConfig() (alert_system.EmailConfig, error) {
+	config := alert_system.DefaultEmailConfig(settings.SMTPHost, settings.From, settings.To...)
+	config.Username, config.Password = settings.Username, settings.Password
+	var err error
+	if settings.SMTPPort > 0 {
+		config.Port = settings.SMTPPort
+	}
+	if settings.Security != "" {
+		if config.Security, err = alert_system.ParseEmailSecurity(settings.Security); err != nil {
+			return config, err
+		}
+	}
+	if settings.ImmediateSeverity != "" {
+		if err = config.ImmediateSeverity.UnmarshalText([]byte(settings.ImmediateSeverity)); err != nil {
+			return config, err
+		}
+	}
+	if settings.DigestInterval > 0 {
+		config.DigestInterval = time.Duration(settings.DigestInterval)
+	}
+	if settings.MaxGroups > 0 {
+		config.MaxGroups = settings.MaxGroups
+	}
+	if settings.SubjectPrefix != "" {
+		config.SubjectPrefix = settings.SubjectPrefix
+	}
+	if settings.Timeout > 0 {
+		config.Timeout = time.Duration(settings.Timeout)
+	}
+	return config, config.Validate()
+}
+
+// webhookConfig converts the webhook settings, filling in defaults for unset values and parsing the template.
+func (settings ChannelConfig) webhookConfig() (alert_system.WebhookConfig, error) {
+	config := alert_system.DefaultWebhookConfig(settings.URL)
+	config.Headers = settings.Headers
+	config.Username, config.Password, config.BearerToken = settings.Username, settings.Password, settings.BearerToken
+	config.QueueDir = settings.QueueDir
+	if settings.Method != "" {
+		config.Method = strings.ToUpper(settings.Method)
+	}
+	if settings.ContentType != "" {
+		config.ContentType = settings.ContentType
+	}
+	if settings.Timeout > 0 {
+		config.Timeout = time.Duration(settings.Timeout)
+	}
+	if settings.MaxRetries != nil {
+		config.MaxRetries = *settings.MaxRetries
+	}
+	if settings.MinBackoff > 0 {
+		config.MinBackoff = time.Duration(settings.MinBackoff)
+	}
+	if settings.MaxBackoff > 0 {
+		config.MaxBackoff = time.Duration(settings.MaxBackoff)
+	}
+	if settings.MaxQueued > 0 {
+		config.MaxQueued = settings.MaxQueued
+	}
+
+	text := settings.Template
+	if settings.TemplateFile != "" {
+		content, err := os.ReadFile(settings.TemplateFile)
+		if err != nil {
+			return config, fmt.Errorf("error reading template: %w", err)
+		}
+		text = string(content)
+	}
+	if text != "" {
+		var err error
+		if config.Template, err = alert_system.ParseWebhookTemplate(text); err != nil {
+			return config, err
+		}
+	}
+	return config, config.Validate()
+}
+
+// sinkConfig converts the syslog settings, loading the CA certificates for tls.
+func (settings SyslogConfig) sinkConfig() (loggers.SyslogConfig, error) {
+	config := loggers.DefaultSyslogConfig(settings.Network, settings.Address)
+	var err error
+	if settings.Format != "" {
+		if config.Format, err = loggers.ParseSyslogFormat(settings.Format); err != nil {
+			return config, err
+		}
+	}
+	if settings.Facility != "" {
+		if config.Facility, err = loggers.ParseSyslogFacility(settings.Facility); err != nil {
+			return config, err
+		}
+	}
+	if settings.AppName != "" {
+		config.AppName = settings.AppName
+	}
+	if settings.CACert != "" {
+		if settings.Network != "tls" {
+			return config, errors.New("ca_cert only applies to the tls network")
+		}
+		pem, err := os.ReadFile(settings.CACert)
+		if err != nil {
+			return config, fmt.Errorf("error reading CA certificates: %w", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return config, fmt.Errorf("no certificates found in %s", settings.CACert)
+		}
+		config.TLS = &tls.Config{RootCAs: roots}
+	}
+	return config, config.Validate()
+}
+
+// rotationConfig converts the rotation settings of the incident log.
+func (settings LoggerConfig) rotationConfig() loggers.RotationConfig {
+	return loggers.RotationConfig{
+		MaxSize:      int64(settings.MaxSizeMB) << 20,
+		Interval:     time.Duration(settings.RotateEvery),
+		Compress:     settings.Compress,
+		MaxBackups:   settings.MaxBackups,
+		MaxBackupAge: time.Duration(settings.MaxBackupAge),
+	}
+}
+
+// output creates the output of a validated configuration, with the default queue size if none is set.
+// A queue size of 0 writes the sink synchronously.
+func (settings OutputConfig) output(name string, sink outputs.Sink, defaultQueueSize int) outputs.Output {
+	filter, _ := settings.filter()
+	queueSize := defaultQueueSize
+	if settings.QueueSize > 0 {
+		queueSize = settings.QueueSize
+	}
+	return outputs.Output{Name: name, Sink: sink, Filter: filter, QueueSize: queueSize}
+}
+
+// filter converts the severity and type names of the output to a filter.
+func (settings OutputConfig) filter() (outputs.Filter, error) {
+	filter := outputs.Filter{}
+	if settings.MinSeverity != "" {
+		if err := filter.MinSeverity.UnmarshalText([]byte(settings.MinSeverity)); err != nil {
+			return filter, fmt.Errorf("min_severity: %w (expected info, low, medium, high or critical)", err)
+		}
+	}
+	for _, name := range settings.Types {
+		incidentType, err := model.ParseIncidentType(name)
+		if err != nil {
+			return filter, fmt.Errorf("types: %w", err)
+		}
+		filter.Types = append(filter.Types, incidentType)
+	}
+	return filter, nil
+}
+
+// Build creates the rule described by a validated RuleConfig, named after the configured name.
+func (rule RuleConfig) Build() rules.Rule {
+	window := time.Duration(rule.Window)
+
+	var built rules.Rule
+	switch rule.Type {
+	case PortScanningRuleType:
+		built = rules.NewPortScanningRuleWithIPv6Prefix(rule.Threshold, window, rule.ipv6PrefixLength())
+	case DDoSRuleType:
+		built = rules.NewDDoSRuleWithIPv6Prefix(rule.Threshold, window, rule.ipv6PrefixLength())
+	case LargeVolumeRuleType:
+		built = rules.NewLargeVolumeRule(rule.Threshold, window)
+	default:
+		built = rules.NewHttpVulnerabilityRuleWithSignatures(rule.httpSignatures())
+	}
+	built.(rules.Named).SetName(rule.RuleName())
+	return built
+}
+
+// ipv6PrefixLength returns the configured IPv6 aggregation prefix, /64 when unset.
+func (rule RuleConfig) ipv6PrefixLength() int {
+	if rule.IPv6Prefix > 0 {
+		return rule.IPv6Prefix
+	}
+	return model.DefaultIPv6PrefixLength
+}
+
+// httpSignatures returns the configured signatures, falling back to the defaults for unconfigured types.
+func (rule RuleConfig) httpSignatures() map[model.IncidentType][]string {
+	signatures := rules.DefaultHttpSignatures()
+	for name, patterns := range rule.Signatures {
+		signatures[signatureTypes[name]] = patterns
+	}
+	return signatures
+}
+
+// openSensors opens the packet source of every sensor, closing the opened ones if one fails.
+func (cfg *Config) openSensors() ([]*cmd.PacketSniffer, error) {
+	sniffers := []*cmd.PacketSniffer{}
+	for i, sensor := range cfg.Sensors {
+		sniffer, err := sensor.open()
+		if err != nil {
+			closeSniffers(sniffers)
+			return nil, fmt.Errorf("sensors[%d]: %w", i, err)
+		}
+		sniffers = append(sniffers, sniffer)
+	}
+	return sniffers, nil
+}
+
+// closeSniffers releases the given sniffers.
+func closeSniffers(sniffers []*cmd.PacketSniffer) {
+	for _, sniffer := range sniffers {
+		sniffer.Close()
+	}
+}
+
+// clock returns the clock the packets of the sensors should be evaluated on.
+// Saved captures are evaluated on the time of their packets rather than the wall clock.
+func (cfg *Config) clock() utils.Clock {
+	if cfg.Sensors[0].File != "" {
+		return utils.NewEventClock()
+	}
+	return utils.NewWallClock()
+}
+
+// open opens the packet source of the sensor.
+func (sensor SensorConfig) open() (*cmd.PacketSniffer, error) {
+	if sensor.Device != "" {
+		return cmd.NewPacketSnifferWithOptions(sensor.Device, sensor.captureOptions())
+	}
+
+	sniffer, err := cmd.NewPacketSnifferFromFile(sensor.File)
+	if err != nil {
+		return nil, err
+	}
+	if sensor.Filter != "" {
+		if err := sniffer.SetFilter(sensor.Filter); err != nil {
+			sniffer.Close()
+			return nil, err
+		}
+	}
+	return sniffer, nil
+}
+
+// captureOptions converts the live capture settings, filling in defaults for unset values.
+func (sensor SensorConfig) captureOptions() cmd.CaptureOptions {
+	options := cmd.DefaultCaptureOptions()
+	options.Filter = sensor.Filter
+	if sensor.SnapLen > 0 {
+		options.SnapLen = sensor.SnapLen
+	}
+	if sensor.Promiscuous != nil {
+		options.Promiscuous = *sensor.Promiscuous
+	}
+	return options
+}
+
+// workerPoolConfig converts the pipeline settings, filling in defaults for unset values.
+func (pipeline PipelineConfig) workerPoolConfig() (cmd.WorkerPoolConfig, error) {
+	poolConfig := cmd.DefaultWorkerPoolConfig()
+	if pipeline.Workers > 0 {
+		poolConfig.Workers = pipeline.Workers
+	}
+	if pipeline.QueueDepth > 0 {
+		poolConfig.QueueDepth = pipeline.QueueDepth
+	}
+	if pipeline.DropPolicy != "" {
+		policy, err := cmd.ParseDropPolicy(pipeline.DropPolicy)
+		if err != nil {
+			return poolConfig, err
+		}
+		poolConfig.DropPolicy = policy
+	}
+	return poolConfig, nil
+}
+
+// reassemblerConfig converts the reassembly settings, filling in defaults for unset values.
+// It returns nil if the reassembly is disabled.
+func (settings ReassemblyConfig) reassemblerConfig() *reassembly.TCPReassemblerConfig {
+	if settings.Enabled != nil && !*settings.Enabled {
+		return nil
+	}
+
+	config := reassembly.DefaultTCPReassemblerConfig()
+	if settings.MaxConnections > 0 {
+		config.MaxConnections = settings.MaxConnections
+	}
+	if settings.MaxBufferedBytesPerStream > 0 {
+		config.MaxBufferedBytesPerStream = settings.MaxBufferedBytesPerStream
+	}
+	if settings.MaxBufferedBytesTotal > 0 {
+		config.MaxBufferedBytesTotal = settings.MaxBufferedBytesTotal
+	}
+	if settings.HalfOpenTimeout > 0 {
+		config.HalfOpenTimeout = time.Duration(settings.HalfOpenTimeout)
+	}
+	if settings.IdleTimeout > 0 {
+		config.IdleTimeout = time.Duration(settings.IdleTimeout)
+	}
+	return &config
+}
+
+// defragmenterConfig converts the defragmentation settings, filling in defaults for unset values.
+// It returns nil if the defragmentation is disabled.
+func (settings DefragmentationConfig) defragmenterConfig() *reassembly.IPDefragmenterConfig {
+	if settings.Enabled != nil && !*settings.Enabled {
+		return nil
+	}
+
+	config := reassembly.DefaultIPDefragmenterConfig()
+	if settings.MaxDatagrams > 0 {
+		config.MaxDatagrams = settings.MaxDatagrams
+	}
+	if settings.MaxFragments > 0 {
+		config.MaxFragments = settings.MaxFragments
+	}
+	if settings.Timeout > 0 {
+		config.Timeout = time.Duration(settings.Timeout)
+	}
+	if settings.MinFragmentSize > 0 {
+		config.MinFragmentSize = settings.MinFragmentSize
+	}
+	if settings.FloodThreshold > 0 {
+		config.FloodThreshold = settings.FloodThreshold
+	}
+	if settings.FloodWindow > 0 {
+		config.FloodWindow = time.Duration(settings.FloodWindow)
+	}
+	return &config
+}
+
+// aggregatorConfig converts the aggregation settings, filling in defaults for unset values.
+// It returns nil if the aggregation is disabled.
+func (settings AggregationConfig) aggregatorConfig() *aggregation.AggregatorConfig {
+	if settings.Enabled != nil && !*settings.Enabled {
+		return nil
+	}
+
+	config := aggregation.DefaultAggregatorConfig()
+	if settings.QuietPeriod > 0 {
+		config.QuietPeriod = time.Duration(settings.QuietPeriod)
+	}
+	if settings.MaxAge > 0 {
+		config.MaxAge = time.Duration(settings.MaxAge)
+	} else if config.MaxAge < config.QuietPeriod {
+		config.MaxAge = config.QuietPeriod // a long quiet period alone doesn't conflict with the default max age
+	}
+	if settings.MaxSamples > 0 {
+		config.MaxSamples = settings.MaxSamples
+	}
+	if settings.MaxAggregates > 0 {
+		config.MaxAggregates = settings.MaxAggregates
+	}
+	return &config
+}
+
+// Coverage returns the ATT&CK coverage matrix of the enabled rules and the defragmentation.
+func (cfg *Config) Coverage() *rules.CoverageMatrix {
+	built := NewRuleSet().Build(cfg.Rules)
+	matrix := rules.NewCoverageMatrix()
+	matrix.AddRules(built)
+	if cfg.Defragmentation.defragmenterConfig() != nil {
+		matrix.Add(reassembly.DefragmenterRuleName, reassembly.DefragmenterTechniques())
+	}
+
+	// the rules were only built to be inspected
+	for _, rule := range built {
+		if stoppable, ok := rule.(rules.Stoppable); ok {
+			stoppable.Stop()
+		}
+	}
+	return matrix
+}
@@ -0,0 +1,711 @@
+package config
+
+import (
+	"awesomeProject/cmd"
+	"awesomeProject/model"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Config is the declarative description of a NIDS deployment, loaded from a JSON file.
+// Packets of all sensors are merged into a single stream tagged with their ingress interface.
+//
+// Example:
+//
+//	{
+//	  "sensors":  [
+//	    {"device": "en0", "filter": "not port 22", "snaplen": 1600, "promiscuous": true},
+//	    {"device": "en1"}
+//	  ],
+//	  "pipeline": {"workers": 4, "queue_depth": 1000, "drop_policy": "block"},
+//	  "reassembly": {"max_connections": 100000, "half_open_timeout": "30s", "idle_timeout": "5m"},
+//	  "defragmentation": {"timeout": "30s", "min_fragment_size": 256, "flood_threshold": 1000, "flood_window": "10s"},
+//	  "aggregation": {"quiet_period": "30s", "max_age": "5m", "max_samples": 5},
+//	  "rules": [
+//	    {"type": "port_scanning", "threshold": 10, "window": "30s"},
+//	    {"type": "ddos", "threshold": 15, "window": "30s", "ipv6_prefix": 64},
+//	    {"type": "large_volume", "threshold": 10, "window": "30s"},
+//	    {"type": "http_vulnerability", "signatures": {"sql_injection": ["' OR '1'='1'"]}}
+//	  ],
+//	  "logger": {"path": "incidents.log", "max_size_mb": 100, "compress": true, "max_backups": 10},
+//	  "syslog": [{"network": "tls", "address": "siem.example.com:6514", "format": "cef", "min_severity": "medium"}],
+//	  "alerts": [
+//	    {"type": "stdout", "min_severity": "high", "types": ["ddos_attack", "sql_injection"]},
+//	    {"type": "webhook", "url": "https://hooks.slack.com/services/T000/B000/XXX", "template": "{\"text\": {{json (alert .)}}}", "queue_dir": "alerts"},
+//	    {"type": "email", "smtp_host": "smtp.example.com", "username": "nids", "password": "secret",
+//	     "from": "nids@example.com", "to": ["soc@example.com"], "digest_interval": "1h", "min_severity": "medium"}
+//	  ],
+//	  "routing": {"timezone": "Europe/Berlin", "ack_address": "127.0.0.1:8081", "routes": [
+//	    {"name": "dmz", "subnets": ["192.0.2.0/24"], "min_severity": "high", "channels": ["webhook"],
+//	     "escalate_after": "15m", "escalate_to": ["email"]},
+//	    {"name": "rest", "channels": ["email"], "rate_limit": 10, "rate_window": "1m",
+//	     "quiet_hours": [{"start": "22:00", "end": "07:00"}]}
+//	  ]},
+//	  "metrics": {"address": "127.0.0.1:9100"}
+//	}
+type Config struct {
+	Sensors         []SensorConfig        `json:"sensors"`
+	Pipeline        PipelineConfig        `json:"pipeline"`
+	Reassembly      ReassemblyConfig      `json:"reassembly"`
+	Defragmentation DefragmentationConfig `json:"defragmentation"`
+	Aggregation     AggregationConfig     `json:"aggregation"`
+	Rules           []RuleConfig          `json:"rules"`
+	Logger          LoggerConfig          `json:"logger"`
+	Syslog          []SyslogConfig        `json:"syslog"`
+	Alerts          []ChannelConfig       `json:"alerts"`
+	Routing         RoutingConfig         `json:"routing"`
+	Metrics         MetricsConfig         `json:"metrics"`
+}
+
+// SensorConfig describes a packet source: a live interface or a saved capture file.
+type SensorConfig struct {
+	Device      string `json:"device,omitempty"`      // Network interface to capture from
+	File        string `json:"file,omitempty"`        // .pcap/.pcapng file to replay instead of a live interface, the only sensor
+	Filter      string `json:"filter,omitempty"`      // BPF filter expression applied to the capture
+	SnapLen     int    `json:"snaplen,omitempty"`     // Live interfaces: bytes captured per packet, defaults to 1600
+	Promiscuous *bool  `json:"promiscuous,omitempty"` // Live interfaces: capture all traffic on the wire, defaults to true
+}
+
+// PipelineConfig sizes the packet processing workers.
+type PipelineConfig struct {
+	Workers    int    `json:"workers,omitempty"`     // Number of workers, defaults to the number of CPUs
+	QueueDepth int    `json:"queue_depth,omitempty"` // Packets queued per worker, defaults to 1000
+	DropPolicy string `json:"drop_policy,omitempty"` // block, drop-newest or drop-oldest, defaults to block
+}
+
+// ReassemblyConfig bounds the TCP stream reassembly feeding the http_vulnerability rules.
+// Unset limits fall back to their defaults.
+type ReassemblyConfig struct {
+	Enabled                   *bool    `json:"enabled,omitempty"`                       // Defaults to true
+	MaxConnections            int      `json:"max_connections,omitempty"`               // Connections tracked at once, defaults to 100000
+	MaxBufferedBytesPerStream int      `json:"max_buffered_bytes_per_stream,omitempty"` // Out-of-order bytes per direction, defaults to 256 KiB
+	MaxBufferedBytesTotal     int      `json:"max_buffered_bytes_total,omitempty"`      // Out-of-order bytes overall, defaults to 64 MiB
+	HalfOpenTimeout           Duration `json:"half_open_timeout,omitempty"`             // Unanswered SYNs, defaults to 30s
+	IdleTimeout               Duration `json:"idle_timeout,omitempty"`                  // Defaults to 5m
+}
+
+// DefragmentationConfig bounds the IP defragmentation and sets the limits of the fragment incidents.
+// Unset limits fall back to their defaults. When disabled, IP fragments are dropped.
+type DefragmentationConfig struct {
+	Enabled         *bool    `json:"enabled,omitempty"`           // Defaults to true
+	MaxDatagrams    int      `json:"max_datagrams,omitempty"`     // Datagrams reassembled at once, defaults to 10000
+	MaxFragments    int      `json:"max_fragments,omitempty"`     // Fragments per datagram, defaults to 64
+	Timeout         Duration `json:"timeout,omitempty"`           // Incomplete datagrams are discarded after it, defaults to 30s
+	MinFragmentSize int      `json:"min_fragment_size,omitempty"` // Smaller fragments (but the last) are tiny, defaults to 256
+	FloodThreshold  int      `json:"flood_threshold,omitempty"`   // Fragments per source within the flood window, defaults to 1000
+	FloodWindow     Duration `json:"flood_window,omitempty"`      // Defaults to 10s
+}
+
+// AggregationConfig sets how repeated incidents of a rule are merged before they are logged and alerted about.
+// Unset values fall back to their defaults. When disabled, every incident is reported on its own.
+type AggregationConfig struct {
+	Enabled       *bool    `json:"enabled,omitempty"`        // Defaults to true
+	QuietPeriod   Duration `json:"quiet_period,omitempty"`   // Merged incidents are reported once quiet for this long, defaults to 30s
+	MaxAge        Duration `json:"max_age,omitempty"`        // Ongoing merged incidents are reported after this long, defaults to 5m
+	MaxSamples    int      `json:"max_samples,omitempty"`    // Sample packets kept per merged incident, defaults to 5
+	MaxAggregates int      `json:"max_aggregates,omitempty"` // Merged incidents held at once, defaults to 10000
+}
+
+// RuleConfig enables a detection rule and holds its parameters.
+// Only the parameters relevant to the rule type are allowed.
+type RuleConfig struct {
+	Name       string              `json:"name,omitempty"`        // Identifies the rule, defaults to its type
+	Type       string              `json:"type"`                  // port_scanning, ddos, large_volume or http_vulnerability
+	Enabled    *bool               `json:"enabled,omitempty"`     // Defaults to true
+	Threshold  int                 `json:"threshold,omitempty"`   // Windowed rules: count (or bytes) allowed within the window
+	Window     Duration            `json:"window,omitempty"`      // Windowed rules: length of the sliding window
+	IPv6Prefix int                 `json:"ipv6_prefix,omitempty"` // port_scanning and ddos: IPv6 sources are counted per prefix of this length, defaults to 64
+	Signatures map[string][]string `json:"signatures,omitempty"`  // http_vulnerability: patterns per incident type
+}
+
+// OutputConfig selects the incidents an output receives and sets how many are buffered for it.
+// It is part of the logger and alert channel configurations.
+type OutputConfig struct {
+	MinSeverity string   `json:"min_severity,omitempty"` // info, low, medium, high or critical, defaults to info
+	Types       []string `json:"types,omitempty"`        // Incident types received, e.g. "port_scanning", defaults to all
+	QueueSize   int      `json:"queue_size,omitempty"`   // Incidents buffered for the output, defaults to 1000, or to 0 (synchronous) for the logger
+}
+
+// LoggerConfig describes where incidents are logged and how the log file is rotated.
+// Incidents are logged synchronously, so none is dropped, unless queue_size is set.
+// Unset rotation limits are disabled, so the file is only rotated externally (e.g. by logrotate, followed by SIGHUP).
+type LoggerConfig struct {
+	Path         string   `json:"path"`                     // File the incidents are appended to as JSON lines
+	MaxSizeMB    int      `json:"max_size_mb,omitempty"`    // The file is rotated before it grows beyond this many MiB
+	RotateEvery  Duration `json:"rotate_every,omitempty"`   // The file is rotated once it was written to for this long
+	Compress     bool     `json:"compress,omitempty"`       // Rotated files are compressed with gzip
+	MaxBackups   int      `json:"max_backups,omitempty"`    // Rotated files kept, the oldest are deleted
+	MaxBackupAge Duration `json:"max_backup_age,omitempty"` // Rotated files older than this are deleted
+	OutputConfig
+}
+
+// SyslogConfig describes a syslog receiver, e.g. of a SIEM, incidents are sent to.
+type SyslogConfig struct {
+	Network  string `json:"network"`            // udp, tcp, tls or unix
+	Address  string `json:"address"`            // host:port of the receiver, or the socket path for unix
+	Format   string `json:"format,omitempty"`   // rfc5424 or cef, defaults to rfc5424
+	Facility string `json:"facility,omitempty"` // e.g. "auth" or "local3", defaults to local0
+	AppName  string `json:"app_name,omitempty"` // Defaults to nids
+	CACert   string `json:"ca_cert,omitempty"`  // tls: PEM file of the CAs the receiver is verified against, defaults to the system roots
+	OutputConfig
+}
+
+// ChannelConfig describes an alert channel. Only the parameters relevant to the channel type are allowed.
+type ChannelConfig struct {
+	Name              string            `json:"name,omitempty"`               // Identifies the channel in routes, defaults to its type
+	Type              string            `json:"type"`                         // stdout, webhook or email
+	URL               string            `json:"url,omitempty"`                // webhook: endpoint the alerts are posted to
+	Method            string            `json:"method,omitempty"`             // webhook: HTTP method, defaults to POST
+	Headers           map[string]string `json:"headers,omitempty"`            // webhook: headers sent with every request
+	Username          string            `json:"username,omitempty"`           // webhook: basic authentication, email: SMTP authentication
+	Password          string            `json:"password,omitempty"`           // webhook: basic authentication, email: SMTP authentication
+	BearerToken       string            `json:"bearer_token,omitempty"`       // webhook: bearer token authentication
+	Template          string            `json:"template,omitempty"`           // webhook: text/template of the body, defaults to the incident as JSON
+	TemplateFile      string            `json:"template_file,omitempty"`      // webhook: file holding the template instead
+	ContentType       string            `json:"content_type,omitempty"`       // webhook: defaults to application/json
+	Timeout           Duration          `json:"timeout,omitempty"`            // webhook: limit for a request, defaults to 10s, email: for an email, defaults to 30s
+	MaxRetries        *int              `json:"max_retries,omitempty"`        // webhook: retries without queue, defaults to 5
+	MinBackoff        Duration          `json:"min_backoff,omitempty"`        // webhook: wait before the first retry, defaults to 1s
+	MaxBackoff        Duration          `json:"max_backoff,omitempty"`        // webhook: longest wait between retries, defaults to 5m
+	QueueDir          string            `json:"queue_dir,omitempty"`          // webhook: directory alerts are stored in until delivered
+	MaxQueued         int               `json:"max_queued,omitempty"`         // webhook: alerts stored at most, defaults to 10000
+	SMTPHost          string            `json:"smtp_host,omitempty"`          // email: server the emails are sent through
+	SMTPPort          int               `json:"smtp_port,omitempty"`          // email: defaults to 587
+	Security          string            `json:"security,omitempty"`           // email: starttls, tls or none, defaults to starttls, none allows no username but on localhost
+	From              string            `json:"from,omitempty"`               // email: sender address
+	To                []string          `json:"to,omitempty"`                 // email: recipient addresses
+	ImmediateSeverity string            `json:"immediate_severity,omitempty"` // email: incidents sent right away rather than in the digest, defaults to critical
+	DigestInterval    Duration          `json:"digest_interval,omitempty"`    // email: defaults to 15m
+	MaxGroups         int               `json:"max_groups,omitempty"`         // email: groups listed in a digest, defaults to 1000
+	SubjectPrefix     string            `json:"subject_prefix,omitempty"`     // email: defaults to [NIDS]
+	OutputConfig
+}
+
+// RoutingConfig routes the incidents to the alert channels by their type, severity, addresses and rule.
+// Without routes, every channel receives the incidents passing its own filter.
+type RoutingConfig struct {
+	Routes     []RouteConfig `json:"routes,omitempty"`      // Offered each incident in order
+	Timezone   string        `json:"timezone,omitempty"`    // Time zone of the quiet hours, e.g. "Europe/Berlin", defaults to the local one
+	AckAddress string        `json:"ack_address,omitempty"` // Address episodes are listed and acknowledged on over HTTP, e.g. "127.0.0.1:8081"
+}
+
+// MetricsConfig exposes the health of the capture pipeline and the rules to Prometheus.
+type MetricsConfig struct {
+	Address string `json:"address,omitempty"` // Address /metrics is served on over HTTP, e.g. "127.0.0.1:9100", disabled if unset
+}
+
+// RouteConfig selects incidents and the channels they are sent to. Empty criteria match every incident.
+type RouteConfig struct {
+	Name          string             `json:"name,omitempty"`           // Identifies the route, defaults to route<index>
+	Types         []string           `json:"types,omitempty"`          // Incident types matched, e.g. "port_scanning"
+	MinSeverity   string             `json:"min_severity,omitempty"`   // Incidents of a lower severity aren't matched
+	Subnets       []string           `json:"subnets,omitempty"`        // Incidents from or to these subnets, e.g. "10.0.0.0/8"
+	Rules         []string           `json:"rules,omitempty"`          // Names of the rules whose incidents are matched
+	Channels      []string           `json:"channels"`                 // Names of the alert channels
+	RateLimit     int                `json:"rate_limit,omitempty"`     // Alerts per rate window at most, further ones are suppressed, unlimited if unset
+	RateWindow    Duration           `json:"rate_window,omitempty"`    // Defaults to 1m
+	QuietHours    []QuietHoursConfig `json:"quiet_hours,omitempty"`    // Periods alerts are suppressed in rather than delayed, escalations are still sent
+	EscalateAfter Duration           `json:"escalate_after,omitempty"` // Unacknowledged incidents of a type firing this long escalate
+	EscalateTo    []string           `json:"escalate_to,omitempty"`    // Names of the channels escalations are sent to
+	Continue      bool               `json:"continue,omitempty"`       // Matched incidents are offered to the following routes too
+}
+
+// QuietHoursConfig is a daily period, e.g. {"start": "22:00", "end": "07:00", "weekdays": ["sat", "sun"]}.
+type QuietHoursConfig struct {
+	Start    string   `json:"start"`              // hh:mm
+	End      string   `json:"end"`                // hh:mm, the next day if before the start
+	Weekdays []string `json:"weekdays,omitempty"` // Days the period starts on (mon, tue, ...), every day if empty
+}
+
+// Channel types accepted in ChannelConfig.Type.
+const (
+	StdoutChannelType  = "stdout"
+	WebhookChannelType = "webhook"
+	EmailChannelType   = "email"
+)
+
+// Rule types accepted in RuleConfig.Type.
+const (
+	PortScanningRuleType      = "port_scanning"
+	DDoSRuleType              = "ddos"
+	LargeVolumeRuleType       = "large_volume"
+	HttpVulnerabilityRuleType = "http_vulnerability"
+)
+
+// Duration is a time.Duration written in JSON as a string such as "30s" or "5m".
+type Duration time.Duration
+
+// UnmarshalJSON parses a duration string.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return fmt.Errorf("duration must be a string such as \"30s\": %w", err)
+	}
+	duration, err := time.ParseDuration(text)
+	if err != nil {
+		return err
+	}
+	*d = Duration(duration)
+	return nil
+}
+
+// MarshalJSON writes the duration as a string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Default returns the configuration the NIDS runs with when no file is given.
+func Default() *Config {
+	return &Config{
+		Sensors: []SensorConfig{{Device: "en0"}},
+		Rules: []RuleConfig{
+			{Type: PortScanningRuleType, Threshold: 10, Window: Duration(30 * time.Second)},
+			{Type: DDoSRuleType, Threshold: 15, Window: Duration(30 * time.Second)},
+			{Type: LargeVolumeRuleType, Threshold: 10, Window: Duration(30 * time.Second)},
+			{Type: HttpVulnerabilityRuleType},
+		},
+		Logger: LoggerConfig{Path: "incidents.log"},
+		Alerts: []ChannelConfig{{Type: "stdout"}},
+	}
+}
+
+// Load reads and validates the configuration file at path.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %w", err)
+	}
+	return Parse(data)
+}
+
+// Parse decodes and validates a JSON configuration. Unknown fields are rejected.
+func Parse(data []byte) (*Config, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	cfg := &Config{}
+	if err := decoder.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("error parsing config: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate checks the whole configuration and reports every invalid setting.
+func (cfg *Config) Validate() error {
+	var errs []error
+	invalid := func(field string, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", field, fmt.Sprintf(format, args...)))
+	}
+
+	// sensors
+	if len(cfg.Sensors) == 0 {
+		invalid("sensors", "at least one sensor is required")
+	}
+	sources := map[string]bool{}
+	for i, sensor := range cfg.Sensors {
+		field := fmt.Sprintf("sensors[%d]", i)
+		if sources[sensor.Device+sensor.File] {
+			invalid(field, "%s is captured by more than one sensor", sensor.Device+sensor.File)
+		}
+		sources[sensor.Device+sensor.File] = true
+		if (sensor.File != "" && cfg.Sensors[0].Device != "") || (sensor.Device != "" && cfg.Sensors[0].File != "") {
+			invalid(field, "live devices and capture files cannot be mixed")
+		}
+		// the event clock only moves forward, packets of a second capture would be evaluated on the time of the first
+		if sensor.File != "" && i > 0 && cfg.Sensors[0].File != "" {
+			invalid(field, "only one capture file can be replayed at a time")
+		}
+		if (sensor.Device == "") == (sensor.File == "") {
+			invalid(field, "exactly one of device or file must be set")
+		}
+		if sensor.File != "" && (sensor.SnapLen != 0 || sensor.Promiscuous != nil) {
+			invalid(field, "snaplen and promiscuous only apply to live devices")
+		}
+		if sensor.SnapLen < 0 || sensor.SnapLen > cmd.MaxSnapLen {
+			invalid(field+".snaplen", "must be between 1 and %d, got %d", cmd.MaxSnapLen, sensor.SnapLen)
+		}
+		// filters of live devices are compiled for the link type of the interface once it is opened
+		if sensor.Filter != "" && sensor.File != "" {
+			if linkType, err := cmd.CaptureFileLinkType(sensor.File); err != nil {
+				invalid(field+".file", "%v", err)
+			} else if err := cmd.ValidateFilter(sensor.Filter, linkType); err != nil {
+				invalid(field+".filter", "%v", err)
+			}
+		}
+	}
+
+	// pipeline
+	if cfg.Pipeline.Workers < 0 {
+		invalid("pipeline.workers", "must not be negative, got %d", cfg.Pipeline.Workers)
+	}
+	if cfg.Pipeline.QueueDepth < 0 {
+		invalid("pipeline.queue_depth", "must not be negative, got %d", cfg.Pipeline.QueueDepth)
+	}
+	switch cfg.Pipeline.DropPolicy {
+	case "", "block", "drop-newest", "drop-oldest":
+	default:
+		invalid("pipeline.drop_policy", "unknown policy %q (expected block, drop-newest or drop-oldest)", cfg.Pipeline.DropPolicy)
+	}
+
+	// reassembly, the limits are only checked together once each of them is valid on its own
+	reassemblyErrs := len(errs)
+	if cfg.Reassembly.MaxConnections < 0 {
+		invalid("reassembly.max_connections", "must not be negative, got %d", cfg.Reassembly.MaxConnections)
+	}
+	if cfg.Reassembly.MaxBufferedBytesPerStream < 0 {
+		invalid("reassembly.max_buffered_bytes_per_stream", "must not be negative, got %d", cfg.Reassembly.MaxBufferedBytesPerStream)
+	}
+	if cfg.Reassembly.MaxBufferedBytesTotal < 0 {
+		invalid("reassembly.max_buffered_bytes_total", "must not be negative, got %d", cfg.Reassembly.MaxBufferedBytesTotal)
+	}
+	if cfg.Reassembly.HalfOpenTimeout < 0 {
+		invalid("reassembly.half_open_timeout", "must not be negative, got %s", time.Duration(cfg.Reassembly.HalfOpenTimeout))
+	}
+	if cfg.Reassembly.IdleTimeout < 0 {
+		invalid("reassembly.idle_timeout", "must not be negative, got %s", time.Duration(cfg.Reassembly.IdleTimeout))
+	}
+	if reassemblyConfig := cfg.Reassembly.reassemblerConfig(); reassemblyConfig != nil {
+		if err := reassemblyConfig.Validate(); err != nil && len(errs) == reassemblyErrs {
+			invalid("reassembly", "%v", err)
+		}
+	}
+
+	// defragmentation
+	for _, limit := range []struct {
+		field string
+		value int
+	}{
+		{"max_datagrams", cfg.Defragmentation.MaxDatagrams},
+		{"max_fragments", cfg.Defragmentation.MaxFragments},
+		{"min_fragment_size", cfg.Defragmentation.MinFragmentSize},
+		{"flood_threshold", cfg.Defragmentation.FloodThreshold},
+	} {
+		if limit.value < 0 {
+			invalid("defragmentation."+limit.field, "must not be negative, got %d", limit.value)
+		}
+	}
+	if cfg.Defragmentation.Timeout < 0 {
+		invalid("defragmentation.timeout", "must not be negative, got %s", time.Duration(cfg.Defragmentation.Timeout))
+	}
+	if cfg.Defragmentation.FloodWindow < 0 {
+		invalid("defragmentation.flood_window", "must not be negative, got %s", time.Duration(cfg.Defragmentation.FloodWindow))
+	}
+
+	// aggregation, the settings are only checked together once each of them is valid on its own
+	aggregationErrs := len(errs)
+	if cfg.Aggregation.QuietPeriod < 0 {
+		invalid("aggregation.quiet_period", "must not be negative, got %s", time.Duration(cfg.Aggregation.QuietPeriod))
+	}
+	if cfg.Aggregation.MaxAge < 0 {
+		invalid("aggregation.max_age", "must not be negative, got %s", time.Duration(cfg.Aggregation.MaxAge))
+	}
+	if cfg.Aggregation.MaxSamples < 0 {
+		invalid("aggregation.max_samples", "must not be negative, got %d", cfg.Aggregation.MaxSamples)
+	}
+	if cfg.Aggregation.MaxAggregates < 0 {
+		invalid("aggregation.max_aggregates", "must not be negative, got %d", cfg.Aggregation.MaxAggregates)
+	}
+	if aggregatorConfig := cfg.Aggregation.aggregatorConfig(); aggregatorConfig != nil {
+		if err := aggregatorConfig.Validate(); err != nil && len(errs) == aggregationErrs {
+			invalid("aggregation", "%v", err)
+		}
+	}
+
+	// rules
+	names := map[string]bool{}
+	for i, rule := range cfg.Rules {
+		field := fmt.Sprintf("rules[%d]", i)
+		if names[rule.RuleName()] {
+			invalid(field+".name", "duplicate rule name %q", rule.RuleName())
+		}
+		names[rule.RuleName()] = true
+		errs = append(errs, rule.validate(field)...)
+	}
+
+	// outputs
+	if cfg.Logger.Path == "" {
+		invalid("logger.path", "is required")
+	}
+	if cfg.Logger.MaxSizeMB < 0 {
+		invalid("logger.max_size_mb", "must not be negative, got %d", cfg.Logger.MaxSizeMB)
+	}
+	if cfg.Logger.RotateEvery < 0 {
+		invalid("logger.rotate_every", "must not be negative, got %s", time.Duration(cfg.Logger.RotateEvery))
+	}
+	if cfg.Logger.MaxBackups < 0 {
+		invalid("logger.max_backups", "must not be negative, got %d", cfg.Logger.MaxBackups)
+	}
+	if cfg.Logger.MaxBackupAge < 0 {
+		invalid("logger.max_backup_age", "must not be negative, got %s", time.Duration(cfg.Logger.MaxBackupAge))
+	}
+	errs = append(errs, cfg.Logger.OutputConfig.validate("logger")...)
+	for i, syslog := range cfg.Syslog {
+		field := fmt.Sprintf("syslog[%d]", i)
+		if _, err := syslog.sinkConfig(); err != nil {
+			invalid(field, "%v", err)
+		}
+		errs = append(errs, syslog.OutputConfig.validate(field)...)
+	}
+	queueDirs, channels := map[string]bool{}, map[string]bool{}
+	for i, channel := range cfg.Alerts {
+		field := fmt.Sprintf("alerts[%d]", i)
+		if channel.QueueDir != "" && queueDirs[filepath.Clean(channel.QueueDir)] {
+			invalid(field+".queue_dir", "%s is used by more than one channel", channel.QueueDir)
+		}
+		if channel.QueueDir != "" {
+			queueDirs[filepath.Clean(channel.QueueDir)] = true
+		}
+		if channels[channel.ChannelName()] && len(cfg.Routing.Routes) > 0 {
+			invalid(field+".name", "duplicate channel name %q", channel.ChannelName())
+		}
+		channels[channel.ChannelName()] = true
+		errs = append(errs, channel.validate(field)...)
+		errs = append(errs, channel.OutputConfig.validate(field)...)
+	}
+
+	// routing
+	if len(cfg.Routing.Routes) == 0 && cfg.Routing.AckAddress != "" {
+		invalid("routing.ack_address", "requires routes")
+	}
+	if _, err := cfg.Routing.location(); err != nil {
+		invalid("routing.timezone", "%v", err)
+	}
+	routeNames := map[string]bool{}
+	for i, route := range cfg.Routing.Routes {
+		field := fmt.Sprintf("routing.routes[%d]", i)
+		if routeNames[route.RouteName(i)] {
+			invalid(field+".name", "duplicate route name %q", route.RouteName(i))
+		}
+		routeNames[route.RouteName(i)] = true
+		if len(route.Channels) == 0 {
+			invalid(field+".channels", "at least one channel is required")
+		}
+		for _, channel := range append(slices.Clone(route.Channels), route.EscalateTo...) {
+			if !channels[channel] {
+				invalid(field, "unknown channel %q", channel)
+			}
+		}
+		if route.RateLimit < 0 {
+			invalid(field+".rate_limit", "must not be negative, got %d", route.RateLimit)
+		}
+		if route.RateWindow < 0 {
+			invalid(field+".rate_window", "must not be negative, got %s", time.Duration(route.RateWindow))
+		}
+		if route.EscalateAfter < 0 {
+			invalid(field+".escalate_after", "must not be negative, got %s", time.Duration(route.EscalateAfter))
+		}
+		if (route.EscalateAfter > 0) != (len(route.EscalateTo) > 0) {
+			invalid(field, "escalate_after and escalate_to must be set together")
+		}
+		if _, err := route.route(i, time.Local); err != nil {
+			errs = append(errs, fmt.Errorf("%s.%v", field, err)) // the error starts with the setting
+		}
+	}
+
+	// metrics
+	if cfg.Metrics.Address != "" {
+		if _, _, err := net.SplitHostPort(cfg.Metrics.Address); err != nil {
+			invalid("metrics.address", "%v", err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// validate checks the filter and queue settings of an output.
+func (output OutputConfig) validate(field string) []error {
+	var errs []error
+	if _, err := output.filter(); err != nil {
+		errs = append(errs, fmt.Errorf("%s.%v", field, err)) // the error starts with the setting
+	}
+	if output.QueueSize < 0 {
+		errs = append(errs, fmt.Errorf("%s.queue_size: must not be negative, got %d", field, output.QueueSize))
+	}
+	return errs
+}
+
+// validate checks the parameters of the channel against its type.
+func (channel ChannelConfig) validate(field string) []error {
+	var errs []error
+	invalid := func(subField string, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s.%s: %s", field, subField, fmt.Sprintf(format, args...)))
+	}
+
+	allowed := map[string][]string{
+		WebhookChannelType: {"url", "method", "headers", "username", "password", "bearer_token", "template", "template_file",
+			"content_type", "timeout", "max_retries", "min_backoff", "max_backoff", "queue_dir", "max_queued"},
+		EmailChannelType: {"smtp_host", "smtp_port", "security", "username", "password", "from", "to", "immediate_severity",
+			"digest_interval", "max_groups", "subject_prefix", "timeout"},
+	}
+	for _, setting := range channel.settings() {
+		if !slices.Contains(allowed[channel.Type], setting) && channel.Type != "" {
+			invalid(setting, "not supported by %s channels", channel.Type)
+		}
+	}
+	if channel.Timeout < 0 {
+		invalid("timeout", "must not be negative, got %s", time.Duration(channel.Timeout))
+	}
+
+	switch channel.Type {
+	case StdoutChannelType:
+	case WebhookChannelType:
+		if channel.Template != "" && channel.TemplateFile != "" {
+			invalid("template", "cannot be combined with template_file")
+		}
+		for _, duration := range []struct {
+			field string
+			value Duration
+		}{
+			{"min_backoff", channel.MinBackoff},
+			{"max_backoff", channel.MaxBackoff},
+		} {
+			if duration.value < 0 {
+				invalid(duration.field, "must not be negative, got %s", time.Duration(duration.value))
+			}
+		}
+		if channel.MaxRetries != nil && *channel.MaxRetries < 0 {
+			invalid("max_retries", "must not be negative, got %d", *channel.MaxRetries)
+		}
+		if channel.MaxQueued < 0 {
+			invalid("max_queued", "must not be negative, got %d", channel.MaxQueued)
+		}
+		if len(errs) == 0 {
+			if _, err := channel.webhookConfig(); err != nil {
+				invalid("webhook", "%v", err)
+			}
+		}
+	case EmailChannelType:
+		if channel.SMTPPort < 0 || channel.SMTPPort > 65535 {
+			invalid("smtp_port", "must be between 1 and 65535, got %d", channel.SMTPPort)
+		}
+		if channel.DigestInterval < 0 {
+			invalid("digest_interval", "must not be negative, got %s", time.Duration(channel.DigestInterval))
+		}
+		if channel.MaxGroups < 0 {
+			invalid("max_groups", "must not be negative, got %d", channel.MaxGroups)
+		}
+		if len(errs) == 0 {
+			if _, err := channel.emailConfig(); err != nil {
+				invalid("email", "%v", err)
+			}
+		}
+	case "":
+		invalid("type", "is required")
+	default:
+		invalid("type", "unknown channel type %q (expected stdout, webhook or email)", channel.Type)
+	}
+	return errs
+}
+
+// settings returns the JSON names of the type specific settings of the channel which are set.
+func (channel ChannelConfig) settings() []string {
+	var set []string
+	value := reflect.ValueOf(channel)
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if field.Anonymous || name == "type" || name == "name" || value.Field(i).IsZero() {
+			continue
+		}
+		set = append(set, name)
+	}
+	return set
+}
+
+// ChannelName returns the name identifying the channel, which defaults to its type.
+func (channel ChannelConfig) ChannelName() string {
+	if channel.Name != "" {
+		return channel.Name
+	}
+	return channel.Type
+}
+
+// RouteName returns the name identifying the route at the index, which defaults to route<index>.
+func (route RouteConfig) RouteName(index int) string {
+	if route.Name != "" {
+		return route.Name
+	}
+	return fmt.Sprintf("route%d", index)
+}
+
+// RuleName returns the name identifying the rule, which defaults to its type.
+func (rule RuleConfig) RuleName() string {
+	if rule.Name != "" {
+		return rule.Name
+	}
+	return rule.Type
+}
+
+// IsEnabled reports whether the rule should run.
+func (rule RuleConfig) IsEnabled() bool {
+	return rule.Enabled == nil || *rule.Enabled
+}
+
+// validate checks the parameters of the rule against its type.
+func (rule RuleConfig) validate(field string) []error {
+	var errs []error
+	invalid := func(subField string, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s.%s: %s", field, subField, fmt.Sprintf(format, args...)))
+	}
+
+	switch rule.Type {
+	case PortScanningRuleType, DDoSRuleType:
+		if rule.IPv6Prefix < 0 || rule.IPv6Prefix > 128 {
+			invalid("ipv6_prefix", "must be between 0 and 128 (0 = default %d), got %d", model.DefaultIPv6PrefixLength, rule.IPv6Prefix)
+		}
+	default:
+		if rule.IPv6Prefix != 0 {
+			invalid("ipv6_prefix", "not supported by %s rules", rule.Type)
+		}
+	}
+
+	switch rule.Type {
+	case PortScanningRuleType, DDoSRuleType, LargeVolumeRuleType:
+		if rule.Threshold <= 0 {
+			invalid("threshold", "must be positive, got %d", rule.Threshold)
+		}
+		if rule.Window <= 0 {
+			invalid("window", "must be positive, got %s", time.Duration(rule.Window))
+		}
+		if rule.Signatures != nil {
+			invalid("signatures", "not supported by %s rules", rule.Type)
+		}
+	case HttpVulnerabilityRuleType:
+		if rule.Threshold != 0 {
+			invalid("threshold", "not supported by %s rules", rule.Type)
+		}
+		if rule.Window != 0 {
+			invalid("window", "not supported by %s rules", rule.Type)
+		}
+		for name, patterns := range rule.Signatures {
+			if _, ok := signatureTypes[name]; !ok {
+				invalid("signatures", "unknown incident type %q (expected sql_injection, file_read or code_execution)", name)
+			}
+			for _, pattern := range patterns {
+				if pattern == "" {
+					invalid("signatures."+name, "patterns must not be empty")
+				}
+			}
+		}
+	case "":
+		invalid("type", "is required")
+	default:
+		invalid("type", "unknown rule type %q", rule.Type)
+	}
+	return errs
+}
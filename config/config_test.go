@@ -0,0 +1,116 @@
+package config
+
+import (
+	"awesomeProject/model"
+	"awesomeProject/outputs"
+	"awesomeProject/utils"
+	"bytes"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// minimalConfig holds the sections every configuration needs, the tests add the sections they check.
+const minimalConfig = `"sensors": [{"device": "en0"}], "logger": {"path": "incidents.log"}`
+
+func TestValidateReportsErrorsOfEverySection(t *testing.T) {
+	tests := []struct {
+		name     string
+		sections string   // JSON members added to the minimal configuration
+		errors   []string // Substrings of the validation errors, one per error
+	}{
+		{
+			name:     "reassembly limits after an invalid pipeline",
+			sections: `"pipeline": {"workers": -1}, "reassembly": {"max_buffered_bytes_per_stream": 2000, "max_buffered_bytes_total": 1000}`,
+			errors:   []string{"pipeline.workers", "reassembly: max buffered bytes total must be at least the per stream limit"},
+		},
+		{
+			name:     "negative reassembly limit reported once",
+			sections: `"reassembly": {"max_connections": -1}`,
+			errors:   []string{"reassembly.max_connections: must not be negative"},
+		},
+		{
+			name:     "IPv6 prefix beyond 128 bits",
+			sections: `"rules": [{"type": "ddos", "threshold": 10, "window": "1m", "ipv6_prefix": 129}]`,
+			errors:   []string{"rules[0].ipv6_prefix: must be between 0 and 128 (0 = default 64), got 129"},
+		},
+		{
+			name:     "aggregation settings after an invalid pipeline",
+			sections: `"pipeline": {"drop_policy": "random"}, "aggregation": {"quiet_period": "5m", "max_age": "1m"}`,
+			errors:   []string{"pipeline.drop_policy", "aggregation: max age must be at least the quiet period"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Parse([]byte("{" + minimalConfig + ", " + test.sections + "}"))
+			if err == nil {
+				t.Fatal("configuration was accepted")
+			}
+			for _, want := range test.errors {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q doesn't mention %q", err, want)
+				}
+			}
+			if got := strings.Count(err.Error(), "\n"); got != len(test.errors) {
+				t.Errorf("got %d errors, want %d: %v", got, len(test.errors), err)
+			}
+		})
+	}
+}
+
+func TestLoggerWrittenSynchronously(t *testing.T) {
+	cfg, err := Parse([]byte("{" + minimalConfig + "}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logFile := &memoryLogFile{}
+	fanOut, err := cfg.buildOutput(logFile, utils.NewWallClock())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fanOut.Close()
+
+	count := 2 * outputs.DefaultQueueSize
+	for i := 0; i < count; i++ {
+		fanOut.Write(model.NewIncident(net.IPv4(192, 0, 2, 1), model.PortScanning, time.Now(), nil))
+		if lines := logFile.lines(); lines != i+1 {
+			t.Fatalf("%d lines logged after writing incident %d", lines, i+1)
+		}
+	}
+	if stats := fanOut.Stats()[0]; stats.Written != uint64(count) || stats.Dropped != 0 {
+		t.Errorf("logger wrote %d and dropped %d incidents, want %d and 0", stats.Written, stats.Dropped, count)
+	}
+}
+
+// memoryLogFile is a LogFile kept in memory.
+type memoryLogFile struct {
+	mu   sync.Mutex
+	data bytes.Buffer
+}
+
+// Write implementation according to loggers.LogFile
+func (file *memoryLogFile) Write(p []byte) (int, error) {
+	file.mu.Lock()
+	defer file.mu.Unlock()
+	return file.data.Write(p)
+}
+
+// Sync implementation according to loggers.LogFile
+func (file *memoryLogFile) Sync() error {
+	return nil
+}
+
+// Close implementation according to loggers.LogFile
+func (file *memoryLogFile) Close() error {
+	return nil
+}
+
+// lines returns the number of lines written.
+func (file *memoryLogFile) lines() int {
+	file.mu.Lock()
+	defer file.mu.Unlock()
+	return bytes.Count(file.data.Bytes(), []byte("\n"))
+}
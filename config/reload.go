@@ -0,0 +1,124 @@
+package config
+
+import (
+	"awesomeProject/cmd"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Reloader applies changes of the rule configuration to a running NIDS.
+// A reload is triggered by SIGHUP or by a change of the configuration file's modification time.
+// Only the rules section is reloaded; sensors, pipeline, reassembly,
+// defragmentation, aggregation, logger, syslog, alerts, routing and metrics require a restart.
+type Reloader struct {
+	path         string
+	nids         *cmd.NIDS
+	ruleSet      *RuleSet
+	PollInterval time.Duration // How often the configuration file is checked for changes, 0 disables polling
+
+	mu      sync.Mutex
+	current *Config // Configuration loaded last, changes of the sections requiring a restart are reported once
+	modTime time.Time
+}
+
+// NewReloader creates a Reloader for a NIDS built from the configuration file at path.
+func NewReloader(path string, cfg *Config, nids *cmd.NIDS, ruleSet *RuleSet) *Reloader {
+	reloader := &Reloader{
+		path:         path,
+		nids:         nids,
+		ruleSet:      ruleSet,
+		PollInterval: 5 * time.Second,
+		current:      cfg,
+	}
+	if info, err := os.Stat(path); err == nil {
+		reloader.modTime = info.ModTime()
+	}
+	return reloader
+}
+
+// Run reloads the configuration on SIGHUP and whenever the file changes, until the context is cancelled.
+func (reloader *Reloader) Run(ctx context.Context) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	var poll <-chan time.Time
+	if reloader.PollInterval > 0 {
+		ticker := time.NewTicker(reloader.PollInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			reloader.reportReload(reloader.Reload())
+		case <-poll:
+			if reloader.fileChanged() {
+				reloader.reportReload(reloader.Reload())
+			}
+		}
+	}
+}
+
+// Reload reads the configuration file and atomically swaps the rules of the NIDS.
+// An invalid configuration is rejected and the running rules are left untouched.
+func (reloader *Reloader) Reload() error {
+	reloader.mu.Lock()
+	defer reloader.mu.Unlock()
+
+	if info, err := os.Stat(reloader.path); err == nil {
+		reloader.modTime = info.ModTime()
+	}
+
+	cfg, err := Load(reloader.path)
+	if err != nil {
+		return err
+	}
+
+	if !reflect.DeepEqual(cfg.Sensors, reloader.current.Sensors) ||
+		!reflect.DeepEqual(cfg.Pipeline, reloader.current.Pipeline) ||
+		!reflect.DeepEqual(cfg.Reassembly, reloader.current.Reassembly) ||
+		!reflect.DeepEqual(cfg.Defragmentation, reloader.current.Defragmentation) ||
+		!reflect.DeepEqual(cfg.Aggregation, reloader.current.Aggregation) ||
+		!reflect.DeepEqual(cfg.Logger, reloader.current.Logger) ||
+		!reflect.DeepEqual(cfg.Syslog, reloader.current.Syslog) ||
+		!reflect.DeepEqual(cfg.Alerts, reloader.current.Alerts) ||
+		!reflect.DeepEqual(cfg.Routing, reloader.current.Routing) ||
+		!reflect.DeepEqual(cfg.Metrics, reloader.current.Metrics) {
+		fmt.Println("Config reload: only rule changes are applied, restart to apply sensor, pipeline, reassembly, defragmentation, aggregation, logger, syslog, alert, routing or metrics changes")
+	}
+
+	reloader.nids.SetRules(reloader.ruleSet.Build(cfg.Rules))
+	reloader.current = cfg
+	return nil
+}
+
+// fileChanged reports whether the modification time of the configuration file changed since the last reload.
+func (reloader *Reloader) fileChanged() bool {
+	info, err := os.Stat(reloader.path)
+	if err != nil {
+		return false
+	}
+
+	reloader.mu.Lock()
+	defer reloader.mu.Unlock()
+	return !info.ModTime().Equal(reloader.modTime)
+}
+
+// reportReload prints the outcome of a reload.
+func (reloader *Reloader) reportReload(err error) {
+	if err != nil {
+		fmt.Printf("Error reloading config, keeping the current rules: %v\n", err)
+		return
+	}
+	fmt.Printf("Reloaded rules from %s\n", reloader.path)
+}
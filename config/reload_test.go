@@ -0,0 +1,152 @@
+package config
+
+import (
+	"awesomeProject/cmd"
+	"awesomeProject/rules"
+	"awesomeProject/utils"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReloaderAppliesRuleChanges(t *testing.T) {
+	path := writeConfig(t, "", `"rules": [{"type": "ddos", "threshold": 15, "window": "30s"}, {"type": "http_vulnerability"}]`)
+	reloader, nids := newTestReloader(t, path)
+	ddos := nids.Rules()[0]
+
+	writeConfig(t, path, `"rules": [{"type": "ddos", "threshold": 20, "window": "1m"}, {"type": "port_scanning", "threshold": 10, "window": "30s"}]`)
+	if err := reloader.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if got := ruleNames(nids.Rules()); !slices.Equal(got, []string{"ddos", "port_scanning"}) {
+		t.Fatalf("running rules %v after the reload", got)
+	}
+	if nids.Rules()[0] != ddos || ddos.(*rules.DDoSRule).Threshold != 20 {
+		t.Errorf("DDoS rule was rebuilt or kept its threshold")
+	}
+
+	writeConfig(t, path, `"rules": [{"type": "ddos", "threshold": -1, "window": "1m"}]`)
+	if err := reloader.Reload(); err == nil {
+		t.Errorf("invalid configuration was applied")
+	}
+	if got := ruleNames(nids.Rules()); !slices.Equal(got, []string{"ddos", "port_scanning"}) {
+		t.Errorf("running rules %v after a rejected reload", got)
+	}
+}
+
+func TestReloaderWarnsOnceAboutRestart(t *testing.T) {
+	rulesSection := `"rules": [{"type": "http_vulnerability"}]`
+	path := writeConfig(t, "", rulesSection)
+	reloader, _ := newTestReloader(t, path)
+
+	steps := []struct {
+		sections string
+		warned   bool
+	}{
+		{rulesSection, false},
+		{`"pipeline": {"workers": 2}, ` + rulesSection, true},
+		{`"pipeline": {"workers": 2}, ` + rulesSection, false}, // reported already
+		{`"pipeline": {"workers": 2}, "rules": [{"type": "large_volume", "threshold": 10, "window": "1m"}]`, false},
+		{rulesSection, true},
+	}
+	for i, step := range steps {
+		writeConfig(t, path, step.sections)
+		output := captureStdout(t, func() {
+			if err := reloader.Reload(); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if warned := strings.Contains(output, "restart to apply"); warned != step.warned {
+			t.Errorf("reload %d: warned %t, want %t: %q", i, warned, step.warned, output)
+		}
+	}
+}
+
+func TestReloaderPollsFile(t *testing.T) {
+	path := writeConfig(t, "", `"rules": [{"type": "http_vulnerability"}]`)
+	reloader, nids := newTestReloader(t, path)
+	reloader.PollInterval = 10 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		reloader.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+
+	writeConfig(t, path, `"rules": [{"type": "large_volume", "threshold": 10, "window": "1m"}]`)
+	later := time.Now().Add(time.Minute) // the modification time may not change within the file system's resolution
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !slices.Equal(ruleNames(nids.Rules()), []string{"large_volume"}) {
+		if time.Now().After(deadline) {
+			t.Fatalf("running rules %v, the change of the file wasn't applied", ruleNames(nids.Rules()))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// writeConfig writes a configuration with the sections to path, to a new file if path is empty, and returns the path.
+func writeConfig(t *testing.T, path, sections string) string {
+	t.Helper()
+	if path == "" {
+		path = filepath.Join(t.TempDir(), "nids.json")
+	}
+	if err := os.WriteFile(path, []byte("{"+minimalConfig+", "+sections+"}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newTestReloader builds the rules of the configuration file into a NIDS and returns a reloader for them.
+func newTestReloader(t *testing.T, path string) (*Reloader, *cmd.NIDS) {
+	t.Helper()
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ruleSet := NewRuleSet()
+	nids := cmd.NewNIDS(nil, ruleSet.Build(cfg.Rules), nil, utils.NewWallClock())
+	t.Cleanup(func() { stopRules(nids.Rules()) })
+	return NewReloader(path, cfg, nids, ruleSet), nids
+}
+
+// ruleNames returns the names of the rules.
+func ruleNames(built []rules.Rule) []string {
+	names := []string{}
+	for _, rule := range built {
+		names = append(names, rules.RuleName(rule))
+	}
+	return names
+}
+
+// captureStdout returns what the function printed.
+func captureStdout(t *testing.T, function func()) string {
+	t.Helper()
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = writer
+	defer func() { os.Stdout = stdout }()
+
+	output := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(reader)
+		output <- string(data)
+	}()
+	function()
+	writer.Close()
+	return <-output
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"awesomeProject/rules"
+	"sync"
+	"time"
+)
+
+// RuleSet builds rules from their configuration and remembers them by name.
+// Rebuilding it from a new configuration reuses the rules whose name and type did not change,
+// so their sliding-window state and the stream data kept by signature rules survive a reload.
+type RuleSet struct {
+	mu    sync.Mutex
+	rules map[string]builtRule
+}
+
+// builtRule is a rule together with the configuration it was built from.
+type builtRule struct {
+	config RuleConfig
+	rule   rules.Rule
+}
+
+// NewRuleSet creates an empty RuleSet.
+func NewRuleSet() *RuleSet {
+	return &RuleSet{rules: make(map[string]builtRule)}
+}
+
+// Build returns the enabled rules of the configuration, in the order they are declared.
+// Rules that already exist under the same name, type and IPv6 prefix are kept: windowed rules receive the new
+// limits and signature rules the new signatures.
+func (set *RuleSet) Build(configs []RuleConfig) []rules.Rule {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+
+	built := []rules.Rule{}
+	next := make(map[string]builtRule)
+	for _, ruleConfig := range configs {
+		if !ruleConfig.IsEnabled() {
+			continue
+		}
+
+		rule := set.reuse(ruleConfig)
+		if rule == nil {
+			rule = ruleConfig.Build()
+		}
+
+		next[ruleConfig.RuleName()] = builtRule{config: ruleConfig, rule: rule}
+		built = append(built, rule)
+	}
+
+	set.rules = next
+	return built
+}
+
+// reuse returns the existing rule matching the configuration with its limits updated, or nil.
+func (set *RuleSet) reuse(ruleConfig RuleConfig) rules.Rule {
+	existing, exists := set.rules[ruleConfig.RuleName()]
+	if !exists || existing.config.Type != ruleConfig.Type {
+		return nil
+	}
+	if existing.config.ipv6PrefixLength() != ruleConfig.ipv6PrefixLength() {
+		return nil // the recorded traffic is keyed by the previous prefix
+	}
+
+	switch rule := existing.rule.(type) {
+	case rules.WindowedRule:
+		rule.SetLimits(ruleConfig.Threshold, time.Duration(ruleConfig.Window))
+		return rule
+	case rules.SignatureRule:
+		rule.SetSignatures(ruleConfig.httpSignatures()) // the stream tails are kept
+		return rule
+	default:
+		return nil
+	}
+}
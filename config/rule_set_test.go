@@ -0,0 +1,64 @@
+package config
+
+import (
+	"awesomeProject/model"
+	"awesomeProject/rules"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestRuleSetReusesRules(t *testing.T) {
+	set := NewRuleSet()
+	first := set.Build([]RuleConfig{
+		{Type: DDoSRuleType, Threshold: 15, Window: Duration(30 * time.Second)},
+		{Name: "web", Type: HttpVulnerabilityRuleType},
+		{Name: "volume", Type: LargeVolumeRuleType, Threshold: 10, Window: Duration(30 * time.Second)},
+	})
+	defer stopRules(first)
+
+	second := set.Build([]RuleConfig{
+		{Type: DDoSRuleType, Threshold: 20, Window: Duration(time.Minute)},                                            // new limits
+		{Name: "web", Type: HttpVulnerabilityRuleType, Signatures: map[string][]string{"file_read": {"/etc/shadow"}}}, // new signatures
+		{Name: "volume", Type: PortScanningRuleType, Threshold: 10, Window: Duration(30 * time.Second)},               // new type
+	})
+	defer stopRules(second)
+
+	if second[0] != first[0] || second[1] != first[1] {
+		t.Errorf("rules whose name and type didn't change were rebuilt")
+	}
+	if second[2] == first[2] {
+		t.Errorf("rule whose type changed was reused")
+	}
+	if ddos := second[0].(*rules.DDoSRule); ddos.Threshold != 20 || ddos.WindowDuration != time.Minute {
+		t.Errorf("reused DDoS rule has threshold %d and window %s", ddos.Threshold, ddos.WindowDuration)
+	}
+	if http := second[1].(*rules.HttpVulnerabilityRule); len(http.Signatures[model.FileRead]) != 1 {
+		t.Errorf("reused HTTP rule has file read signatures %q", http.Signatures[model.FileRead])
+	}
+}
+
+func TestRuleSetKeepsStreamTailsOnReload(t *testing.T) {
+	set := NewRuleSet()
+	configs := []RuleConfig{{Type: HttpVulnerabilityRuleType}}
+	http := set.Build(configs)[0].(rules.StreamRule)
+
+	key := model.StreamKey{Src: netip.MustParseAddrPort("192.0.2.1:40000"), Dst: netip.MustParseAddrPort("192.0.2.2:80")}
+	if incidents := http.DetectStream(&model.StreamData{Key: key, Data: []byte("GET /?f=/etc/pa")}); len(incidents) != 0 {
+		t.Fatalf("the first half of the pattern raised %d incidents", len(incidents))
+	}
+	http = set.Build(configs)[0].(rules.StreamRule)
+	incidents := http.DetectStream(&model.StreamData{Key: key, Data: []byte("sswd HTTP/1.1\r\n"), Offset: 15})
+	if len(incidents) != 1 || incidents[0].Type != model.FileRead {
+		t.Errorf("pattern split across a reload raised %d incidents, want a file read", len(incidents))
+	}
+}
+
+// stopRules stops the background jobs of the rules.
+func stopRules(built []rules.Rule) {
+	for _, rule := range built {
+		if stoppable, ok := rule.(rules.Stoppable); ok {
+			stoppable.Stop()
+		}
+	}
+}
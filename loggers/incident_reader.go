@@ -0,0 +1,62 @@
+package loggers
+
+import (
+	. "awesomeProject/model"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// maxIncidentLine bounds the length of a logged incident, which carries base64 encoded sample packets.
+const maxIncidentLine = 16 << 20
+
+// IncidentReader reads incidents logged by IncidentLogger, one JSON line each, in any schema version.
+type IncidentReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+// NewIncidentReader creates a reader of the incidents logged to r.
+func NewIncidentReader(r io.Reader) *IncidentReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxIncidentLine)
+	return &IncidentReader{scanner: scanner}
+}
+
+// Read returns the next incident, or io.EOF once all incidents were read. Empty lines are skipped.
+func (reader *IncidentReader) Read() (*Incident, error) {
+	for reader.scanner.Scan() {
+		reader.line++
+		if len(reader.scanner.Bytes()) == 0 {
+			continue
+		}
+
+		incident := &Incident{}
+		if err := json.Unmarshal(reader.scanner.Bytes(), incident); err != nil {
+			return nil, fmt.Errorf("error reading incident on line %d: %w", reader.line, err)
+		}
+		return incident, nil
+	}
+
+	if err := reader.scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading incident log after line %d: %w", reader.line, err)
+	}
+	return nil, io.EOF
+}
+
+// ReadIncidents reads all incidents logged to r.
+func ReadIncidents(r io.Reader) ([]*Incident, error) {
+	reader := NewIncidentReader(r)
+	incidents := []*Incident{}
+	for {
+		incident, err := reader.Read()
+		if err == io.EOF {
+			return incidents, nil
+		}
+		if err != nil {
+			return incidents, err
+		}
+		incidents = append(incidents, incident)
+	}
+}
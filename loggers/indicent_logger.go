@@ -2,17 +2,61 @@ package loggers
 
 import (
 	. "awesomeProject/model"
+	"awesomeProject/outputs"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
+	"io"
+	"sync"
 )
 
-// IncidentLogger handles logging of detected incidents.
+// LogFile is the file incidents are logged to, an *os.File or a *RotatingFile.
+type LogFile interface {
+	io.Writer
+	Sync() error
+	Close() error
+}
+
+// IncidentLogger handles logging of detected incidents. It is an output sink.
 type IncidentLogger struct {
-	LogFile *os.File
+	LogFile LogFile
+	mu      sync.Mutex // Keeps lines of concurrent incidents from interleaving
+}
+
+// Write logs the incident to the log file as a JSON line, see IncidentSchemaVersion for its schema.
+func (logger *IncidentLogger) Write(incident *Incident) error {
+	logData, err := json.Marshal(incident)
+	if err != nil {
+		return fmt.Errorf("error encoding incident: %w", err)
+	}
+
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	_, err = logger.LogFile.Write(append(logData, '\n')) // a single write, so rotation never splits the line
+	return err
+}
+
+// Flush commits the logged incidents to stable storage.
+func (logger *IncidentLogger) Flush() error {
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	return logger.LogFile.Sync()
+}
+
+// Reopen opens the log file at its path again, e.g. after logrotate renamed it.
+// Log files that can't be reopened are left as they are.
+func (logger *IncidentLogger) Reopen() error {
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	if reopener, ok := logger.LogFile.(outputs.Reopener); ok {
+		return reopener.Reopen()
+	}
+	return nil
 }
 
-func (logger *IncidentLogger) LogIncident(incident *Incident) {
-	logData, _ := json.Marshal(incident)
-	fmt.Fprintln(logger.LogFile, string(logData)) // Log to file
+// Close commits the logged incidents and closes the log file.
+func (logger *IncidentLogger) Close() error {
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	return errors.Join(logger.LogFile.Sync(), logger.LogFile.Close())
 }
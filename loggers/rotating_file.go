@@ -0,0 +1,340 @@
+package loggers
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotatedTimeFormat is the timestamp appended to the name of rotated files, it sorts in chronological order.
+const rotatedTimeFormat = "20060102-150405.000"
+
+// RotationConfig sets when a RotatingFile is rotated and how long rotated files are kept.
+// Zero values disable the respective limit.
+type RotationConfig struct {
+	MaxSize      int64         // The file is rotated before it grows beyond this many bytes
+	Interval     time.Duration // The file is rotated once it was written to for this long
+	Compress     bool          // Rotated files are compressed with gzip
+	MaxBackups   int           // Rotated files kept, the oldest are deleted
+	MaxBackupAge time.Duration // Rotated files last modified longer ago are deleted
+}
+
+// Validate checks that the configuration describes a usable rotation.
+func (config RotationConfig) Validate() error {
+	if config.MaxSize < 0 || config.Interval < 0 || config.MaxBackups < 0 || config.MaxBackupAge < 0 {
+		return errors.New("rotation limits must not be negative")
+	}
+	return nil
+}
+
+// RotatingFile is an append-only file which is renamed and replaced by a new file once it reaches its size
+// or age limit. Rotated files are named after the file with the rotation time appended, e.g.
+// "incidents.log.20240101-120000.000", and optionally compressed to a ".gz" file in the background.
+// Each Write is appended as a whole to a single file, so lines written with one call are never split.
+// It is safe for concurrent use.
+type RotatingFile struct {
+	path        string
+	config      RotationConfig
+	mu          sync.Mutex
+	file        *os.File // nil after a failed rotation, the file is opened again on the next write
+	closed      bool
+	size        int64
+	opened      time.Time
+	lastStamp   string // Rotation time of the last rotated file, see rotatedName
+	lastCounter int
+	retention   sync.Mutex     // Serializes the compression and removal of rotated files
+	compressing sync.WaitGroup // Background compressions of rotated files
+}
+
+// OpenRotatingFile opens the file at path for appending, creating it if needed.
+func OpenRotatingFile(path string, config RotationConfig) (*RotatingFile, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	rotating := &RotatingFile{path: path, config: config}
+	if err := rotating.open(); err != nil {
+		return nil, err
+	}
+	return rotating, nil
+}
+
+// Write appends p to the file, rotating the file first if p would exceed a limit.
+func (rotating *RotatingFile) Write(p []byte) (int, error) {
+	rotating.mu.Lock()
+	defer rotating.mu.Unlock()
+
+	if rotating.closed {
+		return 0, os.ErrClosed
+	}
+	if rotating.file == nil {
+		if err := rotating.open(); err != nil {
+			return 0, err
+		}
+	}
+	if rotating.due(len(p)) {
+		if err := rotating.rotate(); err != nil {
+			if rotating.file == nil {
+				return 0, err
+			}
+			fmt.Printf("Error rotating log file, writing on to %s: %v\n", rotating.path, err)
+		}
+	}
+
+	n, err := rotating.file.Write(p)
+	rotating.size += int64(n)
+	return n, err
+}
+
+// Sync commits the written data to stable storage.
+func (rotating *RotatingFile) Sync() error {
+	rotating.mu.Lock()
+	defer rotating.mu.Unlock()
+
+	if rotating.file == nil {
+		return os.ErrClosed
+	}
+	return rotating.file.Sync()
+}
+
+// Rotate rotates the file right away.
+func (rotating *RotatingFile) Rotate() error {
+	rotating.mu.Lock()
+	defer rotating.mu.Unlock()
+
+	if rotating.file == nil {
+		return os.ErrClosed
+	}
+	return rotating.rotate()
+}
+
+// Reopen closes the file and opens the file at its path again. It lets an external tool such as logrotate
+// rename the file and signal the NIDS to continue in a new file.
+func (rotating *RotatingFile) Reopen() error {
+	rotating.mu.Lock()
+	defer rotating.mu.Unlock()
+
+	if rotating.closed {
+		return os.ErrClosed
+	}
+	if rotating.file != nil {
+		if err := rotating.closeFile(); err != nil {
+			return err
+		}
+	}
+	return rotating.open()
+}
+
+// Close closes the file and waits for the background compressions to finish.
+func (rotating *RotatingFile) Close() error {
+	rotating.mu.Lock()
+	var err error
+	if rotating.file != nil {
+		err = rotating.closeFile()
+	}
+	rotating.closed = true
+	rotating.mu.Unlock()
+
+	rotating.compressing.Wait()
+	return err
+}
+
+// due reports whether the file must be rotated before writing n more bytes.
+// A write larger than the size limit is written to an empty file rather than rotated forever.
+func (rotating *RotatingFile) due(n int) bool {
+	if rotating.config.MaxSize > 0 && rotating.size > 0 && rotating.size+int64(n) > rotating.config.MaxSize {
+		return true
+	}
+	return rotating.config.Interval > 0 && rotating.size > 0 && time.Since(rotating.opened) >= rotating.config.Interval
+}
+
+// rotate renames the current file, opens a new one and hands the rotated file to the retention.
+// If the file can't be renamed, it is opened again and written on.
+func (rotating *RotatingFile) rotate() error {
+	if err := rotating.closeFile(); err != nil {
+		return err
+	}
+
+	rotated := rotating.rotatedName(time.Now())
+	renameErr := os.Rename(rotating.path, rotated)
+	if err := rotating.open(); err != nil {
+		return err
+	}
+	if renameErr != nil {
+		return renameErr
+	}
+
+	rotating.compressing.Add(1)
+	go func() {
+		defer rotating.compressing.Done()
+		rotating.applyRetention()
+	}()
+	return nil
+}
+
+// rotatedName returns an unused name for the file rotated at the given time. Files rotated within the same
+// millisecond get an increasing counter appended, also when the retention removed the earlier ones already,
+// so the newest file never takes the name of an older one.
+func (rotating *RotatingFile) rotatedName(now time.Time) string {
+	stamp := now.Format(rotatedTimeFormat)
+	counter := 0
+	if stamp == rotating.lastStamp {
+		counter = rotating.lastCounter + 1
+	}
+	for ; ; counter++ {
+		candidate := rotating.path + "." + stamp
+		if counter > 0 {
+			candidate = fmt.Sprintf("%s-%d", candidate, counter)
+		}
+		if !fileExists(candidate) && !fileExists(candidate+".gz") {
+			rotating.lastStamp, rotating.lastCounter = stamp, counter
+			return candidate
+		}
+	}
+}
+
+// open opens the file at the path for appending.
+func (rotating *RotatingFile) open() error {
+	file, err := os.OpenFile(rotating.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	rotating.file, rotating.size, rotating.opened = file, info.Size(), time.Now()
+	return nil
+}
+
+// closeFile commits and closes the current file.
+func (rotating *RotatingFile) closeFile() error {
+	file := rotating.file
+	rotating.file = nil
+	return errors.Join(file.Sync(), file.Close())
+}
+
+// applyRetention compresses the rotated files not compressed yet and deletes the rotated files beyond the
+// retention count or age. Running it after every rotation also catches up on files left by an earlier run.
+func (rotating *RotatingFile) applyRetention() {
+	rotating.retention.Lock()
+	defer rotating.retention.Unlock()
+
+	rotated, err := rotating.rotatedFiles()
+	if err != nil {
+		fmt.Printf("Error listing rotated log files: %v\n", err)
+		return
+	}
+
+	kept := 0
+	for _, path := range rotated {
+		expired := rotating.config.MaxBackups > 0 && kept >= rotating.config.MaxBackups
+		if !expired && rotating.config.MaxBackupAge > 0 {
+			info, err := os.Stat(path)
+			expired = err == nil && time.Since(info.ModTime()) > rotating.config.MaxBackupAge
+		}
+
+		switch {
+		case expired:
+			if err := os.Remove(path); err != nil {
+				fmt.Printf("Error removing rotated log file: %v\n", err)
+			}
+		case rotating.config.Compress && !strings.HasSuffix(path, ".gz"):
+			if err := compress(path); err != nil {
+				fmt.Printf("Error compressing rotated log file %s: %v\n", path, err)
+			}
+			kept++
+		default:
+			kept++
+		}
+	}
+}
+
+// rotatedFiles returns the paths of the files rotated by a RotatingFile at the path, newest first.
+// Files rotated externally, e.g. by logrotate, aren't named after the rotation time and are left alone.
+func (rotating *RotatingFile) rotatedFiles() ([]string, error) {
+	dir, base := filepath.Split(rotating.path)
+	entries, err := os.ReadDir(filepath.Clean(dir + "."))
+	if err != nil {
+		return nil, err
+	}
+
+	type rotatedFile struct {
+		path    string
+		stamp   string
+		counter int // Appended by rotatedName to files rotated within the same millisecond
+	}
+	files := []rotatedFile{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, base+".") || strings.HasSuffix(name, ".tmp") {
+			continue
+		}
+		suffix := strings.TrimSuffix(strings.TrimPrefix(name, base+"."), ".gz")
+		if len(suffix) < len(rotatedTimeFormat) {
+			continue
+		}
+		stamp, counter := suffix[:len(rotatedTimeFormat)], 0
+		if _, err := time.Parse(rotatedTimeFormat, stamp); err != nil {
+			continue
+		}
+		if rest := suffix[len(rotatedTimeFormat):]; rest != "" {
+			if counter, err = strconv.Atoi(strings.TrimPrefix(rest, "-")); err != nil || !strings.HasPrefix(rest, "-") {
+				continue
+			}
+		}
+		files = append(files, rotatedFile{filepath.Join(dir, name), stamp, counter})
+	}
+	// the time format sorts chronologically, files rotated within the same millisecond by their counter
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].stamp != files[j].stamp {
+			return files[i].stamp > files[j].stamp
+		}
+		return files[i].counter > files[j].counter
+	})
+
+	rotated := make([]string, len(files))
+	for i, file := range files {
+		rotated[i] = file.path
+	}
+	return rotated, nil
+}
+
+// compress replaces the file with a gzip compressed copy named after it with ".gz" appended.
+func compress(path string) error {
+	source, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	target, err := os.OpenFile(path+".gz.tmp", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	writer := gzip.NewWriter(target)
+	_, err = io.Copy(writer, source)
+	err = errors.Join(err, writer.Close(), target.Sync(), target.Close())
+	if err == nil {
+		err = os.Rename(path+".gz.tmp", path+".gz")
+	}
+	if err != nil {
+		os.Remove(path + ".gz.tmp")
+		return err
+	}
+	return os.Remove(path)
+}
+
+// fileExists reports whether a file exists at path.
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,250 @@
+package loggers
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatingFileRotatesBySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "incidents.log")
+	rotating, err := OpenRotatingFile(path, RotationConfig{MaxSize: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := []string{}
+	for i := 0; i < 40; i++ {
+		line := fmt.Sprintf("incident %02d %s\n", i, strings.Repeat("x", 17)) // 30 bytes, 3 fit in a file
+		lines = append(lines, line)
+		if _, err := rotating.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rotating.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := rotating.rotatedFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rotated) != 13 {
+		t.Fatalf("got %d rotated files, want 13", len(rotated))
+	}
+	written := ""
+	for _, file := range append(reversed(rotated), path) {
+		content := readLog(t, file)
+		if len(content) > 100 || !strings.HasSuffix(content, "\n") {
+			t.Errorf("%s holds %d bytes: %q", file, len(content), content)
+		}
+		written += content
+	}
+	if written != strings.Join(lines, "") {
+		t.Errorf("the files, oldest first, hold\n%s\nwant\n%s", written, strings.Join(lines, ""))
+	}
+}
+
+func TestRotatingFileRetention(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    RotationConfig
+		rotations int
+		kept      []string // Content of the rotated files kept, newest first
+	}{
+		{"unlimited", RotationConfig{}, 4, []string{"3\n", "2\n", "1\n", "0\n"}},
+		{"max backups", RotationConfig{MaxBackups: 2}, 4, []string{"3\n", "2\n"}},
+		{"compressed", RotationConfig{Compress: true}, 3, []string{"2\n", "1\n", "0\n"}},
+		{"compressed with max backups", RotationConfig{Compress: true, MaxBackups: 1}, 3, []string{"2\n"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "incidents.log")
+			rotating, err := OpenRotatingFile(path, test.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < test.rotations; i++ {
+				if _, err := fmt.Fprintf(rotating, "%d\n", i); err != nil {
+					t.Fatal(err)
+				}
+				if err := rotating.Rotate(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := rotating.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			rotated, err := rotating.rotatedFiles()
+			if err != nil {
+				t.Fatal(err)
+			}
+			kept := []string{}
+			for _, file := range rotated {
+				if strings.HasSuffix(file, ".gz") != test.config.Compress {
+					t.Errorf("%s compressed %t, want %t", file, !test.config.Compress, test.config.Compress)
+				}
+				kept = append(kept, readLog(t, file))
+			}
+			if !slices.Equal(kept, test.kept) {
+				t.Errorf("kept %q, want %q", kept, test.kept)
+			}
+			if content := readLog(t, path); content != "" {
+				t.Errorf("current file holds %q after rotating", content)
+			}
+		})
+	}
+}
+
+func TestRotatingFileRemovesExpiredBackups(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "incidents.log")
+	stale := path + ".20200101-000000.000"
+	external := path + ".1" // rotated by logrotate
+	for _, file := range []string{stale, external} {
+		if err := os.WriteFile(file, []byte("old\n"), 0666); err != nil {
+			t.Fatal(err)
+		}
+		old := time.Now().Add(-48 * time.Hour)
+		if err := os.Chtimes(file, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rotating, err := OpenRotatingFile(path, RotationConfig{MaxBackupAge: 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintln(rotating, "new")
+	if err := rotating.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := rotating.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if fileExists(stale) {
+		t.Errorf("%s older than the max backup age wasn't removed", stale)
+	}
+	if !fileExists(external) {
+		t.Errorf("%s not rotated by the RotatingFile was removed", external)
+	}
+	rotated, err := rotating.rotatedFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rotated) != 1 || readLog(t, rotated[0]) != "new\n" {
+		t.Errorf("kept rotated files %v, want the one just rotated", rotated)
+	}
+}
+
+func TestRotatingFileReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "incidents.log")
+	rotating, err := OpenRotatingFile(path, RotationConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintln(rotating, "before")
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintln(rotating, "renamed")
+	if err := rotating.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintln(rotating, "after")
+	if err := rotating.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readLog(t, path+".1"); got != "before\nrenamed\n" {
+		t.Errorf("renamed file holds %q", got)
+	}
+	if got := readLog(t, path); got != "after\n" {
+		t.Errorf("reopened file holds %q", got)
+	}
+	if _, err := rotating.Write([]byte("closed\n")); err != os.ErrClosed {
+		t.Errorf("writing after closing returned %v, want %v", err, os.ErrClosed)
+	}
+}
+
+func TestRotatedFilesOrder(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{
+		"incidents.log.20240101-120000.000",
+		"incidents.log.20240101-120000.000-1.gz",
+		"incidents.log.20240101-120000.000-2",
+		"incidents.log.20240101-120000.000-10.gz",
+		"incidents.log.20240101-120000.001",
+		"incidents.log.20231231-235959.999.gz",
+		"incidents.log.20240101-120000.000-3.gz.tmp", // compression in progress
+		"incidents.log.1",                            // rotated by logrotate
+		"incidents.log.20240101-120000.000x",
+		"other.log.20240101-120000.000",
+	}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rotating := &RotatingFile{path: filepath.Join(dir, "incidents.log")}
+	rotated, err := rotating.rotatedFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, file := range rotated {
+		got = append(got, filepath.Base(file))
+	}
+	want := []string{
+		"incidents.log.20240101-120000.001",
+		"incidents.log.20240101-120000.000-10.gz",
+		"incidents.log.20240101-120000.000-2",
+		"incidents.log.20240101-120000.000-1.gz",
+		"incidents.log.20240101-120000.000",
+		"incidents.log.20231231-235959.999.gz",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got rotated files\n%q\nwant\n%q", got, want)
+	}
+}
+
+// readLog returns the content of a log file, decompressed if it is a ".gz" file.
+func readLog(t *testing.T, path string) string {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		gzipReader, err := gzip.NewReader(file)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		reader = gzipReader
+	}
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	return string(content)
+}
+
+// reversed returns a reversed copy of the paths.
+func reversed(paths []string) []string {
+	paths = slices.Clone(paths)
+	slices.Reverse(paths)
+	return paths
+}
@@ -0,0 +1,420 @@
+package loggers
+
+import (
+	. "awesomeProject/model"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SyslogFormat is the message format a SyslogSink sends incidents in.
+type SyslogFormat int
+
+const (
+	RFC5424 SyslogFormat = iota // RFC 5424 message with the incident as structured data
+	CEF                         // ArcSight Common Event Format, carried in an RFC 5424 message
+)
+
+// String method for better readability
+func (format SyslogFormat) String() string {
+	switch format {
+	case RFC5424:
+		return "rfc5424"
+	case CEF:
+		return "cef"
+	default:
+		return "Unknown Syslog Format"
+	}
+}
+
+// ParseSyslogFormat parses the name of a syslog format, "rfc5424" or "cef".
+func ParseSyslogFormat(name string) (SyslogFormat, error) {
+	for _, format := range []SyslogFormat{RFC5424, CEF} {
+		if strings.EqualFold(format.String(), name) {
+			return format, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown syslog format %q (expected rfc5424 or cef)", name)
+}
+
+// syslogFacilities maps the facility names to their codes.
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11, "ntp": 12, "security": 13, "console": 14, "solaris-cron": 15,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// ParseSyslogFacility returns the code of a facility name, e.g. 16 for "local0".
+func ParseSyslogFacility(name string) (int, error) {
+	facility, ok := syslogFacilities[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown syslog facility %q", name)
+	}
+	return facility, nil
+}
+
+const (
+	DefaultSyslogFacility = 16 // local0
+	DefaultSyslogAppName  = "nids"
+	DefaultSyslogTimeout  = 5 * time.Second
+
+	// syslogEnterpriseID qualifies the structured data ID of the incidents. It is the example enterprise number
+	// reserved by RFC 5612, the NIDS doesn't have an enterprise number of its own.
+	syslogEnterpriseID = 32473
+
+	// CEF header fields identifying the NIDS as the device reporting the incidents.
+	cefVendor  = "NIDS"
+	cefProduct = "NIDS"
+	cefVersion = "1.0"
+)
+
+// SyslogConfig sets the syslog receiver incidents are sent to and how they are formatted.
+type SyslogConfig struct {
+	Network  string        // udp, tcp, tls or unix
+	Address  string        // host:port of the receiver, or the socket path for unix
+	Format   SyslogFormat  // Message format
+	Facility int           // Facility code between 0 and 23, see ParseSyslogFacility
+	Hostname string        // Host the messages originate from, defaults to the host name
+	AppName  string        // Application the messages originate from, defaults to "nids"
+	TLS      *tls.Config   // Client configuration for tls, the system roots are trusted if nil
+	Timeout  time.Duration // Limit for connecting and sending a message, defaults to 5s
+}
+
+// DefaultSyslogConfig returns the configuration of a receiver, sending RFC 5424 messages to local0.
+func DefaultSyslogConfig(network, address string) SyslogConfig {
+	return SyslogConfig{
+		Network:  network,
+		Address:  address,
+		Format:   RFC5424,
+		Facility: DefaultSyslogFacility,
+		AppName:  DefaultSyslogAppName,
+		Timeout:  DefaultSyslogTimeout,
+	}
+}
+
+// Validate checks that the configuration describes a usable receiver.
+func (config SyslogConfig) Validate() error {
+	switch config.Network {
+	case "udp", "tcp", "tls", "unix":
+	default:
+		return fmt.Errorf("unknown syslog network %q (expected udp, tcp, tls or unix)", config.Network)
+	}
+	if config.Address == "" {
+		return errors.New("syslog address is required")
+	}
+	if config.Format != RFC5424 && config.Format != CEF {
+		return fmt.Errorf("unknown syslog format %d", int(config.Format))
+	}
+	if config.Facility < 0 || config.Facility > 23 {
+		return fmt.Errorf("syslog facility must be between 0 and 23, got %d", config.Facility)
+	}
+	if config.Timeout <= 0 {
+		return errors.New("syslog timeout must be positive")
+	}
+	return nil
+}
+
+// SyslogSink sends incidents to a syslog receiver. It is an output sink.
+// Messages are sent as datagrams over udp and unix datagram sockets. Over tcp and tls they are framed by
+// octet counting (RFC 6587, RFC 5425), over unix stream sockets they are terminated by a newline.
+// The sink connects on the first write and reconnects once when sending over a broken connection fails.
+type SyslogSink struct {
+	config   SyslogConfig
+	hostname string
+	procID   string
+	mu       sync.Mutex
+	conn     net.Conn // nil until connected, and after a failure
+	stream   bool     // The connection is a stream, so messages are framed
+}
+
+// NewSyslogSink creates a SyslogSink sending to the configured receiver.
+func NewSyslogSink(config SyslogConfig) (*SyslogSink, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	hostname := config.Hostname
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
+	if config.AppName == "" {
+		config.AppName = DefaultSyslogAppName
+	}
+	return &SyslogSink{config: config, hostname: hostname, procID: strconv.Itoa(os.Getpid())}, nil
+}
+
+// Write sends the incident as a syslog message.
+func (sink *SyslogSink) Write(incident *Incident) error {
+	message := sink.format(incident)
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+
+	reconnected := sink.conn == nil
+	err := sink.send(message)
+	if err != nil && !reconnected {
+		// the receiver may have closed an idle connection, retry on a new one
+		err = sink.send(message)
+	}
+	return err
+}
+
+// Close closes the connection to the receiver.
+func (sink *SyslogSink) Close() error {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+
+	if sink.conn == nil {
+		return nil
+	}
+	err := sink.conn.Close()
+	sink.conn = nil
+	return err
+}
+
+// send writes a message, connecting first if needed. The connection is dropped if it fails.
+func (sink *SyslogSink) send(message []byte) error {
+	if sink.conn == nil {
+		if err := sink.connect(); err != nil {
+			return fmt.Errorf("error connecting to syslog receiver %s: %w", sink.config.Address, err)
+		}
+	}
+
+	frame := message
+	if sink.stream && sink.config.Network == "unix" {
+		frame = append(message, '\n')
+	} else if sink.stream {
+		frame = append([]byte(strconv.Itoa(len(message))+" "), message...)
+	}
+
+	sink.conn.SetWriteDeadline(time.Now().Add(sink.config.Timeout))
+	if _, err := sink.conn.Write(frame); err != nil {
+		sink.conn.Close()
+		sink.conn = nil
+		return fmt.Errorf("error sending to syslog receiver %s: %w", sink.config.Address, err)
+	}
+	return nil
+}
+
+// connect dials the receiver. Unix sockets are tried as datagram sockets first, like /dev/log.
+func (sink *SyslogSink) connect() error {
+	dialer := &net.Dialer{Timeout: sink.config.Timeout}
+	var err error
+	switch sink.config.Network {
+	case "tls":
+		sink.conn, err = tls.DialWithDialer(dialer, "tcp", sink.config.Address, sink.config.TLS)
+		sink.stream = true
+	case "unix":
+		if sink.conn, err = dialer.Dial("unixgram", sink.config.Address); err != nil {
+			sink.conn, err = dialer.Dial("unix", sink.config.Address)
+			sink.stream = true
+		} else {
+			sink.stream = false
+		}
+	default:
+		sink.conn, err = dialer.Dial(sink.config.Network, sink.config.Address)
+		sink.stream = sink.config.Network == "tcp"
+	}
+	if err != nil {
+		sink.conn = nil
+	}
+	return err
+}
+
+// format returns the syslog message of the incident in the configured format.
+func (sink *SyslogSink) format(incident *Incident) []byte {
+	structuredData, message := "-", ""
+	switch sink.config.Format {
+	case CEF:
+		message = FormatCEF(incident)
+	default:
+		structuredData, message = structuredDataOf(incident), incidentMessage(incident)
+	}
+
+	timestamp := "-"
+	if !incident.Timestamp.IsZero() {
+		timestamp = incident.Timestamp.Format("2006-01-02T15:04:05.000000Z07:00")
+	}
+	priority := sink.config.Facility*8 + syslogSeverity(incident.Severity)
+	return []byte(fmt.Sprintf("<%d>1 %s %s %s %s %s %s %s", priority, timestamp,
+		headerField(sink.hostname, 255), headerField(sink.config.AppName, 48), headerField(sink.procID, 128),
+		headerField(incident.Type.Name(), 32), structuredData, message))
+}
+
+// syslogSeverity maps the severity of an incident to a syslog severity, from critical (2) to informational (6).
+func syslogSeverity(severity Severity) int {
+	switch severity {
+	case SeverityCritical:
+		return 2
+	case SeverityHigh:
+		return 3
+	case SeverityMedium:
+		return 4
+	case SeverityLow:
+		return 5
+	default:
+		return 6
+	}
+}
+
+// headerField returns a value usable as an RFC 5424 header field: printable ASCII without spaces, at most
+// maxLength characters, or "-" for an empty value.
+func headerField(value string, maxLength int) string {
+	field := strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return '_'
+		}
+		return r
+	}, value)
+	if field == "" {
+		return "-"
+	}
+	if len(field) > maxLength {
+		field = field[:maxLength]
+	}
+	return field
+}
+
+// incidentMessage returns the free-form message of an incident.
+func incidentMessage(incident *Incident) string {
+	if incident.Description != "" {
+		return incident.Description
+	}
+	return fmt.Sprintf("%s from %s", incident.Type, incident.IP)
+}
+
+// structuredDataOf returns the RFC 5424 structured data element describing the incident.
+func structuredDataOf(incident *Incident) string {
+	var element strings.Builder
+	fmt.Fprintf(&element, "[incident@%d", syslogEnterpriseID)
+	param := func(name, value string) {
+		if value == "" {
+			return
+		}
+		// '"', '\' and ']' must be escaped in parameter values
+		value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+		fmt.Fprintf(&element, ` %s="%s"`, name, value)
+	}
+
+	param("id", incident.ID)
+	param("type", incident.Type.Name())
+	param("severity", strings.ToLower(incident.Severity.String()))
+	param("confidence", strconv.FormatFloat(incident.Confidence, 'f', 2, 64))
+	param("rule", incident.Rule)
+	param("rule_version", incident.RuleVersion)
+	param("src", IPString(incident.IP))
+	if incident.SourcePrefix.IsValid() {
+		param("src_prefix", incident.SourcePrefix.String())
+	}
+	param("dst", IPString(incident.DstIP))
+	if incident.DstPort != 0 {
+		param("dst_port", strconv.Itoa(int(incident.DstPort)))
+	}
+	param("interface", incident.Interface)
+	param("count", strconv.Itoa(incident.Count))
+	if !incident.FirstSeen.IsZero() {
+		param("first_seen", incident.FirstSeen.Format(time.RFC3339Nano))
+		param("last_seen", incident.LastSeen.Format(time.RFC3339Nano))
+	}
+	for _, threshold := range incident.Thresholds {
+		param("threshold", formatThreshold(threshold))
+	}
+	for _, technique := range incident.Techniques {
+		param("technique", technique.ID)
+	}
+	element.WriteString("]")
+	return element.String()
+}
+
+// CEF escaping: '\' and '|' must be escaped in the header, '\', '=' and line breaks in extension values.
+var (
+	cefHeaderEscaper    = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\r", " ", "\n", " ")
+	cefExtensionEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r\n", `\n`, "\n", `\n`, "\r", `\r`)
+)
+
+// FormatCEF returns the incident as an ArcSight Common Event Format record.
+func FormatCEF(incident *Incident) string {
+	var extension []string
+	add := func(key, value string) {
+		if value != "" {
+			extension = append(extension, key+"="+cefExtensionEscaper.Replace(value))
+		}
+	}
+
+	if !incident.Timestamp.IsZero() {
+		add("rt", strconv.FormatInt(incident.Timestamp.UnixMilli(), 10))
+	}
+	add("externalId", incident.ID)
+	if incident.IP.To4() != nil {
+		add("src", incident.IP.String())
+	} else {
+		add("c6a2", IPString(incident.IP))
+	}
+	if incident.DstIP.To4() != nil {
+		add("dst", incident.DstIP.String())
+	} else {
+		add("c6a3", IPString(incident.DstIP))
+	}
+	if incident.DstPort != 0 {
+		add("dpt", strconv.Itoa(int(incident.DstPort)))
+	}
+	add("deviceInboundInterface", incident.Interface)
+	add("cnt", strconv.Itoa(incident.Count))
+	if !incident.FirstSeen.IsZero() {
+		add("start", strconv.FormatInt(incident.FirstSeen.UnixMilli(), 10))
+		add("end", strconv.FormatInt(incident.LastSeen.UnixMilli(), 10))
+	}
+	if incident.Rule != "" {
+		add("cs1Label", "rule")
+		add("cs1", incident.Rule)
+	}
+	if incident.RuleVersion != "" {
+		add("cs2Label", "ruleVersion")
+		add("cs2", incident.RuleVersion)
+	}
+	if len(incident.Techniques) > 0 {
+		ids := make([]string, len(incident.Techniques))
+		for i, technique := range incident.Techniques {
+			ids[i] = technique.ID
+		}
+		add("cs3Label", "attackTechniques")
+		add("cs3", strings.Join(ids, ","))
+	}
+	add("cfp1Label", "confidence")
+	add("cfp1", strconv.FormatFloat(incident.Confidence, 'f', 2, 64))
+	add("msg", incidentMessage(incident))
+
+	return fmt.Sprintf("CEF:0|%s|%s|%s|%s|%s|%d|%s", cefVendor, cefProduct, cefVersion,
+		cefHeaderEscaper.Replace(incident.Type.Name()), cefHeaderEscaper.Replace(incident.Type.String()),
+		cefSeverity(incident.Severity), strings.Join(extension, " "))
+}
+
+// cefSeverity maps the severity of an incident to the CEF severity scale from 0 to 10.
+func cefSeverity(severity Severity) int {
+	switch severity {
+	case SeverityCritical:
+		return 10
+	case SeverityHigh:
+		return 8
+	case SeverityMedium:
+		return 5
+	case SeverityLow:
+		return 3
+	default:
+		return 1
+	}
+}
+
+// formatThreshold describes an exceeded threshold, e.g. "packets 20 > 15 within 30s".
+func formatThreshold(threshold Threshold) string {
+	text := fmt.Sprintf("%s %d > %d", threshold.Name, threshold.Observed, threshold.Limit)
+	if threshold.Window > 0 {
+		text += " within " + threshold.Window.String()
+	}
+	return text
+}
@@ -0,0 +1,223 @@
+package loggers
+
+import (
+	. "awesomeProject/model"
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// syslogIncident returns an incident with characters every format has to escape in its rule and description.
+func syslogIncident(severity Severity) *Incident {
+	timestamp := time.Date(2024, 3, 1, 12, 30, 0, 123456000, time.UTC)
+	return &Incident{
+		ID:          "0123456789abcdef0123456789abcdef",
+		IP:          net.IPv4(192, 0, 2, 1),
+		Type:        PortScanning,
+		Timestamp:   timestamp,
+		Interface:   "eth0",
+		DstIP:       net.IPv4(192, 0, 2, 2),
+		DstPort:     22,
+		Rule:        `scan"rule\v1]`,
+		RuleVersion: "1.0",
+		Severity:    severity,
+		Confidence:  0.8,
+		Description: "20 ports=probed|fast\nin 1m",
+		Thresholds:  []Threshold{{Name: "ports", Limit: 10, Observed: 20, Window: time.Minute}},
+		Techniques:  PortScanning.Techniques(),
+		FirstSeen:   timestamp,
+		LastSeen:    timestamp.Add(time.Second),
+		Count:       3,
+	}
+}
+
+func TestSyslogSinkFormats(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  SyslogFormat
+		message string
+	}{
+		{
+			name:   "RFC 5424",
+			format: RFC5424,
+			message: `<131>1 2024-03-01T12:30:00.123456Z sensor_1 nids 42 port_scanning [incident@32473` +
+				` id="0123456789abcdef0123456789abcdef" type="port_scanning" severity="high" confidence="0.80"` +
+				` rule="scan\"rule\\v1\]" rule_version="1.0" src="192.0.2.1" dst="192.0.2.2" dst_port="22"` +
+				` interface="eth0" count="3" first_seen="2024-03-01T12:30:00.123456Z" last_seen="2024-03-01T12:30:01.123456Z"` +
+				` threshold="ports 20 > 10 within 1m0s" technique="T1046"] 20 ports=probed|fast` + "\nin 1m",
+		},
+		{
+			name:   "CEF",
+			format: CEF,
+			message: `<131>1 2024-03-01T12:30:00.123456Z sensor_1 nids 42 port_scanning - CEF:0|NIDS|NIDS|1.0|port_scanning|Port Scanning|8|` +
+				`rt=1709296200123 externalId=0123456789abcdef0123456789abcdef src=192.0.2.1 dst=192.0.2.2 dpt=22` +
+				` deviceInboundInterface=eth0 cnt=3 start=1709296200123 end=1709296201123 cs1Label=rule cs1=scan"rule\\v1]` +
+				` cs2Label=ruleVersion cs2=1.0 cs3Label=attackTechniques cs3=T1046 cfp1Label=confidence cfp1=0.80` +
+				` msg=20 ports\=probed|fast\nin 1m`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := DefaultSyslogConfig("udp", "127.0.0.1:514")
+			config.Format, config.Hostname = test.format, "sensor 1"
+			sink := newTestSyslogSink(t, config)
+			if got := string(sink.format(syslogIncident(SeverityHigh))); got != test.message {
+				t.Errorf("got message\n%s\nwant\n%s", got, test.message)
+			}
+		})
+	}
+}
+
+func TestSyslogPriority(t *testing.T) {
+	tests := []struct {
+		facility int
+		severity Severity
+		priority int
+	}{
+		{DefaultSyslogFacility, SeverityCritical, 130},
+		{DefaultSyslogFacility, SeverityHigh, 131},
+		{DefaultSyslogFacility, SeverityMedium, 132},
+		{DefaultSyslogFacility, SeverityLow, 133},
+		{DefaultSyslogFacility, SeverityInfo, 134},
+		{4, SeverityCritical, 34}, // auth
+		{23, SeverityInfo, 190},   // local7
+	}
+
+	for _, test := range tests {
+		config := DefaultSyslogConfig("udp", "127.0.0.1:514")
+		config.Facility = test.facility
+		message := string(newTestSyslogSink(t, config).format(syslogIncident(test.severity)))
+		if want := fmt.Sprintf("<%d>1 ", test.priority); !strings.HasPrefix(message, want) {
+			t.Errorf("facility %d, severity %s: message starts with %.8q, want %q", test.facility, test.severity, message, want)
+		}
+	}
+}
+
+func TestCEFEscaping(t *testing.T) {
+	tests := []struct {
+		value     string
+		header    string
+		extension string
+	}{
+		{`a|b`, `a\|b`, `a|b`},
+		{`a=b`, `a=b`, `a\=b`},
+		{`a\b`, `a\\b`, `a\\b`},
+		{"a\nb\r\nc\rd", "a b  c d", `a\nb\nc\rd`},
+	}
+
+	for _, test := range tests {
+		if got := cefHeaderEscaper.Replace(test.value); got != test.header {
+			t.Errorf("header field %q escaped to %q, want %q", test.value, got, test.header)
+		}
+		if got := cefExtensionEscaper.Replace(test.value); got != test.extension {
+			t.Errorf("extension value %q escaped to %q, want %q", test.value, got, test.extension)
+		}
+	}
+}
+
+func TestSyslogSinkOverUDP(t *testing.T) {
+	receiver, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer receiver.Close()
+
+	sink := newTestSyslogSink(t, DefaultSyslogConfig("udp", receiver.LocalAddr().String()))
+	defer sink.Close()
+	for _, severity := range []Severity{SeverityHigh, SeverityLow} {
+		incident := syslogIncident(severity)
+		if err := sink.Write(incident); err != nil {
+			t.Fatal(err)
+		}
+
+		buffer := make([]byte, 4096)
+		receiver.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := receiver.ReadFrom(buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := string(buffer[:n]), string(sink.format(incident)); got != want {
+			t.Errorf("received datagram\n%s\nwant\n%s", got, want)
+		}
+	}
+}
+
+func TestSyslogSinkOverTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	received := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go readFrames(conn, received)
+		}
+	}()
+
+	sink := newTestSyslogSink(t, DefaultSyslogConfig("tcp", listener.Addr().String()))
+	defer sink.Close()
+	incidents := []*Incident{syslogIncident(SeverityCritical), syslogIncident(SeverityMedium)}
+	for _, incident := range incidents {
+		if err := sink.Write(incident); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i, incident := range incidents {
+		select {
+		case frame := <-received:
+			if want := string(sink.format(incident)); frame != want {
+				t.Errorf("frame %d holds\n%s\nwant\n%s", i, frame, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("frame %d wasn't received", i)
+		}
+	}
+}
+
+// readFrames reads octet-counted frames (RFC 6587) from the connection until it is closed, sending each message
+// to received. A malformed frame is sent as an error message and ends the connection.
+func readFrames(conn net.Conn, received chan<- string) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		length, err := reader.ReadString(' ')
+		if err != nil {
+			return
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(length, " "))
+		if err != nil || n <= 0 {
+			received <- fmt.Sprintf("invalid frame length %q", length)
+			return
+		}
+		message := make([]byte, n)
+		if _, err := io.ReadFull(reader, message); err != nil {
+			received <- fmt.Sprintf("truncated frame: %v", err)
+			return
+		}
+		received <- string(message)
+	}
+}
+
+// newTestSyslogSink creates a sink with the process ID 42, so messages don't depend on the test process.
+func newTestSyslogSink(t *testing.T, config SyslogConfig) *SyslogSink {
+	t.Helper()
+	sink, err := NewSyslogSink(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.procID = "42"
+	return sink
+}
@@ -1,39 +1,127 @@
 package main
 
 import (
-	. "awesomeProject/alert_system"
-	. "awesomeProject/cmd"
-	. "awesomeProject/loggers"
-	. "awesomeProject/rules"
+	"awesomeProject/cmd"
+	"awesomeProject/config"
+	"context"
+	"flag"
 	"fmt"
 	"os"
-	"time"
+	"os/signal"
+	"strings"
+	"syscall"
 )
 
 func main() {
-	logFile, err := os.OpenFile("incidents.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
-	if err != nil {
-		fmt.Println("Error opening log file:", err)
+	configFile := flag.String("config", "", "JSON configuration file, the built-in defaults are used when empty")
+	device := flag.String("i", "en0", "comma separated network interfaces to capture from")
+	captureFile := flag.String("r", "", ".pcap/.pcapng file to replay instead of live interfaces")
+	filter := flag.String("f", "", "BPF filter expression, e.g. \"not port 22\"")
+	snapLen := flag.Int("snaplen", 1600, "number of bytes captured per packet on live interfaces")
+	promiscuous := flag.Bool("promisc", true, "capture in promiscuous mode on live interfaces")
+	workers := flag.Int("workers", 0, "number of packet processing workers (default: number of CPUs)")
+	queueDepth := flag.Int("queue-depth", 0, "number of packets each worker can queue (default 1000)")
+	dropPolicy := flag.String("drop-policy", "", "what to do when a worker queue is full: block, drop-newest or drop-oldest")
+	attackCoverage := flag.String("attack-coverage", "", "print the ATT&CK coverage matrix of the configured rules as csv or navigator (an ATT&CK Navigator layer) and exit")
+	flag.Parse()
+
+	cfg := config.Default()
+	var err error
+	if *configFile != "" {
+		if cfg, err = config.Load(*configFile); err != nil {
+			fmt.Println("Error loading config:", err)
+			return
+		}
+	}
+
+	if *attackCoverage != "" {
+		matrix := cfg.Coverage()
+		switch *attackCoverage {
+		case "csv":
+			err = matrix.WriteCSV(os.Stdout)
+		case "navigator":
+			err = matrix.WriteNavigatorLayer(os.Stdout, "NIDS coverage")
+		default:
+			err = fmt.Errorf("unknown format %q (expected csv or navigator)", *attackCoverage)
+		}
+		if err != nil {
+			fmt.Println("Error exporting ATT&CK coverage:", err)
+		}
 		return
 	}
-	defer logFile.Close()
 
-	device := "en0"                                // network interface
-	packetSniffer, err := NewPacketSniffer(device) // Change this to your network interface
+	// flags given on the command line override the configuration
+	setFlags := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { setFlags[f.Name] = true })
+
+	if setFlags["i"] {
+		cfg.Sensors = []config.SensorConfig{}
+		for _, name := range strings.Split(*device, ",") {
+			cfg.Sensors = append(cfg.Sensors, config.SensorConfig{Device: name})
+		}
+	}
+	if setFlags["r"] {
+		cfg.Sensors = []config.SensorConfig{{File: *captureFile}}
+	}
+	for i := range cfg.Sensors {
+		if setFlags["f"] {
+			cfg.Sensors[i].Filter = *filter
+		}
+		if setFlags["snaplen"] {
+			cfg.Sensors[i].SnapLen = *snapLen
+		}
+		if setFlags["promisc"] {
+			cfg.Sensors[i].Promiscuous = promiscuous
+		}
+	}
+	if setFlags["workers"] {
+		cfg.Pipeline.Workers = *workers
+	}
+	if setFlags["queue-depth"] {
+		cfg.Pipeline.QueueDepth = *queueDepth
+	}
+	if setFlags["drop-policy"] {
+		cfg.Pipeline.DropPolicy = *dropPolicy
+	}
+
+	nids, ruleSet, err := cfg.Build()
 	if err != nil {
-		fmt.Println("Error initializing packet sniffer:", err)
+		fmt.Println("Error initializing NIDS:", err)
 		return
 	}
+	defer nids.Close()
+
+	// SIGINT/SIGTERM cancel the context, which makes Start drain and shut down
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// the incident log is reopened on SIGHUP, so it can be rotated by logrotate
+	go reopenOnHangup(ctx, nids)
+
+	// rules are reloaded on SIGHUP or when the configuration file changes
+	if *configFile != "" {
+		go config.NewReloader(*configFile, cfg, nids, ruleSet).Run(ctx)
+	}
 
-	nids := NewNIDS(packetSniffer,
-		[]Rule{
-			NewPortScanningRule(10, 30*time.Second),
-			NewDDoSRule(15, 30*time.Second),
-			NewLargeVolumeRule(10, 30*time.Second), // Adjust thresholds as needed
-			NewHttpVulnerabilityRule(),
-		},
-		&IncidentLogger{LogFile: logFile},
-		&AlertSystem{})
+	if err := nids.Start(ctx); err != nil { // Start the NIDS
+		fmt.Println("Error running NIDS:", err)
+	}
+}
 
-	nids.Start() // Start the NIDS
+// reopenOnHangup reopens the files written by the NIDS on every SIGHUP until the context is cancelled.
+func reopenOnHangup(ctx context.Context, nids *cmd.NIDS) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			if err := nids.Reopen(); err != nil {
+				fmt.Println("Error reopening incident log:", err)
+			}
+		}
+	}
 }
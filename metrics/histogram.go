@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"math"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// LatencyBuckets are the upper bounds, in seconds, of histograms timing the work done per packet: 1µs to 100ms.
+var LatencyBuckets = []float64{
+	0.000001, 0.0000025, 0.000005, 0.00001, 0.000025, 0.00005,
+	0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.1,
+}
+
+// Histogram counts observations in buckets of increasing upper bounds.
+// It is safe for concurrent use and doesn't lock, so it can be observed on every packet.
+type Histogram struct {
+	bounds  []float64
+	counts  []atomic.Uint64 // Observations per bucket, the last one for values above every bound
+	sumBits atomic.Uint64   // Sum of the observations, as float64 bits
+}
+
+// NewHistogram returns a histogram with the given bucket upper bounds, which are sorted if needed.
+func NewHistogram(bounds []float64) *Histogram {
+	bounds = slices.Clone(bounds)
+	slices.Sort(bounds)
+	return &Histogram{bounds: bounds, counts: make([]atomic.Uint64, len(bounds)+1)}
+}
+
+// Observe adds a value to the histogram.
+func (histogram *Histogram) Observe(value float64) {
+	bucket, _ := slices.BinarySearch(histogram.bounds, value) // the first bound greater than or equal to the value
+	histogram.counts[bucket].Add(1)
+	for {
+		old := histogram.sumBits.Load()
+		if histogram.sumBits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+value)) {
+			break
+		}
+	}
+}
+
+// ObserveDuration adds a duration to the histogram in seconds.
+func (histogram *Histogram) ObserveDuration(duration time.Duration) {
+	histogram.Observe(duration.Seconds())
+}
+
+// AddTo adds the cumulative buckets, the sum and the count of the histogram to the family as one series
+// with the labels. The counters are read one after the other, so a scrape may be off by concurrent observations.
+func (histogram *Histogram) AddTo(family *Family, labels ...Label) {
+	cumulative := uint64(0)
+	for i := range histogram.counts {
+		cumulative += histogram.counts[i].Load()
+		bound := math.Inf(1)
+		if i < len(histogram.bounds) {
+			bound = histogram.bounds[i]
+		}
+		bucketLabels := append(slices.Clone(labels), Label{Name: "le", Value: formatValue(bound)})
+		family.Samples = append(family.Samples, Sample{Suffix: "_bucket", Labels: bucketLabels, Value: float64(cumulative)})
+	}
+	family.Samples = append(family.Samples,
+		Sample{Suffix: "_sum", Labels: labels, Value: math.Float64frombits(histogram.sumBits.Load())},
+		Sample{Suffix: "_count", Labels: labels, Value: float64(cumulative)},
+	)
+}
@@ -0,0 +1,148 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ContentType is the content type of the Prometheus text exposition format written by Write.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Type is the kind of a metric family.
+type Type int
+
+const (
+	CounterType   Type = iota // Only ever increases, e.g. captured packets
+	GaugeType                 // Goes up and down, e.g. queued packets
+	HistogramType             // Observations counted in buckets, e.g. latencies
+)
+
+// String method for better readability
+func (metricType Type) String() string {
+	switch metricType {
+	case CounterType:
+		return "counter"
+	case GaugeType:
+		return "gauge"
+	case HistogramType:
+		return "histogram"
+	default:
+		return "untyped"
+	}
+}
+
+// Label is a name and value pair telling apart the samples of a family, e.g. rule="ddos".
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample is a single value of a family. Histograms write several samples per series, told apart by their suffix.
+type Sample struct {
+	Suffix string // Appended to the family name, e.g. "_bucket"
+	Labels []Label
+	Value  float64
+}
+
+// Family is a named group of samples of the same type.
+type Family struct {
+	Name    string // e.g. "nids_packets_captured_total"
+	Help    string
+	Type    Type
+	Samples []Sample
+}
+
+// NewFamily returns an empty family.
+func NewFamily(name, help string, metricType Type) *Family {
+	return &Family{Name: name, Help: help, Type: metricType}
+}
+
+// Add adds a sample with the labels to the family.
+func (family *Family) Add(value float64, labels ...Label) {
+	family.Samples = append(family.Samples, Sample{Labels: labels, Value: value})
+}
+
+// Collector is implemented by components reporting metrics. Collect is called on every scrape.
+type Collector interface {
+	Collect() []*Family
+}
+
+// Write writes the families in the Prometheus text exposition format. Families without samples are skipped.
+func Write(w io.Writer, families []*Family) error {
+	buffered := bufio.NewWriter(w)
+	for _, family := range families {
+		if len(family.Samples) == 0 {
+			continue
+		}
+		fmt.Fprintf(buffered, "# HELP %s %s\n", family.Name, escapeHelp(family.Help))
+		fmt.Fprintf(buffered, "# TYPE %s %s\n", family.Name, family.Type)
+		for _, sample := range family.Samples {
+			buffered.WriteString(family.Name + sample.Suffix)
+			writeLabels(buffered, sample.Labels)
+			buffered.WriteString(" " + formatValue(sample.Value) + "\n")
+		}
+	}
+	return buffered.Flush()
+}
+
+// Handler returns an HTTP handler serving the metrics of the collectors.
+func Handler(collectors ...Collector) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		families := []*Family{}
+		for _, collector := range collectors {
+			families = append(families, collector.Collect()...)
+		}
+		w.Header().Set("Content-Type", ContentType)
+		if err := Write(w, families); err != nil {
+			fmt.Printf("Error writing metrics: %v\n", err)
+		}
+	})
+}
+
+// writeLabels writes the labels in braces, nothing if there are none.
+func writeLabels(w *bufio.Writer, labels []Label) {
+	if len(labels) == 0 {
+		return
+	}
+	w.WriteByte('{')
+	for i, label := range labels {
+		if i > 0 {
+			w.WriteByte(',')
+		}
+		w.WriteString(label.Name + `="` + escapeLabelValue(label.Value) + `"`)
+	}
+	w.WriteByte('}')
+}
+
+// formatValue formats a sample value, with the spelling of infinite and undefined values the format requires.
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
+
+// escapeHelp escapes backslashes and line feeds in help texts.
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
+
+// escapeLabelValue escapes backslashes, double quotes and line feeds in label values.
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
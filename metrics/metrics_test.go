@@ -0,0 +1,142 @@
+package metrics
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name     string
+		families []*Family
+		want     string
+	}{
+		{
+			name: "counter without labels",
+			families: []*Family{
+				{Name: "nids_packets_captured_total", Help: "Packets captured.", Type: CounterType, Samples: []Sample{{Value: 42}}},
+			},
+			want: "# HELP nids_packets_captured_total Packets captured.\n" +
+				"# TYPE nids_packets_captured_total counter\n" +
+				"nids_packets_captured_total 42\n",
+		},
+		{
+			name: "escaping",
+			families: []*Family{
+				{Name: "nids_rule_info", Help: "Rule\\version\nper rule.", Type: GaugeType, Samples: []Sample{
+					{Labels: []Label{{"rule", `C:\rules`}, {"version", `"2"`}}, Value: 1},
+					{Labels: []Label{{"rule", "multi\nline"}, {"version", ""}}, Value: 0.5},
+				}},
+			},
+			want: "# HELP nids_rule_info Rule\\\\version\\nper rule.\n" +
+				"# TYPE nids_rule_info gauge\n" +
+				`nids_rule_info{rule="C:\\rules",version="\"2\""} 1` + "\n" +
+				`nids_rule_info{rule="multi\nline",version=""} 0.5` + "\n",
+		},
+		{
+			name: "special values",
+			families: []*Family{
+				{Name: "nids_value", Help: "Value.", Type: GaugeType, Samples: []Sample{
+					{Labels: []Label{{"v", "+inf"}}, Value: math.Inf(1)},
+					{Labels: []Label{{"v", "-inf"}}, Value: math.Inf(-1)},
+					{Labels: []Label{{"v", "nan"}}, Value: math.NaN()},
+					{Labels: []Label{{"v", "small"}}, Value: 0.000001},
+					{Labels: []Label{{"v", "large"}}, Value: 12345678901},
+				}},
+			},
+			want: "# HELP nids_value Value.\n" +
+				"# TYPE nids_value gauge\n" +
+				`nids_value{v="+inf"} +Inf` + "\n" +
+				`nids_value{v="-inf"} -Inf` + "\n" +
+				`nids_value{v="nan"} NaN` + "\n" +
+				`nids_value{v="small"} 1e-06` + "\n" +
+				`nids_value{v="large"} 1.2345678901e+10` + "\n",
+		},
+		{
+			name: "empty families skipped",
+			families: []*Family{
+				NewFamily("nids_empty", "Nothing yet.", CounterType),
+				{Name: "nids_up", Help: "Up.", Type: GaugeType, Samples: []Sample{{Value: 1}}},
+				NewFamily("nids_empty_too", "Nothing yet.", HistogramType),
+			},
+			want: "# HELP nids_up Up.\n# TYPE nids_up gauge\nnids_up 1\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var out strings.Builder
+			if err := Write(&out, test.families); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != test.want {
+				t.Errorf("wrote\n%s\nwant\n%s", out.String(), test.want)
+			}
+		})
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	histogram := NewHistogram([]float64{1, 0.25, 0.5}) // sorted by NewHistogram
+	for _, value := range []float64{0.125, 0.25, 0.75, 4} {
+		histogram.Observe(value)
+	}
+	family := NewFamily("nids_latency_seconds", "Latency.", HistogramType)
+	histogram.AddTo(family, Label{"stage", "decode"})
+
+	var out strings.Builder
+	if err := Write(&out, []*Family{family}); err != nil {
+		t.Fatal(err)
+	}
+	want := "# HELP nids_latency_seconds Latency.\n" +
+		"# TYPE nids_latency_seconds histogram\n" +
+		`nids_latency_seconds_bucket{stage="decode",le="0.25"} 2` + "\n" + // bounds are inclusive
+		`nids_latency_seconds_bucket{stage="decode",le="0.5"} 2` + "\n" +
+		`nids_latency_seconds_bucket{stage="decode",le="1"} 3` + "\n" +
+		`nids_latency_seconds_bucket{stage="decode",le="+Inf"} 4` + "\n" +
+		`nids_latency_seconds_sum{stage="decode"} 5.125` + "\n" +
+		`nids_latency_seconds_count{stage="decode"} 4` + "\n"
+	if out.String() != want {
+		t.Errorf("wrote\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	handler := Handler(collectorFunc(func() []*Family {
+		family := NewFamily("nids_up", "Up.", GaugeType)
+		family.Add(1)
+		return []*Family{family}
+	}))
+
+	tests := []struct {
+		method string
+		status int
+		body   string
+	}{
+		{http.MethodGet, http.StatusOK, "# HELP nids_up Up.\n# TYPE nids_up gauge\nnids_up 1\n"},
+		{http.MethodPost, http.StatusMethodNotAllowed, "method not allowed\n"},
+	}
+
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(test.method, "/metrics", nil))
+
+		if recorder.Code != test.status || recorder.Body.String() != test.body {
+			t.Errorf("%s: got status %d with\n%s\nwant %d with\n%s", test.method, recorder.Code, recorder.Body, test.status, test.body)
+		}
+		if contentType := recorder.Header().Get("Content-Type"); test.status == http.StatusOK && contentType != ContentType {
+			t.Errorf("%s: got content type %q, want %q", test.method, contentType, ContentType)
+		}
+	}
+}
+
+// collectorFunc adapts a function to the Collector interface.
+type collectorFunc func() []*Family
+
+// Collect implementation according to Collector
+func (collect collectorFunc) Collect() []*Family {
+	return collect()
+}
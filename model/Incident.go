@@ -1,24 +1,64 @@
 package model
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"net"
+	"net/netip"
 	"time"
 )
 
 // Incident represents a security incident with associated details.
+// Besides the offending packet, it carries the metadata used to triage it: the rule that raised it,
+// severity, confidence, the thresholds that were exceeded and the ATT&CK techniques it indicates.
+// Repeated incidents of a rule can be merged into one, which then counts them and keeps a few sample packets.
 type Incident struct {
-	IP        net.IP       // The IP address related to the incident
-	Type      IncidentType // The type of incident
-	Timestamp time.Time    // The time when the incident occurred
-	Attempt   *Packet      // attempt
+	ID           string       // Unique identifier of the incident
+	IP           net.IP       // The IP address related to the incident
+	Type         IncidentType // The type of incident
+	Timestamp    time.Time    // The time when the incident occurred
+	Attempt      *Packet      // attempt
+	Interface    string       // The ingress interface of the offending traffic
+	SourcePrefix netip.Prefix // The source address or IPv6 prefix the rule counted the traffic under, if it aggregates
+	DstIP        net.IP       // Destination address of the offending traffic
+	DstPort      uint16       // Destination port of the offending traffic, 0 for protocols without ports
+	Rule         string       // Name of the rule that raised the incident
+	RuleVersion  string       // Version of the detection logic of the rule
+	Severity     Severity     // Harm the incident indicates
+	Confidence   float64      // Likelihood between 0 and 1 that the incident is not a false positive
+	Description  string       // Human-readable explanation of what was detected
+	Thresholds   []Threshold  // Limits exceeded by the traffic, empty for signature matches
+	Techniques   []Technique  // MITRE ATT&CK techniques the incident indicates
+	FirstSeen    time.Time    // Time of the first merged occurrence
+	LastSeen     time.Time    // Time of the last merged occurrence
+	Count        int          // Number of merged occurrences
+	Samples      []*Packet    // Packets of the first merged occurrences, starting with the attempt
 }
 
-// NewIncident is a constructor for creating a new Incident instance.
+// NewIncident is a constructor for creating a new Incident instance with a fresh ID.
+// The interface and destination are taken from the attempt packet.
 func NewIncident(ip net.IP, incidentType IncidentType, timestamp time.Time, attempt *Packet) *Incident {
-	return &Incident{
+	incident := &Incident{
+		ID:        NewIncidentID(),
 		IP:        ip,
 		Type:      incidentType,
 		Timestamp: timestamp,
 		Attempt:   attempt,
+		FirstSeen: timestamp,
+		LastSeen:  timestamp,
+		Count:     1,
 	}
+	if attempt != nil {
+		incident.Interface = attempt.Interface
+		incident.DstIP = attempt.DstIP
+		incident.DstPort = attempt.DstPort
+	}
+	return incident
+}
+
+// NewIncidentID returns a random 128-bit identifier in hexadecimal.
+func NewIncidentID() string {
+	var id [16]byte
+	rand.Read(id[:]) // never returns an error
+	return hex.EncodeToString(id[:])
 }
@@ -0,0 +1,54 @@
+package model
+
+import (
+	"net"
+	"net/netip"
+)
+
+// DefaultIPv6PrefixLength is the prefix IPv6 sources are aggregated by, the subnet size assigned to a single site.
+const DefaultIPv6PrefixLength = 64
+
+// IPString returns the text form of an address, empty for a missing one rather than the "<nil>" of net.IP.
+func IPString(ip net.IP) string {
+	if len(ip) == 0 {
+		return ""
+	}
+	return ip.String()
+}
+
+// AggregatePrefix returns the prefix the traffic of an address is counted under.
+// IPv6 addresses are masked to ipv6PrefixLength, as a host can rotate through the addresses of its subnet.
+// IPv4 addresses (including IPv4-mapped IPv6 addresses) and IPv6 addresses that don't identify a subnet of their
+// own (link-local, loopback, unspecified) are kept whole. A prefix length of 0 or 128 keeps every address whole.
+func AggregatePrefix(ip net.IP, ipv6PrefixLength int) netip.Prefix {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return netip.Prefix{}
+	}
+	addr = addr.Unmap()
+
+	if addr.Is4() || ipv6PrefixLength <= 0 || ipv6PrefixLength >= 128 ||
+		addr.IsLinkLocalUnicast() || addr.IsLoopback() || addr.IsUnspecified() {
+		return netip.PrefixFrom(addr, addr.BitLen())
+	}
+	prefix, _ := addr.Prefix(ipv6PrefixLength)
+	return prefix
+}
+
+// AggregationKey returns the map key rules count the traffic of an address under, see AggregatePrefix.
+// Link-local addresses are only unique on their link, so they are qualified by the ingress interface.
+func AggregationKey(ip net.IP, iface string, ipv6PrefixLength int) string {
+	prefix := AggregatePrefix(ip, ipv6PrefixLength)
+	if !prefix.IsValid() {
+		return ip.String()
+	}
+
+	addr := prefix.Addr()
+	if addr.IsLinkLocalUnicast() && addr.Is6() && iface != "" {
+		return addr.WithZone(iface).String()
+	}
+	if prefix.IsSingleIP() {
+		return addr.String()
+	}
+	return prefix.String()
+}
@@ -0,0 +1,44 @@
+package model
+
+import (
+	"net"
+	"testing"
+)
+
+func TestAggregationKey(t *testing.T) {
+	tests := []struct {
+		ip               string
+		iface            string
+		ipv6PrefixLength int
+		key              string
+		prefix           string
+	}{
+		{"192.0.2.1", "eth0", 64, "192.0.2.1", "192.0.2.1/32"},
+		{"::ffff:192.0.2.1", "eth0", 64, "192.0.2.1", "192.0.2.1/32"},
+		{"2001:db8:1:2:aaaa::1", "eth0", 64, "2001:db8:1:2::/64", "2001:db8:1:2::/64"},
+		{"2001:db8:1:2:aaaa::1", "eth0", 48, "2001:db8:1::/48", "2001:db8:1::/48"},
+		{"2001:db8:1:2:aaaa::1", "eth0", 128, "2001:db8:1:2:aaaa::1", "2001:db8:1:2:aaaa::1/128"},
+		{"2001:db8:1:2:aaaa::1", "eth0", 0, "2001:db8:1:2:aaaa::1", "2001:db8:1:2:aaaa::1/128"},
+		{"fe80::1", "eth0", 64, "fe80::1%eth0", "fe80::1/128"},
+		{"fe80::1", "", 64, "fe80::1", "fe80::1/128"},
+		{"::1", "lo", 64, "::1", "::1/128"},
+	}
+
+	for _, test := range tests {
+		ip := net.ParseIP(test.ip)
+		if got := AggregationKey(ip, test.iface, test.ipv6PrefixLength); got != test.key {
+			t.Errorf("AggregationKey(%s, %q, %d) = %s, want %s", test.ip, test.iface, test.ipv6PrefixLength, got, test.key)
+		}
+		if got := AggregatePrefix(ip, test.ipv6PrefixLength).String(); got != test.prefix {
+			t.Errorf("AggregatePrefix(%s, %d) = %s, want %s", test.ip, test.ipv6PrefixLength, got, test.prefix)
+		}
+	}
+}
+
+func TestIPString(t *testing.T) {
+	for ip, want := range map[string]string{"": "", "192.0.2.1": "192.0.2.1", "2001:db8::1": "2001:db8::1"} {
+		if got := IPString(net.ParseIP(ip)); got != want {
+			t.Errorf("IPString(%q) = %q, want %q", ip, got, want)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package model
+
+import "strings"
+
+// Technique is a MITRE ATT&CK technique, along with the tactic it serves in the incident.
+type Technique struct {
+	TacticID string // e.g. "TA0007"
+	Tactic   string // e.g. "Discovery"
+	ID       string // Technique ID, e.g. "T1046", sub-techniques are written as "T1498.001"
+	Name     string // Technique name, e.g. "Network Service Discovery"
+}
+
+// TacticShortName returns the tactic name as used by the ATT&CK Navigator, e.g. "initial-access".
+func (technique Technique) TacticShortName() string {
+	return strings.ReplaceAll(strings.ToLower(technique.Tactic), " ", "-")
+}
+
+// ATT&CK techniques referenced by the incident types.
+var (
+	networkServiceDiscovery = Technique{"TA0007", "Discovery", "T1046", "Network Service Discovery"}
+	directNetworkFlood      = Technique{"TA0040", "Impact", "T1498.001", "Network Denial of Service: Direct Network Flood"}
+	osExhaustionFlood       = Technique{"TA0040", "Impact", "T1499.001", "Endpoint Denial of Service: OS Exhaustion Flood"}
+	exfiltrationOverOther   = Technique{"TA0010", "Exfiltration", "T1048", "Exfiltration Over Alternative Protocol"}
+	exploitPublicFacingApp  = Technique{"TA0001", "Initial Access", "T1190", "Exploit Public-Facing Application"}
+	dataFromLocalSystem     = Technique{"TA0009", "Collection", "T1005", "Data from Local System"}
+	scriptingInterpreter    = Technique{"TA0002", "Execution", "T1059", "Command and Scripting Interpreter"}
+)
+
+// incidentTechniques maps the incident types to the techniques they indicate.
+// Fragment overlaps and tiny fragments evade inspection rather than serve a technique, so they aren't mapped.
+var incidentTechniques = map[IncidentType][]Technique{
+	PortScanning:       {networkServiceDiscovery},
+	DDoSAttack:         {directNetworkFlood},
+	LargeVolumeTraffic: {exfiltrationOverOther},
+	SQLInjection:       {exploitPublicFacingApp},
+	FileRead:           {exploitPublicFacingApp, dataFromLocalSystem},
+	CodeExecution:      {exploitPublicFacingApp, scriptingInterpreter},
+	FragmentFlood:      {osExhaustionFlood},
+}
+
+// Techniques returns the ATT&CK techniques the incident type indicates by default, nil if it isn't mapped.
+func (it IncidentType) Techniques() []Technique {
+	return incidentTechniques[it]
+}
@@ -0,0 +1,368 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IncidentSchemaVersion is the version of the JSON schema incidents are written with.
+//
+// Version 2 writes an object with the fields of incidentRecord. Enumerations are written as stable names
+// (incident types as in IncidentType.Name, severities in lowercase) or as the numbers of the protocol standards
+// (EtherTypes and IANA protocol numbers), so adding or reordering constants doesn't change logged incidents.
+// The offending packets are written as evidence, their payload base64 encoded. Fields without a value are omitted.
+//
+// Version 1 is the unversioned format logged before: the Go field names of Incident, the incident type as the
+// integer of its constant, the ports as strings and the whole frame as a string. It can still be read.
+const IncidentSchemaVersion = 2
+
+// incidentRecord is the JSON schema of an incident, version 2.
+type incidentRecord struct {
+	SchemaVersion int               `json:"schema_version"`          // Always 2
+	ID            string            `json:"id"`                      // 32 hexadecimal digits
+	Type          IncidentType      `json:"type"`                    // e.g. "port_scanning"
+	Timestamp     time.Time         `json:"timestamp"`               // RFC 3339 with nanoseconds
+	SrcIP         string            `json:"src_ip"`                  // The IP address related to the incident
+	SourcePrefix  string            `json:"source_prefix,omitempty"` // e.g. "2001:db8::/64"
+	DstIP         string            `json:"dst_ip,omitempty"`
+	DstPort       uint16            `json:"dst_port,omitempty"`
+	Interface     string            `json:"interface,omitempty"` // Ingress interface
+	Rule          string            `json:"rule,omitempty"`      // Name of the rule that raised the incident
+	RuleVersion   string            `json:"rule_version,omitempty"`
+	Severity      Severity          `json:"severity"`   // info, low, medium, high or critical
+	Confidence    float64           `json:"confidence"` // Between 0 and 1
+	Description   string            `json:"description,omitempty"`
+	Thresholds    []thresholdRecord `json:"thresholds,omitempty"`
+	Techniques    []techniqueRecord `json:"techniques,omitempty"` // MITRE ATT&CK techniques
+	FirstSeen     time.Time         `json:"first_seen"`           // First merged occurrence
+	LastSeen      time.Time         `json:"last_seen"`            // Last merged occurrence
+	Count         int               `json:"count"`                // Number of merged occurrences
+	Evidence      []packetRecord    `json:"evidence,omitempty"`   // The attempt followed by further samples
+}
+
+// thresholdRecord is the JSON schema of a Threshold.
+type thresholdRecord struct {
+	Name     string `json:"name"`
+	Limit    int    `json:"limit"`
+	Observed int    `json:"observed"`
+	Window   string `json:"window,omitempty"` // Go duration, e.g. "30s"
+}
+
+// techniqueRecord is the JSON schema of a Technique.
+type techniqueRecord struct {
+	TacticID string `json:"tactic_id"` // e.g. "TA0007"
+	Tactic   string `json:"tactic"`    // e.g. "Discovery"
+	ID       string `json:"id"`        // e.g. "T1046"
+	Name     string `json:"name"`      // e.g. "Network Service Discovery"
+}
+
+// packetRecord is the JSON schema of a Packet.
+type packetRecord struct {
+	Timestamp      time.Time `json:"timestamp"`
+	Interface      string    `json:"interface,omitempty"`
+	Network        uint16    `json:"network,omitempty"` // EtherType, e.g. 2048 for IPv4
+	SrcIP          string    `json:"src_ip,omitempty"`
+	DstIP          string    `json:"dst_ip,omitempty"`
+	Protocol       uint8     `json:"protocol,omitempty"` // IANA protocol number, e.g. 6 for TCP
+	SrcPort        uint16    `json:"src_port,omitempty"`
+	DstPort        uint16    `json:"dst_port,omitempty"`
+	TCPFlags       string    `json:"tcp_flags,omitempty"` // e.g. "SYN|ACK"
+	Seq            uint32    `json:"seq,omitempty"`
+	Ack            uint32    `json:"ack,omitempty"`
+	ICMPType       uint8     `json:"icmp_type,omitempty"`
+	ICMPCode       uint8     `json:"icmp_code,omitempty"`
+	ARPOperation   uint16    `json:"arp_operation,omitempty"`
+	SenderMAC      string    `json:"sender_mac,omitempty"`
+	TargetMAC      string    `json:"target_mac,omitempty"`
+	TTL            uint8     `json:"ttl,omitempty"`
+	IPID           uint32    `json:"ip_id,omitempty"`
+	FragmentOffset uint16    `json:"fragment_offset,omitempty"`
+	MoreFragments  bool      `json:"more_fragments,omitempty"`
+	DontFragment   bool      `json:"dont_fragment,omitempty"`
+	Extensions     []int     `json:"extensions,omitempty"` // IANA protocol numbers of the extension headers
+	Length         int       `json:"length"`
+	Payload        []byte    `json:"payload,omitempty"` // base64
+}
+
+// MarshalJSON writes the incident with the current schema version.
+func (incident *Incident) MarshalJSON() ([]byte, error) {
+	record := incidentRecord{
+		SchemaVersion: IncidentSchemaVersion,
+		ID:            incident.ID,
+		Type:          incident.Type,
+		Timestamp:     incident.Timestamp,
+		SrcIP:         IPString(incident.IP),
+		DstIP:         IPString(incident.DstIP),
+		DstPort:       incident.DstPort,
+		Interface:     incident.Interface,
+		Rule:          incident.Rule,
+		RuleVersion:   incident.RuleVersion,
+		Severity:      incident.Severity,
+		Confidence:    incident.Confidence,
+		Description:   incident.Description,
+		FirstSeen:     incident.FirstSeen,
+		LastSeen:      incident.LastSeen,
+		Count:         incident.Count,
+	}
+	if incident.SourcePrefix.IsValid() {
+		record.SourcePrefix = incident.SourcePrefix.String()
+	}
+	for _, threshold := range incident.Thresholds {
+		window := ""
+		if threshold.Window != 0 {
+			window = threshold.Window.String()
+		}
+		record.Thresholds = append(record.Thresholds, thresholdRecord{threshold.Name, threshold.Limit, threshold.Observed, window})
+	}
+	for _, technique := range incident.Techniques {
+		record.Techniques = append(record.Techniques, techniqueRecord(technique))
+	}
+
+	evidence := incident.Samples
+	if len(evidence) == 0 && incident.Attempt != nil {
+		evidence = []*Packet{incident.Attempt}
+	}
+	for _, packet := range evidence {
+		record.Evidence = append(record.Evidence, newPacketRecord(packet))
+	}
+	return json.Marshal(record)
+}
+
+// UnmarshalJSON reads an incident written with any schema version.
+// The first evidence packet becomes the attempt and all of them the samples.
+func (incident *Incident) UnmarshalJSON(data []byte) error {
+	var header struct {
+		SchemaVersion *int `json:"schema_version"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return err
+	}
+
+	switch {
+	case header.SchemaVersion == nil:
+		return incident.unmarshalVersion1(data)
+	case *header.SchemaVersion == 2:
+		return incident.unmarshalVersion2(data)
+	default:
+		return fmt.Errorf("unsupported incident schema version %d", *header.SchemaVersion)
+	}
+}
+
+// unmarshalVersion2 reads an incident of schema version 2.
+func (incident *Incident) unmarshalVersion2(data []byte) error {
+	var record incidentRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return err
+	}
+
+	decoded := Incident{
+		ID:          record.ID,
+		IP:          parseIP(record.SrcIP),
+		Type:        record.Type,
+		Timestamp:   record.Timestamp,
+		Interface:   record.Interface,
+		DstIP:       parseIP(record.DstIP),
+		DstPort:     record.DstPort,
+		Rule:        record.Rule,
+		RuleVersion: record.RuleVersion,
+		Severity:    record.Severity,
+		Confidence:  record.Confidence,
+		Description: record.Description,
+		FirstSeen:   record.FirstSeen,
+		LastSeen:    record.LastSeen,
+		Count:       record.Count,
+	}
+	if record.SourcePrefix != "" {
+		prefix, err := netip.ParsePrefix(record.SourcePrefix)
+		if err != nil {
+			return fmt.Errorf("invalid source_prefix: %w", err)
+		}
+		decoded.SourcePrefix = prefix
+	}
+	for _, threshold := range record.Thresholds {
+		var window time.Duration
+		if threshold.Window != "" {
+			var err error
+			if window, err = time.ParseDuration(threshold.Window); err != nil {
+				return fmt.Errorf("invalid threshold window: %w", err)
+			}
+		}
+		decoded.Thresholds = append(decoded.Thresholds, Threshold{threshold.Name, threshold.Limit, threshold.Observed, window})
+	}
+	for _, technique := range record.Techniques {
+		decoded.Techniques = append(decoded.Techniques, Technique(technique))
+	}
+	for _, evidence := range record.Evidence {
+		packet, err := evidence.packet()
+		if err != nil {
+			return err
+		}
+		decoded.Samples = append(decoded.Samples, packet)
+	}
+	if len(decoded.Samples) > 0 {
+		decoded.Attempt = decoded.Samples[0]
+	}
+
+	*incident = decoded
+	return nil
+}
+
+// legacyIncidentTypes lists the incident types in the order of their constants when schema version 1 was written.
+var legacyIncidentTypes = []IncidentType{PortScanning, DDoSAttack, LargeVolumeTraffic, SQLInjection, CodeExecution, FileRead}
+
+// unmarshalVersion1 reads an incident logged before the schema was versioned.
+// Only the fields of that format are read; the incident counts as a single occurrence with info severity.
+func (incident *Incident) unmarshalVersion1(data []byte) error {
+	var record struct {
+		IP        net.IP
+		Type      int
+		Timestamp time.Time
+		Attempt   *struct {
+			Timestamp time.Time
+			SrcIP     net.IP
+			SrcPort   string
+			DstIP     net.IP
+			DstPort   string
+			Length    int
+			Payload   string // The whole frame, converted to a string
+		}
+	}
+	if err := json.Unmarshal(data, &record); err != nil {
+		return err
+	}
+	if record.Type < 0 || record.Type >= len(legacyIncidentTypes) {
+		return fmt.Errorf("unknown version 1 incident type %d", record.Type)
+	}
+
+	decoded := NewIncident(record.IP, legacyIncidentTypes[record.Type], record.Timestamp, nil)
+	decoded.ID = "" // not part of version 1
+	if attempt := record.Attempt; attempt != nil {
+		srcPort, err := parseLegacyPort(attempt.SrcPort)
+		if err != nil {
+			return err
+		}
+		dstPort, err := parseLegacyPort(attempt.DstPort)
+		if err != nil {
+			return err
+		}
+		decoded.Attempt = &Packet{
+			Timestamp: attempt.Timestamp,
+			SrcIP:     attempt.SrcIP,
+			SrcPort:   srcPort,
+			DstIP:     attempt.DstIP,
+			DstPort:   dstPort,
+			Length:    attempt.Length,
+			Payload:   []byte(attempt.Payload),
+		}
+		decoded.DstIP, decoded.DstPort = attempt.DstIP, dstPort
+		decoded.Samples = []*Packet{decoded.Attempt}
+	}
+
+	*incident = *decoded
+	return nil
+}
+
+// parseLegacyPort parses a port of schema version 1, a number optionally followed by its service, e.g. "80(http)".
+func parseLegacyPort(text string) (uint16, error) {
+	if text == "" {
+		return 0, nil
+	}
+	number, _, _ := strings.Cut(text, "(")
+	port, err := strconv.ParseUint(number, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid version 1 port %q", text)
+	}
+	return uint16(port), nil
+}
+
+// newPacketRecord converts a packet to its JSON schema.
+func newPacketRecord(packet *Packet) packetRecord {
+	record := packetRecord{
+		Timestamp:      packet.Timestamp,
+		Interface:      packet.Interface,
+		Network:        uint16(packet.Network),
+		SrcIP:          IPString(packet.SrcIP),
+		DstIP:          IPString(packet.DstIP),
+		Protocol:       uint8(packet.Protocol),
+		SrcPort:        packet.SrcPort,
+		DstPort:        packet.DstPort,
+		TCPFlags:       packet.TCPFlags.String(),
+		Seq:            packet.Seq,
+		Ack:            packet.Ack,
+		ICMPType:       packet.ICMPType,
+		ICMPCode:       packet.ICMPCode,
+		ARPOperation:   uint16(packet.ARPOperation),
+		SenderMAC:      packet.SenderMAC.String(),
+		TargetMAC:      packet.TargetMAC.String(),
+		TTL:            packet.TTL,
+		IPID:           packet.IPID,
+		FragmentOffset: packet.FragmentOffset,
+		MoreFragments:  packet.MoreFragments,
+		DontFragment:   packet.DontFragment,
+		Length:         packet.Length,
+		Payload:        packet.Payload,
+	}
+	for _, extension := range packet.Extensions {
+		record.Extensions = append(record.Extensions, int(extension))
+	}
+	return record
+}
+
+// packet converts the JSON schema of a packet back to a packet.
+func (record packetRecord) packet() (*Packet, error) {
+	flags, err := ParseTCPFlags(record.TCPFlags)
+	if err != nil {
+		return nil, err
+	}
+	packet := &Packet{
+		Timestamp:      record.Timestamp,
+		Interface:      record.Interface,
+		Network:        NetworkProtocol(record.Network),
+		SrcIP:          parseIP(record.SrcIP),
+		DstIP:          parseIP(record.DstIP),
+		Protocol:       Protocol(record.Protocol),
+		SrcPort:        record.SrcPort,
+		DstPort:        record.DstPort,
+		TCPFlags:       flags,
+		Seq:            record.Seq,
+		Ack:            record.Ack,
+		ICMPType:       record.ICMPType,
+		ICMPCode:       record.ICMPCode,
+		ARPOperation:   ARPOperation(record.ARPOperation),
+		TTL:            record.TTL,
+		IPID:           record.IPID,
+		FragmentOffset: record.FragmentOffset,
+		MoreFragments:  record.MoreFragments,
+		DontFragment:   record.DontFragment,
+		Length:         record.Length,
+		Payload:        record.Payload,
+	}
+	for _, mac := range []struct {
+		text string
+		addr *net.HardwareAddr
+	}{{record.SenderMAC, &packet.SenderMAC}, {record.TargetMAC, &packet.TargetMAC}} {
+		if mac.text == "" {
+			continue
+		}
+		if *mac.addr, err = net.ParseMAC(mac.text); err != nil {
+			return nil, err
+		}
+	}
+	for _, extension := range record.Extensions {
+		packet.Extensions = append(packet.Extensions, Protocol(extension))
+	}
+	return packet, nil
+}
+
+// parseIP parses an address written by IPString.
+func parseIP(text string) net.IP {
+	if text == "" {
+		return nil
+	}
+	return net.ParseIP(text)
+}
@@ -0,0 +1,215 @@
+package model
+
+import (
+	"encoding/json"
+	"net"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIncidentSchemaVersion2RoundTrip(t *testing.T) {
+	timestamp := time.Date(2024, 3, 1, 12, 30, 0, 123456789, time.UTC)
+	attempt := &Packet{
+		Timestamp:      timestamp,
+		Interface:      "eth0",
+		Network:        NetworkIPv6,
+		SrcIP:          net.ParseIP("2001:db8::1"),
+		DstIP:          net.ParseIP("2001:db8::2"),
+		Protocol:       ProtocolTCP,
+		SrcPort:        40000,
+		DstPort:        443,
+		TCPFlags:       TCPFlagSYN | TCPFlagACK,
+		Seq:            1000,
+		Ack:            2000,
+		TTL:            64,
+		IPID:           7,
+		FragmentOffset: 1232,
+		MoreFragments:  true,
+		Extensions:     []Protocol{ProtocolIPv6HopByHop, ProtocolAH},
+		Length:         1294,
+		Payload:        []byte{0x00, 0xff, '"', '\n'},
+	}
+	arp := &Packet{
+		Timestamp:    timestamp.Add(time.Second),
+		Network:      NetworkARP,
+		SrcIP:        net.ParseIP("192.0.2.1"),
+		DstIP:        net.ParseIP("192.0.2.2"),
+		ARPOperation: ARPReply,
+		SenderMAC:    net.HardwareAddr{0x02, 0, 0, 0, 0, 1},
+		TargetMAC:    net.HardwareAddr{0x02, 0, 0, 0, 0, 2},
+		Length:       42,
+	}
+
+	tests := []struct {
+		name     string
+		incident *Incident
+		want     *Incident // Incident read back, the written one if nil
+		fields   []string  // Snippets the JSON has to contain
+	}{
+		{
+			name: "every field",
+			incident: &Incident{
+				ID:           "0123456789abcdef0123456789abcdef",
+				IP:           attempt.SrcIP,
+				Type:         PortScanning,
+				Timestamp:    timestamp,
+				Attempt:      attempt,
+				Interface:    "eth0",
+				SourcePrefix: netip.MustParsePrefix("2001:db8::/64"),
+				DstIP:        attempt.DstIP,
+				DstPort:      443,
+				Rule:         "port_scanning",
+				RuleVersion:  "2.1",
+				Severity:     SeverityHigh,
+				Confidence:   0.75,
+				Description:  "2001:db8::/64 probed 20 ports",
+				Thresholds:   []Threshold{{"ports", 10, 20, time.Minute}, {"bytes", 5, 6, 0}},
+				Techniques:   PortScanning.Techniques(),
+				FirstSeen:    timestamp,
+				LastSeen:     timestamp.Add(time.Second),
+				Count:        2,
+				Samples:      []*Packet{attempt, arp},
+			},
+			fields: []string{`"schema_version":2`, `"type":"port_scanning"`, `"severity":"high"`, `"tcp_flags":"SYN|ACK"`,
+				`"network":34525`, `"protocol":6`, `"extensions":[0,51]`, `"payload":"AP8iCg=="`, `"window":"1m0s"`,
+				`"sender_mac":"02:00:00:00:00:01"`},
+		},
+		{
+			name: "attempt without samples",
+			incident: &Incident{
+				ID:        "fedcba9876543210fedcba9876543210",
+				IP:        arp.SrcIP,
+				Type:      LargeVolumeTraffic,
+				Timestamp: timestamp,
+				Attempt:   arp,
+				Severity:  SeverityInfo,
+				FirstSeen: timestamp,
+				LastSeen:  timestamp,
+				Count:     1,
+			},
+			want: &Incident{
+				ID:        "fedcba9876543210fedcba9876543210",
+				IP:        arp.SrcIP,
+				Type:      LargeVolumeTraffic,
+				Timestamp: timestamp,
+				Attempt:   arp,
+				Severity:  SeverityInfo,
+				FirstSeen: timestamp,
+				LastSeen:  timestamp,
+				Count:     1,
+				Samples:   []*Packet{arp},
+			},
+			fields: []string{`"type":"large_volume_traffic"`, `"severity":"info"`, `"arp_operation":2`},
+		},
+		{
+			name: "no packets",
+			incident: &Incident{
+				ID:        "00000000000000000000000000000000",
+				IP:        net.ParseIP("192.0.2.1"),
+				Type:      DDoSAttack,
+				Timestamp: timestamp,
+				Severity:  SeverityCritical,
+				FirstSeen: timestamp,
+				LastSeen:  timestamp,
+				Count:     1,
+			},
+			fields: []string{`"type":"ddos_attack"`, `"src_ip":"192.0.2.1"`},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := json.Marshal(test.incident)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, field := range test.fields {
+				if !strings.Contains(string(data), field) {
+					t.Errorf("%s doesn't contain %s", data, field)
+				}
+			}
+
+			var decoded Incident
+			if err := json.Unmarshal(data, &decoded); err != nil {
+				t.Fatal(err)
+			}
+			want := test.want
+			if want == nil {
+				want = test.incident
+			}
+			if !reflect.DeepEqual(&decoded, want) {
+				t.Errorf("read back\n%+v\nwant\n%+v", decoded, *want)
+			}
+		})
+	}
+}
+
+func TestIncidentSchemaVersion1(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		want   *Incident
+		errMsg string
+	}{
+		{
+			name: "with attempt",
+			data: `{"IP":"10.0.0.1","Type":3,"Timestamp":"2023-05-01T10:00:00Z","Attempt":{"Timestamp":"2023-05-01T10:00:00Z",
+				"SrcIP":"10.0.0.1","SrcPort":"40000","DstIP":"10.0.0.2","DstPort":"80(http)","Length":60,"Payload":"GET /?id=1' OR '1'='1"}}`,
+			want: &Incident{
+				IP:        net.ParseIP("10.0.0.1"),
+				Type:      SQLInjection,
+				Timestamp: time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC),
+				DstIP:     net.ParseIP("10.0.0.2"),
+				DstPort:   80,
+				FirstSeen: time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC),
+				LastSeen:  time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC),
+				Count:     1,
+			},
+		},
+		{
+			name: "without attempt",
+			data: `{"IP":"10.0.0.1","Type":1,"Timestamp":"2023-05-01T10:00:00Z","Attempt":null}`,
+			want: &Incident{
+				IP:        net.ParseIP("10.0.0.1"),
+				Type:      DDoSAttack,
+				Timestamp: time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC),
+				FirstSeen: time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC),
+				LastSeen:  time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC),
+				Count:     1,
+			},
+		},
+		{name: "unknown type", data: `{"IP":"10.0.0.1","Type":6}`, errMsg: "unknown version 1 incident type 6"},
+		{name: "invalid port", data: `{"Type":0,"Attempt":{"SrcPort":"http"}}`, errMsg: `invalid version 1 port "http"`},
+		{name: "unsupported version", data: `{"schema_version":3}`, errMsg: "unsupported incident schema version 3"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var decoded Incident
+			err := json.Unmarshal([]byte(test.data), &decoded)
+			if test.errMsg != "" {
+				if err == nil || err.Error() != test.errMsg {
+					t.Fatalf("got error %v, want %q", err, test.errMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			attempt := decoded.Attempt
+			decoded.Attempt, decoded.Samples = nil, nil
+			if !reflect.DeepEqual(&decoded, test.want) {
+				t.Errorf("read\n%+v\nwant\n%+v", decoded, *test.want)
+			}
+			if test.want.DstIP != nil {
+				if attempt == nil || attempt.SrcPort != 40000 || attempt.DstPort != 80 || string(attempt.Payload) != "GET /?id=1' OR '1'='1" {
+					t.Errorf("read attempt %+v", attempt)
+				}
+			}
+		})
+	}
+}
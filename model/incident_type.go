@@ -1,5 +1,7 @@
 package model
 
+import "fmt"
+
 // Incident type enum
 type IncidentType int
 
@@ -10,6 +12,9 @@ const (
 	SQLInjection
 	CodeExecution
 	FileRead
+	FragmentOverlap // IP fragments overwriting each other
+	TinyFragment    // IP fragments too small to carry a transport header
+	FragmentFlood   // More IP fragments from a source than the defragmenter allows
 )
 
 // String method for better readability
@@ -27,7 +32,61 @@ func (it IncidentType) String() string {
 		return "Code Execution"
 	case FileRead:
 		return "File Read"
+	case FragmentOverlap:
+		return "Fragment Overlap"
+	case TinyFragment:
+		return "Tiny Fragment"
+	case FragmentFlood:
+		return "Fragment Flood"
 	default:
 		return "Unknown Incident"
 	}
 }
+
+// incidentTypeNames holds the names incident types are serialized with. They must never change,
+// as they give logged incidents their meaning independently of the order of the constants.
+var incidentTypeNames = map[IncidentType]string{
+	PortScanning:       "port_scanning",
+	DDoSAttack:         "ddos_attack",
+	LargeVolumeTraffic: "large_volume_traffic",
+	SQLInjection:       "sql_injection",
+	CodeExecution:      "code_execution",
+	FileRead:           "file_read",
+	FragmentOverlap:    "fragment_overlap",
+	TinyFragment:       "tiny_fragment",
+	FragmentFlood:      "fragment_flood",
+}
+
+// Name returns the stable name the incident type is serialized with, e.g. "port_scanning".
+func (it IncidentType) Name() string {
+	return incidentTypeNames[it]
+}
+
+// ParseIncidentType returns the incident type serialized with the given name.
+func ParseIncidentType(name string) (IncidentType, error) {
+	for incidentType, typeName := range incidentTypeNames {
+		if typeName == name {
+			return incidentType, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown incident type %q", name)
+}
+
+// MarshalText writes the incident type as its stable name, so it is serialized as a string in JSON.
+func (it IncidentType) MarshalText() ([]byte, error) {
+	name, ok := incidentTypeNames[it]
+	if !ok {
+		return nil, fmt.Errorf("incident type %d has no name", int(it))
+	}
+	return []byte(name), nil
+}
+
+// UnmarshalText parses the stable name of an incident type.
+func (it *IncidentType) UnmarshalText(text []byte) error {
+	incidentType, err := ParseIncidentType(string(text))
+	if err != nil {
+		return err
+	}
+	*it = incidentType
+	return nil
+}
@@ -1,17 +1,206 @@
 package model
 
 import (
+	"fmt"
 	"net"
+	"slices"
+	"strings"
 	"time"
 )
 
 // Packet represents a network packet.
+// Its Payload holds the application data of TCP, UDP and SCTP, the data following type, code and checksum of ICMP
+// messages and the data following the IP header for other protocols. IP fragments carry their raw IP payload.
 type Packet struct {
-	Timestamp time.Time
-	SrcIP     net.IP
-	SrcPort   string
-	DstIP     net.IP
-	DstPort   string
-	Length    int
-	Payload   string
+	Timestamp      time.Time
+	Interface      string           // Ingress interface the packet was captured on
+	Network        NetworkProtocol  // IPv4, IPv6 or ARP
+	SrcIP          net.IP           // Source address, the sender protocol address of ARP packets
+	DstIP          net.IP           // Destination address, the target protocol address of ARP packets
+	Protocol       Protocol         // Protocol following the IP header and its extensions, unset for ARP
+	SrcPort        uint16           // TCP/UDP/SCTP source port, 0 for other protocols
+	DstPort        uint16           // TCP/UDP/SCTP destination port, 0 for other protocols
+	TCPFlags       TCPFlags         // Flags of TCP segments
+	Seq            uint32           // TCP sequence number
+	Ack            uint32           // TCP acknowledgment number
+	ICMPType       uint8            // ICMPv4/ICMPv6 message type
+	ICMPCode       uint8            // ICMPv4/ICMPv6 message code
+	ARPOperation   ARPOperation     // Operation of ARP packets
+	SenderMAC      net.HardwareAddr // ARP sender hardware address
+	TargetMAC      net.HardwareAddr // ARP target hardware address
+	TTL            uint8            // IPv4 time to live or IPv6 hop limit
+	IPID           uint32           // IPv4 identification, or identification of the IPv6 fragment header
+	FragmentOffset uint16           // Offset of the fragment in the original datagram, in bytes
+	MoreFragments  bool             // More fragments of the datagram follow this one
+	DontFragment   bool             // IPv4 don't fragment flag
+	Extensions     []Protocol       // IPv6 extension headers and IPsec AH between the IP and the transport header, in order
+	Length         int              // Length of the full frame on the wire
+	Payload        []byte           // Data following the protocol headers
+}
+
+// Clone returns a deep copy of the packet which is not part of the packet pool.
+func (packet *Packet) Clone() *Packet {
+	clone := *packet
+	clone.SrcIP = append(net.IP(nil), packet.SrcIP...)
+	clone.DstIP = append(net.IP(nil), packet.DstIP...)
+	clone.Payload = append([]byte(nil), packet.Payload...)
+	clone.Extensions = append([]Protocol(nil), packet.Extensions...)
+	clone.SenderMAC = append(net.HardwareAddr(nil), packet.SenderMAC...)
+	clone.TargetMAC = append(net.HardwareAddr(nil), packet.TargetMAC...)
+	return &clone
+}
+
+// HasPorts reports whether the packet belongs to a transport protocol addressing ports.
+func (packet *Packet) HasPorts() bool {
+	if packet.Network == NetworkARP {
+		return false
+	}
+	return packet.Protocol == ProtocolTCP || packet.Protocol == ProtocolUDP || packet.Protocol == ProtocolSCTP
+}
+
+// IsFragment reports whether the packet is a fragment of a larger IP datagram.
+func (packet *Packet) IsFragment() bool {
+	return packet.MoreFragments || packet.FragmentOffset > 0
+}
+
+// NetworkProtocol identifies the network protocol of a packet by its EtherType.
+type NetworkProtocol uint16
+
+const (
+	NetworkIPv4 NetworkProtocol = 0x0800
+	NetworkARP  NetworkProtocol = 0x0806
+	NetworkIPv6 NetworkProtocol = 0x86DD
+)
+
+// String method for better readability
+func (network NetworkProtocol) String() string {
+	switch network {
+	case NetworkIPv4:
+		return "IPv4"
+	case NetworkARP:
+		return "ARP"
+	case NetworkIPv6:
+		return "IPv6"
+	default:
+		return "Unknown Network Protocol"
+	}
+}
+
+// ARPOperation is the operation of an ARP packet.
+type ARPOperation uint16
+
+const (
+	ARPRequest ARPOperation = 1
+	ARPReply   ARPOperation = 2
+)
+
+// String method for better readability
+func (operation ARPOperation) String() string {
+	switch operation {
+	case ARPRequest:
+		return "Request"
+	case ARPReply:
+		return "Reply"
+	default:
+		return "Unknown Operation"
+	}
+}
+
+// Protocol identifies the protocol carried by IP, a transport protocol or an extension header, by its IANA number.
+type Protocol uint8
+
+const (
+	ProtocolIPv6HopByHop     Protocol = 0
+	ProtocolICMPv4           Protocol = 1
+	ProtocolTCP              Protocol = 6
+	ProtocolUDP              Protocol = 17
+	ProtocolIPv6Routing      Protocol = 43
+	ProtocolIPv6Fragment     Protocol = 44
+	ProtocolESP              Protocol = 50
+	ProtocolAH               Protocol = 51
+	ProtocolICMPv6           Protocol = 58
+	ProtocolIPv6NoNextHeader Protocol = 59
+	ProtocolIPv6Destination  Protocol = 60
+	ProtocolSCTP             Protocol = 132
+)
+
+// String method for better readability
+func (protocol Protocol) String() string {
+	switch protocol {
+	case ProtocolIPv6HopByHop:
+		return "IPv6 Hop-by-Hop"
+	case ProtocolICMPv4:
+		return "ICMPv4"
+	case ProtocolTCP:
+		return "TCP"
+	case ProtocolUDP:
+		return "UDP"
+	case ProtocolIPv6Routing:
+		return "IPv6 Routing"
+	case ProtocolIPv6Fragment:
+		return "IPv6 Fragment"
+	case ProtocolESP:
+		return "ESP"
+	case ProtocolAH:
+		return "AH"
+	case ProtocolICMPv6:
+		return "ICMPv6"
+	case ProtocolIPv6NoNextHeader:
+		return "IPv6 No Next Header"
+	case ProtocolIPv6Destination:
+		return "IPv6 Destination Options"
+	case ProtocolSCTP:
+		return "SCTP"
+	default:
+		return "Unknown Protocol"
+	}
+}
+
+// TCPFlags is the set of control flags of a TCP segment.
+type TCPFlags uint8
+
+const (
+	TCPFlagFIN TCPFlags = 1 << iota
+	TCPFlagSYN
+	TCPFlagRST
+	TCPFlagPSH
+	TCPFlagACK
+	TCPFlagURG
+	TCPFlagECE
+	TCPFlagCWR
+)
+
+// tcpFlagNames lists the flag names in the order of their bits.
+var tcpFlagNames = []string{"FIN", "SYN", "RST", "PSH", "ACK", "URG", "ECE", "CWR"}
+
+// Has reports whether all the given flags are set.
+func (flags TCPFlags) Has(flag TCPFlags) bool {
+	return flags&flag == flag
+}
+
+// ParseTCPFlags parses flags written by TCPFlags.String.
+func ParseTCPFlags(text string) (TCPFlags, error) {
+	var flags TCPFlags
+	if text == "" {
+		return flags, nil
+	}
+	for _, name := range strings.Split(text, "|") {
+		bit := slices.Index(tcpFlagNames, name)
+		if bit < 0 {
+			return 0, fmt.Errorf("unknown TCP flag %q", name)
+		}
+		flags |= 1 << bit
+	}
+	return flags, nil
+}
+
+// String returns the set flags separated by "|", e.g. "SYN|ACK".
+func (flags TCPFlags) String() string {
+	names := []string{}
+	for bit, name := range tcpFlagNames {
+		if flags&(1<<bit) != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, "|")
 }
@@ -0,0 +1,27 @@
+package model
+
+import "sync"
+
+// packetPool recycles Packets together with their address, extension header and payload buffers.
+var packetPool = sync.Pool{
+	New: func() any { return &Packet{} },
+}
+
+// AcquirePacket returns an empty Packet, reusing the buffers of a released one when possible.
+func AcquirePacket() *Packet {
+	return packetPool.Get().(*Packet)
+}
+
+// ReleasePacket returns a packet to the pool once nothing references it anymore.
+// Packets attached to an incident must not be released.
+func ReleasePacket(packet *Packet) {
+	*packet = Packet{
+		SrcIP:      packet.SrcIP[:0],
+		DstIP:      packet.DstIP[:0],
+		Extensions: packet.Extensions[:0],
+		SenderMAC:  packet.SenderMAC[:0],
+		TargetMAC:  packet.TargetMAC[:0],
+		Payload:    packet.Payload[:0],
+	}
+	packetPool.Put(packet)
+}
@@ -0,0 +1,63 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Severity ranks incidents by the harm they indicate, from SeverityInfo to SeverityCritical.
+type Severity int
+
+const (
+	SeverityInfo     Severity = iota // 0
+	SeverityLow                      // 1
+	SeverityMedium                   // 2
+	SeverityHigh                     // 3
+	SeverityCritical                 // 4
+)
+
+// String method for better readability
+func (severity Severity) String() string {
+	switch severity {
+	case SeverityInfo:
+		return "Info"
+	case SeverityLow:
+		return "Low"
+	case SeverityMedium:
+		return "Medium"
+	case SeverityHigh:
+		return "High"
+	case SeverityCritical:
+		return "Critical"
+	default:
+		return "Unknown Severity"
+	}
+}
+
+// MarshalText writes the severity as its lowercase name, e.g. "high".
+func (severity Severity) MarshalText() ([]byte, error) {
+	if severity < SeverityInfo || severity > SeverityCritical {
+		return nil, fmt.Errorf("unknown severity %d", int(severity))
+	}
+	return []byte(strings.ToLower(severity.String())), nil
+}
+
+// UnmarshalText parses the name of a severity, ignoring case.
+func (severity *Severity) UnmarshalText(text []byte) error {
+	for candidate := SeverityInfo; candidate <= SeverityCritical; candidate++ {
+		if strings.EqualFold(candidate.String(), string(text)) {
+			*severity = candidate
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown severity %q", text)
+}
+
+// Threshold is a limit a rule compares the traffic against, along with the value that exceeded it.
+type Threshold struct {
+	Name     string        // What is limited, e.g. "packets" or "ports"
+	Limit    int           // Highest value allowed
+	Observed int           // Value observed when the incident was raised
+	Window   time.Duration // Time window the value is counted over, 0 if it isn't
+}
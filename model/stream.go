@@ -0,0 +1,60 @@
+package model
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+)
+
+// StreamKey identifies one direction of a TCP connection.
+type StreamKey struct {
+	Src netip.AddrPort
+	Dst netip.AddrPort
+}
+
+// StreamKeyOf returns the key of the direction of the connection the packet travels in.
+func StreamKeyOf(packet *Packet) StreamKey {
+	src, _ := netip.AddrFromSlice(packet.SrcIP)
+	dst, _ := netip.AddrFromSlice(packet.DstIP)
+	return StreamKey{
+		Src: netip.AddrPortFrom(src.Unmap(), packet.SrcPort),
+		Dst: netip.AddrPortFrom(dst.Unmap(), packet.DstPort),
+	}
+}
+
+// Reverse returns the key of the opposite direction of the connection.
+func (key StreamKey) Reverse() StreamKey {
+	return StreamKey{Src: key.Dst, Dst: key.Src}
+}
+
+// String method for better readability
+func (key StreamKey) String() string {
+	return fmt.Sprintf("%s -> %s", key.Src, key.Dst)
+}
+
+// StreamData is a chunk of reassembled, in-order data of one direction of a TCP connection.
+type StreamData struct {
+	Key       StreamKey
+	Interface string    // Ingress interface of the connection
+	Timestamp time.Time // Capture time of the latest segment contributing to Data
+	Data      []byte    // Newly reassembled bytes, only valid during the call they are passed to
+	Offset    uint64    // Position of Data in the stream
+	Skipped   int       // Bytes missing right before Data, -1 if the start of the stream was never captured
+}
+
+// Packet returns a packet describing the stream data, used as the attempt of incidents found in streams.
+// The payload is a copy of Data.
+func (stream *StreamData) Packet() *Packet {
+	return &Packet{
+		Timestamp: stream.Timestamp,
+		Interface: stream.Interface,
+		SrcIP:     net.IP(stream.Key.Src.Addr().AsSlice()),
+		DstIP:     net.IP(stream.Key.Dst.Addr().AsSlice()),
+		Protocol:  ProtocolTCP,
+		SrcPort:   stream.Key.Src.Port(),
+		DstPort:   stream.Key.Dst.Port(),
+		Length:    len(stream.Data),
+		Payload:   append([]byte(nil), stream.Data...),
+	}
+}
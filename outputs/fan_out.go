@@ -0,0 +1,217 @@
+package outputs
+
+import (
+	. "awesomeProject/model"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultQueueSize is the number of incidents buffered for an asynchronous sink by default.
+const DefaultQueueSize = 1000
+
+// ErrQueueFull is reported for the incidents an asynchronous sink drops because its queue is full.
+var ErrQueueFull = errors.New("output queue is full")
+
+// ErrorHandler is told about the incidents a sink failed to receive.
+type ErrorHandler func(output string, incident *Incident, err error)
+
+// PrintError is the default ErrorHandler, it prints the error.
+func PrintError(output string, incident *Incident, err error) {
+	fmt.Printf("Error writing incident %s to %s: %v\n", incident.ID, output, err)
+}
+
+// Output is a sink along with the incidents it receives and how they are handed to it.
+type Output struct {
+	Name      string // Identifies the sink in error reports and statistics
+	Sink      Sink
+	Filter    Filter
+	QueueSize int // Incidents buffered for a sink written by its own goroutine, 0 writes synchronously
+}
+
+// OutputStats counts what happened to the incidents handed to an output.
+type OutputStats struct {
+	Name    string
+	Written uint64 // Incidents the sink received
+	Dropped uint64 // Incidents dropped because the queue was full
+	Failed  uint64 // Incidents the sink returned an error for
+	Queued  int    // Incidents waiting in the queue
+}
+
+// FanOut hands every incident to the outputs whose filter it matches. Slow sinks can be decoupled with a queue,
+// so they don't hold up packet processing; when their queue is full, incidents are dropped and reported.
+// Failures of a sink are reported to the error handler and don't affect the other sinks.
+// FanOut is itself a Sink and is safe for concurrent use.
+type FanOut struct {
+	outputs []*output
+	onError ErrorHandler
+}
+
+// output is an Output with its queue and counters.
+type output struct {
+	Output
+	mu      sync.Mutex  // Serializes the writes of synchronous outputs
+	queue   chan queued // nil for synchronous outputs
+	stopped chan struct{}
+	written atomic.Uint64
+	dropped atomic.Uint64
+	failed  atomic.Uint64
+}
+
+// queued is an incident waiting for an asynchronous sink, or a flush request if flushed is set.
+type queued struct {
+	incident *Incident
+	flushed  chan error
+}
+
+// NewFanOut creates a FanOut to the given outputs printing the errors of the sinks.
+func NewFanOut(outputs ...Output) *FanOut {
+	return NewFanOutWithErrorHandler(PrintError, outputs...)
+}
+
+// NewFanOutWithErrorHandler creates a FanOut to the given outputs reporting the errors of the sinks to onError.
+// Asynchronous outputs start writing right away.
+func NewFanOutWithErrorHandler(onError ErrorHandler, outputs ...Output) *FanOut {
+	fanOut := &FanOut{onError: onError}
+	for _, config := range outputs {
+		out := &output{Output: config}
+		if config.QueueSize > 0 {
+			out.queue = make(chan queued, config.QueueSize)
+			out.stopped = make(chan struct{})
+			go fanOut.run(out)
+		}
+		fanOut.outputs = append(fanOut.outputs, out)
+	}
+	return fanOut
+}
+
+// Write hands the incident to every output it matches the filter of.
+// Errors are reported to the error handler, so it always returns nil.
+func (fanOut *FanOut) Write(incident *Incident) error {
+	for _, out := range fanOut.outputs {
+		if !out.Filter.Matches(incident) {
+			continue
+		}
+		if out.queue == nil {
+			out.mu.Lock()
+			fanOut.write(out, incident)
+			out.mu.Unlock()
+			continue
+		}
+
+		select {
+		case out.queue <- queued{incident: incident}:
+		default:
+			out.dropped.Add(1)
+			fanOut.onError(out.Name, incident, ErrQueueFull)
+		}
+	}
+	return nil
+}
+
+// Flush waits until the queued incidents were written and flushes the sinks implementing Flusher.
+func (fanOut *FanOut) Flush() error {
+	var errs []error
+	for _, out := range fanOut.outputs {
+		var err error
+		if out.queue == nil {
+			out.mu.Lock()
+			err = flush(out.Sink)
+			out.mu.Unlock()
+		} else {
+			flushed := make(chan error, 1)
+			out.queue <- queued{flushed: flushed}
+			err = <-flushed
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error flushing %s: %w", out.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Reopen reopens the files of the sinks implementing Reopener.
+func (fanOut *FanOut) Reopen() error {
+	var errs []error
+	for _, out := range fanOut.outputs {
+		reopener, ok := out.Sink.(Reopener)
+		if !ok {
+			continue
+		}
+		if out.queue == nil {
+			out.mu.Lock()
+		}
+		if err := reopener.Reopen(); err != nil {
+			errs = append(errs, fmt.Errorf("error reopening %s: %w", out.Name, err))
+		}
+		if out.queue == nil {
+			out.mu.Unlock()
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close writes the queued incidents and closes the sinks implementing io.Closer.
+// Write must not be called anymore afterwards.
+func (fanOut *FanOut) Close() error {
+	var errs []error
+	for _, out := range fanOut.outputs {
+		if out.queue != nil {
+			close(out.queue)
+			<-out.stopped
+		}
+		if closer, ok := out.Sink.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("error closing %s: %w", out.Name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Stats returns the statistics of every output, in the order the outputs were given.
+func (fanOut *FanOut) Stats() []OutputStats {
+	stats := make([]OutputStats, len(fanOut.outputs))
+	for i, out := range fanOut.outputs {
+		stats[i] = OutputStats{
+			Name:    out.Name,
+			Written: out.written.Load(),
+			Dropped: out.dropped.Load(),
+			Failed:  out.failed.Load(),
+			Queued:  len(out.queue),
+		}
+	}
+	return stats
+}
+
+// run writes the queued incidents of an asynchronous output until its queue is closed.
+func (fanOut *FanOut) run(out *output) {
+	defer close(out.stopped)
+	for item := range out.queue {
+		if item.flushed != nil {
+			item.flushed <- flush(out.Sink)
+			continue
+		}
+		fanOut.write(out, item.incident)
+	}
+}
+
+// write hands the incident to the sink of the output and reports a failure.
+func (fanOut *FanOut) write(out *output, incident *Incident) {
+	if err := out.Sink.Write(incident); err != nil {
+		out.failed.Add(1)
+		fanOut.onError(out.Name, incident, err)
+		return
+	}
+	out.written.Add(1)
+}
+
+// flush flushes the sink if it buffers incidents.
+func flush(sink Sink) error {
+	if flusher, ok := sink.(Flusher); ok {
+		return flusher.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package outputs
+
+import (
+	. "awesomeProject/model"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFanOutFiltersIncidents(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []string // Descriptions of the incidents received
+	}{
+		{"every incident", Filter{}, []string{"low scan", "high scan", "critical flood"}},
+		{"min severity", Filter{MinSeverity: SeverityHigh}, []string{"high scan", "critical flood"}},
+		{"types", Filter{Types: []IncidentType{DDoSAttack, SQLInjection}}, []string{"critical flood"}},
+		{"min severity and types", Filter{MinSeverity: SeverityHigh, Types: []IncidentType{PortScanning}}, []string{"high scan"}},
+	}
+
+	for _, test := range tests {
+		for _, queueSize := range []int{0, 10} {
+			t.Run(fmt.Sprintf("%s, queue size %d", test.name, queueSize), func(t *testing.T) {
+				sink := &recordingSink{}
+				fanOut := NewFanOut(Output{Name: "sink", Sink: sink, Filter: test.filter, QueueSize: queueSize})
+				fanOut.Write(newIncident(PortScanning, SeverityLow, "low scan"))
+				fanOut.Write(newIncident(PortScanning, SeverityHigh, "high scan"))
+				fanOut.Write(newIncident(DDoSAttack, SeverityCritical, "critical flood"))
+				if err := fanOut.Close(); err != nil {
+					t.Fatal(err)
+				}
+
+				if got := sink.descriptions(); !slices.Equal(got, test.want) {
+					t.Errorf("received %v, want %v", got, test.want)
+				}
+				if !sink.closed {
+					t.Errorf("sink wasn't closed")
+				}
+			})
+		}
+	}
+}
+
+func TestFanOutQueues(t *testing.T) {
+	tests := []struct {
+		name      string
+		queueSize int
+		incidents int
+		written   uint64 // Written while the sink is blocked
+		dropped   uint64
+	}{
+		{name: "synchronous", queueSize: 0, incidents: 5, written: 5},
+		{name: "queue with room", queueSize: 5, incidents: 5, written: 0},
+		{name: "full queue", queueSize: 2, incidents: 5, written: 0, dropped: 2}, // one is held by the blocked sink
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sink := &recordingSink{}
+			blocked := &recordingSink{release: make(chan struct{}), received: make(chan struct{}, test.incidents)}
+			errs := []error{}
+			var errsMu sync.Mutex
+			fanOut := NewFanOutWithErrorHandler(func(output string, incident *Incident, err error) {
+				errsMu.Lock()
+				defer errsMu.Unlock()
+				errs = append(errs, err)
+			}, Output{Name: "sink", Sink: sink}, Output{Name: "blocked", Sink: blocked, QueueSize: test.queueSize})
+
+			if test.queueSize > 0 {
+				// the first incident is taken off the queue by the blocked sink
+				fanOut.Write(newIncident(PortScanning, SeverityLow, "0"))
+				<-blocked.received
+				for i := 1; i < test.incidents; i++ {
+					fanOut.Write(newIncident(PortScanning, SeverityLow, "incident"))
+				}
+			} else {
+				close(blocked.release)
+				for i := 0; i < test.incidents; i++ {
+					fanOut.Write(newIncident(PortScanning, SeverityLow, "incident"))
+				}
+			}
+
+			stats := fanOut.Stats()
+			if stats[0].Written != uint64(test.incidents) {
+				t.Errorf("unblocked sink received %d incidents, want %d", stats[0].Written, test.incidents)
+			}
+			if stats[1].Written != test.written || stats[1].Dropped != test.dropped {
+				t.Errorf("blocked sink wrote %d and dropped %d incidents, want %d and %d",
+					stats[1].Written, stats[1].Dropped, test.written, test.dropped)
+			}
+			errsMu.Lock()
+			if len(errs) != int(test.dropped) || slices.ContainsFunc(errs, func(err error) bool { return !errors.Is(err, ErrQueueFull) }) {
+				t.Errorf("reported errors %v, want %d times %v", errs, test.dropped, ErrQueueFull)
+			}
+			errsMu.Unlock()
+
+			if test.queueSize > 0 {
+				close(blocked.release)
+			}
+			if err := fanOut.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if got := fanOut.Stats()[1]; got.Written != uint64(test.incidents)-test.dropped || got.Queued != 0 || !blocked.flushed {
+				t.Errorf("after flushing the sink wrote %d incidents with %d queued, flushed %t", got.Written, got.Queued, blocked.flushed)
+			}
+			fanOut.Close()
+		})
+	}
+}
+
+func TestFanOutReportsFailures(t *testing.T) {
+	failing := &recordingSink{err: errors.New("disk full")}
+	working := &recordingSink{}
+	reported := []string{}
+	fanOut := NewFanOutWithErrorHandler(func(output string, incident *Incident, err error) {
+		reported = append(reported, output+": "+err.Error())
+	}, Output{Name: "failing", Sink: failing}, Output{Name: "working", Sink: working})
+
+	fanOut.Write(newIncident(PortScanning, SeverityLow, "scan"))
+	fanOut.Write(newIncident(DDoSAttack, SeverityLow, "flood"))
+
+	if !slices.Equal(reported, []string{"failing: disk full", "failing: disk full"}) {
+		t.Errorf("reported %v", reported)
+	}
+	if got := working.descriptions(); !slices.Equal(got, []string{"scan", "flood"}) {
+		t.Errorf("working sink received %v", got)
+	}
+	stats := fanOut.Stats()
+	if stats[0].Failed != 2 || stats[0].Written != 0 || stats[1].Written != 2 {
+		t.Errorf("got stats %+v", stats)
+	}
+}
+
+// recordingSink keeps the incidents written to it. It fails with err if set, and waits for release if set
+// after signalling received.
+type recordingSink struct {
+	mu        sync.Mutex
+	incidents []*Incident
+	err       error
+	release   chan struct{}
+	received  chan struct{}
+	flushed   bool
+	closed    bool
+}
+
+// Write implementation according to Sink
+func (sink *recordingSink) Write(incident *Incident) error {
+	if sink.received != nil {
+		sink.received <- struct{}{}
+	}
+	if sink.release != nil {
+		<-sink.release
+	}
+	if sink.err != nil {
+		return sink.err
+	}
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	sink.incidents = append(sink.incidents, incident)
+	return nil
+}
+
+// Flush implementation according to Flusher
+func (sink *recordingSink) Flush() error {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	sink.flushed = true
+	return nil
+}
+
+// Close implementation according to io.Closer
+func (sink *recordingSink) Close() error {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	sink.closed = true
+	return nil
+}
+
+// descriptions returns the descriptions of the incidents received.
+func (sink *recordingSink) descriptions() []string {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	descriptions := []string{}
+	for _, incident := range sink.incidents {
+		descriptions = append(descriptions, incident.Description)
+	}
+	return descriptions
+}
+
+// newIncident returns an incident of the type and severity from 192.0.2.1.
+func newIncident(incidentType IncidentType, severity Severity, description string) *Incident {
+	incident := NewIncident(net.IPv4(192, 0, 2, 1), incidentType, time.Now(), nil)
+	incident.Severity = severity
+	incident.Description = description
+	return incident
+}
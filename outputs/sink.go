@@ -0,0 +1,37 @@
+package outputs
+
+import (
+	. "awesomeProject/model"
+	"slices"
+)
+
+// Sink receives the incidents reported by the NIDS, e.g. to log them or alert about them.
+// A FanOut calls Write of a sink from a single goroutine at a time.
+type Sink interface {
+	Write(incident *Incident) error
+}
+
+// Flusher is implemented by sinks buffering incidents, Flush commits the incidents written so far.
+type Flusher interface {
+	Flush() error
+}
+
+// Reopener is implemented by sinks writing to a file, Reopen opens the file at its path again after it was
+// rotated by an external tool such as logrotate. It may be called while the sink is being written to.
+type Reopener interface {
+	Reopen() error
+}
+
+// Filter selects the incidents a sink receives. The zero value lets every incident pass.
+type Filter struct {
+	MinSeverity Severity       // Incidents of a lower severity are filtered out
+	Types       []IncidentType // Incident types let through, all types if empty
+}
+
+// Matches reports whether the incident passes the filter.
+func (filter Filter) Matches(incident *Incident) bool {
+	if incident.Severity < filter.MinSeverity {
+		return false
+	}
+	return len(filter.Types) == 0 || slices.Contains(filter.Types, incident.Type)
+}
@@ -0,0 +1,331 @@
+package reassembly
+
+import (
+	. "awesomeProject/model"
+	"bytes"
+	"fmt"
+	"net/netip"
+	"sync/atomic"
+	"time"
+)
+
+// DefragmenterRuleName and DefragmenterVersion identify the IP defragmentation in the incidents it raises.
+const (
+	DefragmenterRuleName = "ip_defragmentation"
+	DefragmenterVersion  = "1.0"
+)
+
+// DefragmenterTechniques returns the ATT&CK techniques of the incident types the defragmentation reports.
+func DefragmenterTechniques() map[IncidentType][]Technique {
+	return map[IncidentType][]Technique{
+		FragmentOverlap: FragmentOverlap.Techniques(),
+		TinyFragment:    TinyFragment.Techniques(),
+		FragmentFlood:   FragmentFlood.Techniques(),
+	}
+}
+
+// maxDatagramSize is the largest IP payload a datagram can carry without jumbograms.
+const maxDatagramSize = 65535
+
+// IPDefragmenterConfig bounds the IP defragmentation and sets the limits of the fragment incidents.
+type IPDefragmenterConfig struct {
+	MaxDatagrams    int           // Datagrams reassembled at once, fragments of further datagrams are dropped
+	MaxFragments    int           // Fragments accepted per datagram
+	Timeout         time.Duration // Incomplete datagrams are discarded after this time
+	MinFragmentSize int           // Fragments other than the last one carrying fewer bytes are reported as tiny
+	FloodThreshold  int           // Fragments a source may send within FloodWindow before it is reported
+	FloodWindow     time.Duration
+}
+
+// DefaultIPDefragmenterConfig returns limits that tolerate regular fragmentation on common MTUs.
+func DefaultIPDefragmenterConfig() IPDefragmenterConfig {
+	return IPDefragmenterConfig{
+		MaxDatagrams:    10000,
+		MaxFragments:    64,
+		Timeout:         30 * time.Second,
+		MinFragmentSize: 256,
+		FloodThreshold:  1000,
+		FloodWindow:     10 * time.Second,
+	}
+}
+
+// Validate checks that every limit is positive.
+func (config IPDefragmenterConfig) Validate() error {
+	if config.MaxDatagrams < 1 || config.MaxFragments < 1 {
+		return fmt.Errorf("max datagrams and fragments must be at least 1, got %d and %d", config.MaxDatagrams, config.MaxFragments)
+	}
+	if config.Timeout <= 0 || config.FloodWindow <= 0 {
+		return fmt.Errorf("timeout and flood window must be positive, got %s and %s", config.Timeout, config.FloodWindow)
+	}
+	if config.MinFragmentSize < 0 {
+		return fmt.Errorf("min fragment size must not be negative, got %d", config.MinFragmentSize)
+	}
+	if config.FloodThreshold < 1 {
+		return fmt.Errorf("flood threshold must be at least 1, got %d", config.FloodThreshold)
+	}
+	return nil
+}
+
+// IPDefragmenter reassembles fragmented IPv4 and IPv6 datagrams and reports fragmentation based evasion:
+// overlapping fragments, tiny fragments and fragment floods. Datagrams with overlapping fragments are discarded,
+// so no ambiguous payload reaches the rules.
+// It is not safe for concurrent use, fragments have to pass through it before packets are sharded by flow.
+// Only Dropped may be called concurrently.
+type IPDefragmenter struct {
+	config    IPDefragmenterConfig
+	datagrams map[datagramKey]*datagram
+	sources   map[netip.Addr]*fragmentCount
+	lastSweep time.Time
+	dropped   atomic.Uint64
+}
+
+// datagramKey identifies the fragments of one datagram.
+type datagramKey struct {
+	src, dst netip.Addr
+	protocol Protocol
+	id       uint32
+}
+
+// datagram collects the fragments of a datagram.
+type datagram struct {
+	first     *Packet  // Copy of the fragment at offset 0, describing the datagram
+	data      []byte   // Payload assembled so far
+	ranges    [][2]int // Received [start, end) ranges
+	length    int      // Total payload length, -1 until the last fragment arrived
+	wire      int      // Wire length of all fragments
+	fragments int
+	started   time.Time
+	discarded bool // Overlapping or invalid, remaining fragments are dropped until the timeout
+	tiny      bool // A tiny fragment was already reported
+}
+
+// fragmentCount counts the fragments of a source within the current flood window.
+type fragmentCount struct {
+	windowStart time.Time
+	count       int
+}
+
+// NewIPDefragmenter creates a defragmenter with the given limits.
+func NewIPDefragmenter(config IPDefragmenterConfig) (*IPDefragmenter, error) {
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid IP defragmentation configuration: %w", err)
+	}
+	return &IPDefragmenter{
+		config:    config,
+		datagrams: map[datagramKey]*datagram{},
+		sources:   map[netip.Addr]*fragmentCount{},
+	}, nil
+}
+
+// Dropped returns the number of fragments dropped because of the limits or because their datagram was discarded.
+func (defragmenter *IPDefragmenter) Dropped() uint64 {
+	return defragmenter.dropped.Load()
+}
+
+// Process adds a fragment to its datagram. The fragment is released to the packet pool.
+// Once the datagram is complete, it returns a packet holding the reassembled IP payload, transport header
+// included, and the header fields of the first fragment. Incidents reference copies of the offending fragments.
+func (defragmenter *IPDefragmenter) Process(fragment *Packet) (*Packet, []*Incident) {
+	defer ReleasePacket(fragment)
+
+	now := fragment.Timestamp
+	if now.Sub(defragmenter.lastSweep) >= defragmenter.config.Timeout/4 {
+		defragmenter.sweep(now)
+	}
+
+	incidents := []*Incident{}
+	if count, exceeded := defragmenter.countFragment(fragment); exceeded {
+		threshold := Threshold{
+			Name:     "fragments",
+			Limit:    defragmenter.config.FloodThreshold,
+			Observed: count,
+			Window:   defragmenter.config.FloodWindow,
+		}
+		description := fmt.Sprintf("%s sent more than %d IP fragments within %s", fragment.SrcIP, threshold.Limit, threshold.Window)
+		incidents = append(incidents, newIncident(fragment, FragmentFlood, SeverityMedium, 0.6, description, threshold))
+	}
+
+	src, _ := netip.AddrFromSlice(fragment.SrcIP)
+	dst, _ := netip.AddrFromSlice(fragment.DstIP)
+	key := datagramKey{src: src.Unmap(), dst: dst.Unmap(), protocol: fragment.Protocol, id: fragment.IPID}
+
+	current := defragmenter.datagrams[key]
+	if current == nil {
+		if len(defragmenter.datagrams) >= defragmenter.config.MaxDatagrams {
+			defragmenter.dropped.Add(1)
+			return nil, incidents
+		}
+		current = &datagram{length: -1, started: now}
+		defragmenter.datagrams[key] = current
+	}
+	if current.discarded {
+		defragmenter.dropped.Add(1)
+		return nil, incidents
+	}
+
+	start, end := int(fragment.FragmentOffset), int(fragment.FragmentOffset)+len(fragment.Payload)
+	current.fragments++
+	current.wire += fragment.Length
+
+	// tiny fragments can hide the transport header from filters inspecting only the first fragment
+	tiny := (fragment.MoreFragments && len(fragment.Payload) < defragmenter.config.MinFragmentSize) ||
+		(start == 0 && len(fragment.Payload) < minTransportHeader(fragment.Protocol))
+	if tiny && !current.tiny {
+		current.tiny = true
+		threshold := Threshold{Name: "fragment bytes", Limit: defragmenter.config.MinFragmentSize, Observed: len(fragment.Payload)}
+		description := fmt.Sprintf("%s sent a %d byte IP fragment to %s, too small to carry the %s header or below the %d bytes required",
+			fragment.SrcIP, len(fragment.Payload), fragment.DstIP, fragment.Protocol, threshold.Limit)
+		incidents = append(incidents, newIncident(fragment, TinyFragment, SeverityMedium, 0.7, description, threshold))
+	}
+
+	switch {
+	case end > maxDatagramSize, current.fragments > defragmenter.config.MaxFragments,
+		!fragment.MoreFragments && current.length >= 0 && current.length != end,
+		!fragment.MoreFragments && end < len(current.data),
+		current.length >= 0 && end > current.length:
+		current.discard()
+		defragmenter.dropped.Add(1)
+		return nil, incidents
+	case current.overlaps(start, end, fragment.Payload):
+		current.discard()
+		defragmenter.dropped.Add(1)
+		description := fmt.Sprintf("IP fragment from %s to %s at offset %d overwrites data of the datagram with other bytes", fragment.SrcIP, fragment.DstIP, start)
+		return nil, append(incidents, newIncident(fragment, FragmentOverlap, SeverityHigh, 0.9, description))
+	}
+
+	current.add(start, end, fragment)
+	if !fragment.MoreFragments {
+		current.length = end
+	}
+	if !current.complete() {
+		return nil, incidents
+	}
+
+	delete(defragmenter.datagrams, key)
+	return current.packet(now), incidents
+}
+
+// countFragment counts the fragment for its source. It returns the fragments of the source within the current
+// flood window and whether the source just exceeded the flood threshold.
+func (defragmenter *IPDefragmenter) countFragment(fragment *Packet) (int, bool) {
+	src, _ := netip.AddrFromSlice(fragment.SrcIP)
+	src = src.Unmap()
+
+	count := defragmenter.sources[src]
+	if count == nil || fragment.Timestamp.Sub(count.windowStart) >= defragmenter.config.FloodWindow {
+		count = &fragmentCount{windowStart: fragment.Timestamp}
+		defragmenter.sources[src] = count
+	}
+	count.count++
+	return count.count, count.count == defragmenter.config.FloodThreshold+1
+}
+
+// sweep forgets the datagrams that timed out and the expired flood windows.
+func (defragmenter *IPDefragmenter) sweep(now time.Time) {
+	defragmenter.lastSweep = now
+	for key, current := range defragmenter.datagrams {
+		if now.Sub(current.started) >= defragmenter.config.Timeout {
+			delete(defragmenter.datagrams, key)
+		}
+	}
+	for src, count := range defragmenter.sources {
+		if now.Sub(count.windowStart) >= defragmenter.config.FloodWindow {
+			delete(defragmenter.sources, src)
+		}
+	}
+}
+
+// overlaps reports whether the fragment overlaps data received before.
+// Exact duplicates of a received fragment are not considered overlapping.
+func (current *datagram) overlaps(start, end int, payload []byte) bool {
+	for _, received := range current.ranges {
+		if start < received[1] && received[0] < end {
+			duplicate := start == received[0] && end == received[1] && bytes.Equal(current.data[start:end], payload)
+			return !duplicate
+		}
+	}
+	return false
+}
+
+// add copies the payload of the fragment into the datagram.
+func (current *datagram) add(start, end int, fragment *Packet) {
+	for _, received := range current.ranges {
+		if start == received[0] && end == received[1] {
+			return // duplicate
+		}
+	}
+
+	if end > len(current.data) {
+		current.data = append(current.data, make([]byte, end-len(current.data))...)
+	}
+	copy(current.data[start:end], fragment.Payload)
+	current.ranges = append(current.ranges, [2]int{start, end})
+	if start == 0 {
+		current.first = fragment.Clone()
+		current.first.Payload = nil
+	}
+}
+
+// complete reports whether every byte of the datagram was received.
+func (current *datagram) complete() bool {
+	if current.length < 0 || current.first == nil {
+		return false
+	}
+	received := 0
+	for _, r := range current.ranges {
+		received += r[1] - r[0] // ranges don't overlap
+	}
+	return received == current.length
+}
+
+// discard drops the data of the datagram, its remaining fragments are ignored until the timeout.
+func (current *datagram) discard() {
+	current.discarded = true
+	current.data, current.ranges, current.first = nil, nil, nil
+}
+
+// packet builds the reassembled datagram from the pool.
+func (current *datagram) packet(now time.Time) *Packet {
+	packet := AcquirePacket()
+	first := current.first
+	packet.Timestamp = now
+	packet.Interface = first.Interface
+	packet.Network = first.Network
+	packet.SrcIP = append(packet.SrcIP[:0], first.SrcIP...)
+	packet.DstIP = append(packet.DstIP[:0], first.DstIP...)
+	packet.Protocol = first.Protocol
+	packet.TTL = first.TTL
+	packet.IPID = first.IPID
+	packet.DontFragment = first.DontFragment
+	packet.Extensions = append(packet.Extensions[:0], first.Extensions...)
+	packet.Length = current.wire
+	packet.Payload = append(packet.Payload[:0], current.data...)
+	return packet
+}
+
+// minTransportHeader returns the size of the fixed transport header the first fragment has to carry.
+func minTransportHeader(protocol Protocol) int {
+	switch protocol {
+	case ProtocolTCP:
+		return 20
+	case ProtocolUDP, ProtocolSCTP:
+		return 8
+	default:
+		return 0
+	}
+}
+
+// newIncident creates an incident raised by the defragmentation, referencing a copy of the offending fragment.
+// The incident is built from the copy, as the fragment is released to the packet pool.
+func newIncident(fragment *Packet, incidentType IncidentType, severity Severity, confidence float64, description string, thresholds ...Threshold) *Incident {
+	attempt := fragment.Clone()
+	incident := NewIncident(attempt.SrcIP, incidentType, attempt.Timestamp, attempt)
+	incident.Rule = DefragmenterRuleName
+	incident.RuleVersion = DefragmenterVersion
+	incident.Severity = severity
+	incident.Confidence = confidence
+	incident.Description = description
+	incident.Thresholds = thresholds
+	incident.Techniques = incidentType.Techniques()
+	return incident
+}
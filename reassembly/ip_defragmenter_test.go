@@ -0,0 +1,241 @@
+package reassembly
+
+import (
+	. "awesomeProject/model"
+	"bytes"
+	"net"
+	"slices"
+	"testing"
+	"time"
+)
+
+// fragmentSpec describes a UDP fragment from 10.0.0.1 to 10.0.0.2 of the datagram with IP ID 7.
+type fragmentSpec struct {
+	offset  uint16
+	payload string
+	more    bool
+}
+
+func TestIPDefragmenterDetectsEvasion(t *testing.T) {
+	full := bytes.Repeat([]byte("a"), 512)
+	tests := []struct {
+		name      string
+		fragments []fragmentSpec
+		incidents []IncidentType
+		payload   []byte // Payload of the reassembled datagram, nil if it must not be reassembled
+		dropped   uint64
+	}{
+		{
+			name:      "in order",
+			fragments: []fragmentSpec{{0, string(full[:256]), true}, {256, string(full[256:]), false}},
+			payload:   full,
+		},
+		{
+			name:      "out of order",
+			fragments: []fragmentSpec{{256, string(full[256:]), false}, {0, string(full[:256]), true}},
+			payload:   full,
+		},
+		{
+			name:      "exact duplicate",
+			fragments: []fragmentSpec{{0, string(full[:256]), true}, {0, string(full[:256]), true}, {256, string(full[256:]), false}},
+			payload:   full,
+		},
+		{
+			name:      "overlap with other bytes",
+			fragments: []fragmentSpec{{0, string(full[:256]), true}, {128, string(bytes.Repeat([]byte("b"), 384)), false}},
+			incidents: []IncidentType{FragmentOverlap},
+			dropped:   1,
+		},
+		{
+			name:      "overlap with the same bytes",
+			fragments: []fragmentSpec{{0, string(full[:256]), true}, {128, string(full[128:]), false}},
+			incidents: []IncidentType{FragmentOverlap},
+			dropped:   1,
+		},
+		{
+			name: "fragments of a discarded datagram",
+			fragments: []fragmentSpec{{0, string(full[:256]), true}, {128, string(bytes.Repeat([]byte("b"), 256)), true},
+				{256, string(full[256:]), false}},
+			incidents: []IncidentType{FragmentOverlap},
+			dropped:   2,
+		},
+		{
+			name:      "tiny fragment",
+			fragments: []fragmentSpec{{0, string(full[:16]), true}, {16, string(full[16:]), false}},
+			incidents: []IncidentType{TinyFragment},
+			payload:   full,
+		},
+		{
+			name:      "tiny fragments reported once",
+			fragments: []fragmentSpec{{0, string(full[:8]), true}, {8, string(full[8:16]), true}, {16, string(full[16:]), false}},
+			incidents: []IncidentType{TinyFragment},
+			payload:   full,
+		},
+		{
+			name:      "first fragment too small for the UDP header",
+			fragments: []fragmentSpec{{0, "1234", false}},
+			incidents: []IncidentType{TinyFragment},
+			payload:   []byte("1234"),
+		},
+		{
+			name:      "small last fragment",
+			fragments: []fragmentSpec{{0, string(full[:256]), true}, {256, "x", false}},
+			payload:   append(full[:256:256], 'x'),
+		},
+		{
+			name:      "conflicting lengths",
+			fragments: []fragmentSpec{{256, string(full[256:]), false}, {0, string(full[:256]), false}},
+			dropped:   1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defragmenter, err := NewIPDefragmenter(DefaultIPDefragmenterConfig())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			start := time.Unix(1700000000, 0)
+			incidents := []IncidentType{}
+			var reassembled *Packet
+			for i, spec := range test.fragments {
+				packet, raised := defragmenter.Process(fragment(start.Add(time.Duration(i)*time.Millisecond), spec))
+				for _, incident := range raised {
+					incidents = append(incidents, incident.Type)
+					if incident.Rule != DefragmenterRuleName || incident.Attempt == nil || incident.Attempt.IPID != 7 {
+						t.Errorf("%s incident raised by %q with attempt %v", incident.Type, incident.Rule, incident.Attempt)
+					}
+				}
+				if packet != nil {
+					if reassembled != nil {
+						t.Fatalf("fragment %d reassembled the datagram a second time", i)
+					}
+					reassembled = packet
+				}
+			}
+
+			if !slices.Equal(incidents, test.incidents) {
+				t.Errorf("got incidents %v, want %v", incidents, test.incidents)
+			}
+			switch {
+			case test.payload == nil && reassembled != nil:
+				t.Errorf("datagram was reassembled with %d bytes", len(reassembled.Payload))
+			case test.payload != nil && reassembled == nil:
+				t.Errorf("datagram wasn't reassembled")
+			case reassembled != nil:
+				if !bytes.Equal(reassembled.Payload, test.payload) {
+					t.Errorf("reassembled %q, want %q", reassembled.Payload, test.payload)
+				}
+				if !reassembled.SrcIP.Equal(net.IPv4(10, 0, 0, 1)) || reassembled.Protocol != ProtocolUDP || reassembled.IsFragment() {
+					t.Errorf("reassembled datagram from %s over %s, fragment %t", reassembled.SrcIP, reassembled.Protocol, reassembled.IsFragment())
+				}
+			}
+			if got := defragmenter.Dropped(); got != test.dropped {
+				t.Errorf("dropped %d fragments, want %d", got, test.dropped)
+			}
+		})
+	}
+}
+
+// fragment builds a pooled fragment like the packet decoder does.
+func fragment(timestamp time.Time, spec fragmentSpec) *Packet {
+	packet := AcquirePacket()
+	packet.Timestamp = timestamp
+	packet.Interface = "eth0"
+	packet.Network = NetworkIPv4
+	packet.SrcIP = append(packet.SrcIP[:0], 10, 0, 0, 1)
+	packet.DstIP = append(packet.DstIP[:0], 10, 0, 0, 2)
+	packet.Protocol = ProtocolUDP
+	packet.TTL = 64
+	packet.IPID = 7
+	packet.FragmentOffset = spec.offset
+	packet.MoreFragments = spec.more
+	packet.Payload = append(packet.Payload[:0], spec.payload...)
+	packet.Length = 34 + len(spec.payload)
+	return packet
+}
+
+func TestIPDefragmenterReportsFloods(t *testing.T) {
+	config := DefaultIPDefragmenterConfig()
+	config.FloodThreshold, config.FloodWindow = 3, time.Second
+	defragmenter, err := NewIPDefragmenter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Unix(1700000000, 0)
+	tests := []struct {
+		at       time.Duration // Time of the fragment since the first one
+		observed int           // Fragments recorded by the flood incident, 0 if none is expected
+	}{
+		{0, 0},
+		{100 * time.Millisecond, 0},
+		{200 * time.Millisecond, 0},
+		{300 * time.Millisecond, 4},
+		{400 * time.Millisecond, 0}, // reported once per window
+		{time.Second, 0},            // a new window starts
+		{1100 * time.Millisecond, 0},
+		{1200 * time.Millisecond, 0},
+		{1300 * time.Millisecond, 4},
+	}
+	for i, test := range tests {
+		spec := fragmentSpec{uint16(i%2) * 256, string(bytes.Repeat([]byte("a"), 256)), true}
+		_, incidents := defragmenter.Process(fragment(start.Add(test.at), spec))
+
+		observed := 0
+		for _, incident := range incidents {
+			if incident.Type != FragmentFlood {
+				t.Fatalf("fragment %d raised a %s incident", i, incident.Type)
+			}
+			if len(incident.Thresholds) != 1 || incident.Thresholds[0].Limit != config.FloodThreshold {
+				t.Fatalf("fragment %d raised a flood with thresholds %v", i, incident.Thresholds)
+			}
+			observed = incident.Thresholds[0].Observed
+		}
+		if observed != test.observed {
+			t.Errorf("fragment %d: flood recorded %d fragments, want %d", i, observed, test.observed)
+		}
+	}
+}
+
+func TestIPDefragmenterIncidentsOutliveFragments(t *testing.T) {
+	config := DefaultIPDefragmenterConfig()
+	config.FloodThreshold = 1
+	defragmenter, err := NewIPDefragmenter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Unix(1700000000, 0)
+	defragmenter.Process(fragment(start, fragmentSpec{0, string(bytes.Repeat([]byte("a"), 256)), true}))
+	// a tiny fragment overwriting received data, from a source exceeding the flood threshold
+	_, incidents := defragmenter.Process(fragment(start.Add(time.Millisecond), fragmentSpec{8, "bbbbbbbbbbbbbbbb", true}))
+	if types := incidentTypes(incidents); !slices.Equal(types, []IncidentType{FragmentFlood, TinyFragment, FragmentOverlap}) {
+		t.Fatalf("got incidents %v", types)
+	}
+
+	// the next packets decoded reuse the buffers of the released fragments
+	for i := 0; i < 4; i++ {
+		packet := AcquirePacket()
+		packet.SrcIP = append(packet.SrcIP[:0], 192, 168, 9, 9)
+		packet.DstIP = append(packet.DstIP[:0], 192, 168, 9, 10)
+		defer ReleasePacket(packet)
+	}
+
+	for _, incident := range incidents {
+		if !incident.IP.Equal(net.IPv4(10, 0, 0, 1)) || !incident.Attempt.SrcIP.Equal(net.IPv4(10, 0, 0, 1)) ||
+			!incident.DstIP.Equal(net.IPv4(10, 0, 0, 2)) {
+			t.Errorf("%s incident from %s to %s, attempt from %s", incident.Type, incident.IP, incident.DstIP, incident.Attempt.SrcIP)
+		}
+	}
+}
+
+// incidentTypes returns the types of the incidents.
+func incidentTypes(incidents []*Incident) []IncidentType {
+	types := []IncidentType{}
+	for _, incident := range incidents {
+		types = append(types, incident.Type)
+	}
+	return types
+}
@@ -0,0 +1,382 @@
+package reassembly
+
+import (
+	. "awesomeProject/model"
+	"fmt"
+	"hash/fnv"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// shardCount is the number of independently locked connection tables.
+// Workers process different flows in parallel, so they rarely contend for the same shard.
+const shardCount = 64
+
+// StreamHandler receives the reassembled data of every TCP connection.
+// It is called while the connection is locked and must not call back into the TCPReassembler.
+type StreamHandler interface {
+	HandleStream(stream *StreamData) // Called with each chunk of in-order data of a direction
+	StreamClosed(key StreamKey)      // Called once a direction ended, was reset or timed out
+}
+
+// TCPReassemblerConfig bounds the memory and the lifetime of reassembled connections.
+type TCPReassemblerConfig struct {
+	MaxConnections            int           // Connections tracked at once, further connections are not reassembled
+	MaxBufferedBytesPerStream int           // Out-of-order bytes held per direction before the missing data is skipped
+	MaxBufferedBytesTotal     int           // Out-of-order bytes held across all connections
+	HalfOpenTimeout           time.Duration // Connections whose SYN wasn't answered are dropped after this time without traffic
+	IdleTimeout               time.Duration // Connections without any traffic are closed after this time
+}
+
+// DefaultTCPReassemblerConfig returns limits suited to a single busy link.
+func DefaultTCPReassemblerConfig() TCPReassemblerConfig {
+	return TCPReassemblerConfig{
+		MaxConnections:            100000,
+		MaxBufferedBytesPerStream: 256 * 1024,
+		MaxBufferedBytesTotal:     64 * 1024 * 1024,
+		HalfOpenTimeout:           30 * time.Second,
+		IdleTimeout:               5 * time.Minute,
+	}
+}
+
+// Validate checks that every limit is positive.
+func (config TCPReassemblerConfig) Validate() error {
+	if config.MaxConnections < 1 {
+		return fmt.Errorf("max connections must be at least 1, got %d", config.MaxConnections)
+	}
+	if config.MaxBufferedBytesPerStream < 1 {
+		return fmt.Errorf("max buffered bytes per stream must be at least 1, got %d", config.MaxBufferedBytesPerStream)
+	}
+	if config.MaxBufferedBytesTotal < config.MaxBufferedBytesPerStream {
+		return fmt.Errorf("max buffered bytes total must be at least the per stream limit, got %d", config.MaxBufferedBytesTotal)
+	}
+	if config.HalfOpenTimeout <= 0 || config.IdleTimeout <= 0 {
+		return fmt.Errorf("timeouts must be positive, got %s half-open and %s idle", config.HalfOpenTimeout, config.IdleTimeout)
+	}
+	return nil
+}
+
+// SweepInterval returns how often Sweep should run to honor the timeouts.
+func (config TCPReassemblerConfig) SweepInterval() time.Duration {
+	interval := min(config.HalfOpenTimeout, config.IdleTimeout) / 4
+	return max(interval, time.Second)
+}
+
+// TCPReassembler puts the segments of TCP connections back in order and hands the stream data to a StreamHandler.
+// Retransmitted and overlapping data is delivered once. Out-of-order segments are buffered until the gap is
+// filled, a memory limit is reached or the connection times out, in which case the missing data is skipped.
+// It is safe for concurrent use, packets of one connection must be processed in order.
+type TCPReassembler struct {
+	config   TCPReassemblerConfig
+	handler  StreamHandler
+	shards   [shardCount]shard
+	count    atomic.Int64 // Tracked connections
+	buffered atomic.Int64 // Out-of-order bytes held by all connections
+	rejected atomic.Uint64
+}
+
+// shard is a locked table of connections.
+type shard struct {
+	mu          sync.Mutex
+	connections map[connectionKey]*connection
+}
+
+// connectionKey identifies a connection in both directions by its ordered endpoints.
+type connectionKey [2]netip.AddrPort
+
+// connection holds both directions of a TCP connection.
+type connection struct {
+	iface       string
+	handshaking bool // Only SYNs were seen, the connection is half-open until the handshake continues
+	lastSeen    time.Time
+	halves      [2]*half // The direction seen first, then its reverse
+}
+
+// half is the reassembly state of one direction of a connection.
+type half struct {
+	key      StreamKey
+	started  bool      // nextSeq is known
+	nextSeq  uint32    // Sequence number of the next byte to deliver
+	offset   uint64    // Bytes delivered or skipped so far
+	skipped  int       // Gap to report with the next delivered data
+	pending  []segment // Out-of-order segments sorted by sequence number
+	buffered int
+	finSeen  bool
+	finSeq   uint32 // Sequence number of the FIN
+	closed   bool
+}
+
+// segment is buffered out-of-order data.
+type segment struct {
+	seq       uint32
+	data      []byte
+	timestamp time.Time
+}
+
+// NewTCPReassembler creates a reassembler delivering stream data to handler.
+func NewTCPReassembler(config TCPReassemblerConfig, handler StreamHandler) (*TCPReassembler, error) {
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid TCP reassembly configuration: %w", err)
+	}
+
+	reassembler := &TCPReassembler{config: config, handler: handler}
+	for i := range reassembler.shards {
+		reassembler.shards[i].connections = map[connectionKey]*connection{}
+	}
+	return reassembler, nil
+}
+
+// Connections returns the number of connections currently tracked.
+func (reassembler *TCPReassembler) Connections() int {
+	return int(reassembler.count.Load())
+}
+
+// BufferedBytes returns the number of out-of-order bytes currently held.
+func (reassembler *TCPReassembler) BufferedBytes() int {
+	return int(reassembler.buffered.Load())
+}
+
+// Rejected returns the number of connections that were not reassembled because MaxConnections was reached.
+func (reassembler *TCPReassembler) Rejected() uint64 {
+	return reassembler.rejected.Load()
+}
+
+// Process adds a TCP segment to its connection. Packets of other protocols are ignored.
+// Data that has to be buffered is copied, so the packet can be released afterwards.
+func (reassembler *TCPReassembler) Process(packet *Packet) {
+	if packet.Protocol != ProtocolTCP {
+		return
+	}
+
+	key := StreamKeyOf(packet)
+	connKey := connectionKeyOf(key)
+	shard := reassembler.shardOf(connKey)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	flags := packet.TCPFlags
+	syn := flags.Has(TCPFlagSYN) && !flags.Has(TCPFlagACK)
+	conn := shard.connections[connKey]
+	if conn == nil {
+		if flags.Has(TCPFlagRST) || (len(packet.Payload) == 0 && !flags.Has(TCPFlagSYN)) {
+			return // nothing to reassemble
+		}
+		if reassembler.count.Load() >= int64(reassembler.config.MaxConnections) {
+			reassembler.rejected.Add(1)
+			return
+		}
+		conn = &connection{iface: packet.Interface, handshaking: syn}
+		shard.connections[connKey] = conn
+		reassembler.count.Add(1)
+	}
+	if packet.Timestamp.After(conn.lastSeen) {
+		conn.lastSeen = packet.Timestamp
+	}
+	if !syn {
+		// a SYN-ACK, or the client going on, possibly captured without the other direction
+		conn.handshaking = false
+	}
+
+	if flags.Has(TCPFlagRST) {
+		reassembler.close(shard, connKey, conn)
+		return
+	}
+
+	h := conn.half(key)
+	if h.closed {
+		return
+	}
+
+	seq := packet.Seq
+	if flags.Has(TCPFlagSYN) {
+		if !h.started {
+			h.started, h.nextSeq = true, seq+1
+		}
+		seq++ // the SYN occupies one sequence number
+	}
+	if !h.started {
+		h.started, h.nextSeq, h.skipped = true, seq, -1 // picked up in the middle of the stream
+	}
+	if flags.Has(TCPFlagFIN) {
+		h.finSeen, h.finSeq = true, seq+uint32(len(packet.Payload))
+	}
+
+	if len(packet.Payload) > 0 {
+		if int32(seq-h.nextSeq) > 0 {
+			reassembler.buffer(conn, h, seq, packet.Payload, packet.Timestamp)
+		} else {
+			reassembler.deliver(conn, h, seq, packet.Payload, packet.Timestamp)
+			reassembler.drain(conn, h)
+		}
+	}
+
+	if h.finSeen && h.nextSeq == h.finSeq {
+		reassembler.closeHalf(h)
+		if other := conn.halves[1]; other != nil && conn.halves[0].closed && other.closed {
+			reassembler.remove(shard, connKey)
+		}
+	}
+}
+
+// Sweep closes the connections that timed out at the given time, delivering their buffered data first.
+// Connections seen in one direction only, e.g. on an asymmetric route, are only closed once idle.
+func (reassembler *TCPReassembler) Sweep(now time.Time) {
+	for i := range reassembler.shards {
+		shard := &reassembler.shards[i]
+		shard.mu.Lock()
+		for connKey, conn := range shard.connections {
+			timeout := reassembler.config.IdleTimeout
+			if conn.handshaking {
+				timeout = reassembler.config.HalfOpenTimeout
+			}
+			if now.Sub(conn.lastSeen) >= timeout {
+				reassembler.close(shard, connKey, conn)
+			}
+		}
+		shard.mu.Unlock()
+	}
+}
+
+// CloseAll closes every connection, delivering their buffered data first. It is used on shutdown.
+func (reassembler *TCPReassembler) CloseAll() {
+	for i := range reassembler.shards {
+		shard := &reassembler.shards[i]
+		shard.mu.Lock()
+		for connKey, conn := range shard.connections {
+			reassembler.close(shard, connKey, conn)
+		}
+		shard.mu.Unlock()
+	}
+}
+
+// buffer holds an out-of-order segment, skipping missing data when a memory limit is exceeded.
+func (reassembler *TCPReassembler) buffer(conn *connection, h *half, seq uint32, data []byte, timestamp time.Time) {
+	position := len(h.pending)
+	for position > 0 && int32(seq-h.pending[position-1].seq) < 0 {
+		position--
+	}
+	h.pending = append(h.pending, segment{})
+	copy(h.pending[position+1:], h.pending[position:])
+	h.pending[position] = segment{seq: seq, data: append([]byte(nil), data...), timestamp: timestamp}
+	h.buffered += len(data)
+	reassembler.buffered.Add(int64(len(data)))
+
+	for h.buffered > reassembler.config.MaxBufferedBytesPerStream ||
+		reassembler.buffered.Load() > int64(reassembler.config.MaxBufferedBytesTotal) {
+		if !reassembler.skipGap(conn, h) {
+			break
+		}
+	}
+}
+
+// skipGap gives up on the data missing before the first buffered segment and delivers what follows it.
+// It returns false if nothing is buffered.
+func (reassembler *TCPReassembler) skipGap(conn *connection, h *half) bool {
+	if len(h.pending) == 0 {
+		return false
+	}
+
+	gap := h.pending[0].seq - h.nextSeq
+	if h.skipped >= 0 {
+		h.skipped += int(gap)
+	}
+	h.nextSeq += gap
+	h.offset += uint64(gap)
+	reassembler.drain(conn, h)
+	return true
+}
+
+// deliver hands the part of the data following the already delivered bytes to the handler.
+func (reassembler *TCPReassembler) deliver(conn *connection, h *half, seq uint32, data []byte, timestamp time.Time) {
+	overlap := int(h.nextSeq - seq)
+	if overlap >= len(data) {
+		return // retransmission of delivered data
+	}
+	data = data[overlap:]
+
+	reassembler.handler.HandleStream(&StreamData{
+		Key:       h.key,
+		Interface: conn.iface,
+		Timestamp: timestamp,
+		Data:      data,
+		Offset:    h.offset,
+		Skipped:   h.skipped,
+	})
+	h.skipped = 0
+	h.nextSeq += uint32(len(data))
+	h.offset += uint64(len(data))
+}
+
+// drain delivers the buffered segments that became contiguous.
+func (reassembler *TCPReassembler) drain(conn *connection, h *half) {
+	for len(h.pending) > 0 && int32(h.pending[0].seq-h.nextSeq) <= 0 {
+		next := h.pending[0]
+		h.pending[0] = segment{}
+		h.pending = h.pending[1:]
+		h.buffered -= len(next.data)
+		reassembler.buffered.Add(-int64(len(next.data)))
+		reassembler.deliver(conn, h, next.seq, next.data, next.timestamp)
+	}
+}
+
+// close delivers the buffered data of both directions, notifies the handler and forgets the connection.
+func (reassembler *TCPReassembler) close(shard *shard, connKey connectionKey, conn *connection) {
+	for _, h := range conn.halves {
+		if h == nil || h.closed {
+			continue
+		}
+		for reassembler.skipGap(conn, h) {
+		}
+		reassembler.closeHalf(h)
+	}
+	reassembler.remove(shard, connKey)
+}
+
+// closeHalf marks a direction as ended and notifies the handler.
+func (reassembler *TCPReassembler) closeHalf(h *half) {
+	h.closed = true
+	reassembler.buffered.Add(-int64(h.buffered))
+	h.pending, h.buffered = nil, 0
+	reassembler.handler.StreamClosed(h.key)
+}
+
+// remove forgets a connection.
+func (reassembler *TCPReassembler) remove(shard *shard, connKey connectionKey) {
+	delete(shard.connections, connKey)
+	reassembler.count.Add(-1)
+}
+
+// shardOf returns the shard owning the connection.
+func (reassembler *TCPReassembler) shardOf(connKey connectionKey) *shard {
+	hash := fnv.New32a()
+	for _, endpoint := range connKey {
+		address := endpoint.Addr().As16()
+		hash.Write(address[:])
+		hash.Write([]byte{byte(endpoint.Port() >> 8), byte(endpoint.Port())})
+	}
+	return &reassembler.shards[hash.Sum32()%shardCount]
+}
+
+// half returns the state of the direction the key belongs to, creating it when the reverse direction shows up.
+func (conn *connection) half(key StreamKey) *half {
+	if conn.halves[0] == nil {
+		conn.halves[0] = &half{key: key}
+	}
+	if conn.halves[0].key == key {
+		return conn.halves[0]
+	}
+	if conn.halves[1] == nil {
+		conn.halves[1] = &half{key: key}
+	}
+	return conn.halves[1]
+}
+
+// connectionKeyOf orders the endpoints so both directions map to the same connection.
+func connectionKeyOf(key StreamKey) connectionKey {
+	if key.Src.Compare(key.Dst) > 0 {
+		return connectionKey{key.Dst, key.Src}
+	}
+	return connectionKey{key.Src, key.Dst}
+}
@@ -0,0 +1,272 @@
+package reassembly
+
+import (
+	. "awesomeProject/model"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tcpSegment describes a segment between a client at 10.0.0.1 and the server at 10.0.0.2:80.
+type tcpSegment struct {
+	client  bool // Sent by the client, by the server otherwise
+	flags   TCPFlags
+	seq     uint32
+	payload string
+}
+
+func TestTCPReassemblerOrdersStreams(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   func(*TCPReassemblerConfig)
+		segments []tcpSegment
+		client   string // Transcript of the client direction, see transcriptHandler
+		server   string
+		buffered int // Out-of-order bytes held after the segments
+	}{
+		{
+			name:     "in order",
+			segments: []tcpSegment{{true, TCPFlagSYN, 1000, ""}, {true, TCPFlagACK, 1001, "hello"}, {true, TCPFlagACK, 1006, " world"}},
+			client:   "hello| world",
+		},
+		{
+			name:     "reordered",
+			segments: []tcpSegment{{true, TCPFlagSYN, 1000, ""}, {true, TCPFlagACK, 1006, " world"}, {true, TCPFlagACK, 1001, "hello"}},
+			client:   "hello| world",
+		},
+		{
+			name: "retransmitted and overlapping",
+			segments: []tcpSegment{{true, TCPFlagSYN, 1000, ""}, {true, TCPFlagACK, 1001, "hello"},
+				{true, TCPFlagACK, 1001, "hello wo"}, {true, TCPFlagACK, 1007, "world"}, {true, TCPFlagACK, 1001, "hello"}},
+			client: "hello| wo|rld",
+		},
+		{
+			name: "both directions",
+			segments: []tcpSegment{{true, TCPFlagSYN, 1000, ""}, {false, TCPFlagSYN | TCPFlagACK, 5000, ""},
+				{true, TCPFlagACK, 1001, "ping"}, {false, TCPFlagACK, 5001, "pong"}},
+			client: "ping",
+			server: "pong",
+		},
+		{
+			name:     "picked up in the middle of the stream",
+			segments: []tcpSegment{{true, TCPFlagACK, 7000, "abc"}, {true, TCPFlagACK, 7003, "def"}},
+			client:   "[skipped -1]abc|def",
+		},
+		{
+			name:     "gap held within the limit",
+			segments: []tcpSegment{{true, TCPFlagSYN, 1000, ""}, {true, TCPFlagACK, 1011, "abcdefgh"}},
+			buffered: 8,
+		},
+		{
+			name:     "gap skipped beyond the stream limit",
+			config:   func(config *TCPReassemblerConfig) { config.MaxBufferedBytesPerStream = 8 },
+			segments: []tcpSegment{{true, TCPFlagSYN, 1000, ""}, {true, TCPFlagACK, 1011, "abcdefgh"}, {true, TCPFlagACK, 1019, "ijk"}},
+			client:   "[skipped 10]abcdefgh|ijk",
+		},
+		{
+			name: "gap skipped beyond the total limit",
+			config: func(config *TCPReassemblerConfig) {
+				config.MaxBufferedBytesPerStream, config.MaxBufferedBytesTotal = 8, 10
+			},
+			segments: []tcpSegment{{true, TCPFlagSYN, 1000, ""}, {false, TCPFlagSYN | TCPFlagACK, 5000, ""},
+				{true, TCPFlagACK, 1003, "abcdef"}, {false, TCPFlagACK, 5003, "uvwxyz"}},
+			server:   "[skipped 2]uvwxyz",
+			buffered: 6,
+		},
+		{
+			name: "fin after the data",
+			segments: []tcpSegment{{true, TCPFlagSYN, 1000, ""}, {true, TCPFlagFIN | TCPFlagACK, 1006, " world"},
+				{true, TCPFlagACK, 1001, "hello"}},
+			client: "hello| world|[closed]",
+		},
+		{
+			name: "reset delivers the buffered data",
+			segments: []tcpSegment{{true, TCPFlagSYN, 1000, ""}, {false, TCPFlagSYN | TCPFlagACK, 5000, ""},
+				{true, TCPFlagACK, 1004, "lo"}, {false, TCPFlagRST, 5001, ""}},
+			client: "[skipped 3]lo|[closed]",
+			server: "[closed]",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := DefaultTCPReassemblerConfig()
+			if test.config != nil {
+				test.config(&config)
+			}
+			handler := &transcriptHandler{transcripts: map[StreamKey]*strings.Builder{}}
+			reassembler, err := NewTCPReassembler(config, handler)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			start := time.Unix(1700000000, 0)
+			for i, spec := range test.segments {
+				reassembler.Process(tcpPacket(start.Add(time.Duration(i)*time.Millisecond), 40000, spec))
+			}
+
+			if got := handler.transcript(clientKey(40000)); got != test.client {
+				t.Errorf("client stream %q, want %q", got, test.client)
+			}
+			if got := handler.transcript(clientKey(40000).Reverse()); got != test.server {
+				t.Errorf("server stream %q, want %q", got, test.server)
+			}
+			if got := reassembler.BufferedBytes(); got != test.buffered {
+				t.Errorf("%d bytes buffered, want %d", got, test.buffered)
+			}
+		})
+	}
+}
+
+func TestTCPReassemblerLimitsConnections(t *testing.T) {
+	config := DefaultTCPReassemblerConfig()
+	config.MaxConnections = 2
+	config.HalfOpenTimeout, config.IdleTimeout = 10*time.Second, time.Minute
+	handler := &transcriptHandler{transcripts: map[StreamKey]*strings.Builder{}}
+	reassembler, err := NewTCPReassembler(config, handler)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Unix(1700000000, 0)
+	reassembler.Process(tcpPacket(start, 40000, tcpSegment{true, TCPFlagSYN, 1000, ""}))
+	reassembler.Process(tcpPacket(start, 40001, tcpSegment{true, TCPFlagSYN, 1000, ""}))
+	reassembler.Process(tcpPacket(start, 40001, tcpSegment{false, TCPFlagSYN | TCPFlagACK, 5000, ""}))
+	reassembler.Process(tcpPacket(start, 40002, tcpSegment{true, TCPFlagSYN, 1000, ""}))
+	reassembler.Process(tcpPacket(start, 40003, tcpSegment{true, TCPFlagACK, 1000, ""})) // no data, not tracked
+	if reassembler.Connections() != 2 || reassembler.Rejected() != 1 {
+		t.Fatalf("tracking %d connections with %d rejected, want 2 and 1", reassembler.Connections(), reassembler.Rejected())
+	}
+
+	reassembler.Sweep(start.Add(config.HalfOpenTimeout))
+	if reassembler.Connections() != 1 || handler.transcript(clientKey(40000)) != "[closed]" {
+		t.Fatalf("half-open connection wasn't closed, tracking %d connections", reassembler.Connections())
+	}
+	reassembler.Process(tcpPacket(start.Add(config.HalfOpenTimeout), 40002, tcpSegment{true, TCPFlagSYN, 1000, ""}))
+	reassembler.Process(tcpPacket(start.Add(config.HalfOpenTimeout), 40002, tcpSegment{false, TCPFlagSYN | TCPFlagACK, 5000, ""}))
+	if reassembler.Connections() != 2 {
+		t.Errorf("tracking %d connections after the sweep, want 2", reassembler.Connections())
+	}
+
+	reassembler.Sweep(start.Add(config.IdleTimeout))
+	if reassembler.Connections() != 1 || handler.transcript(clientKey(40001).Reverse()) != "[closed]" {
+		t.Errorf("idle connection wasn't closed, tracking %d connections", reassembler.Connections())
+	}
+	reassembler.CloseAll()
+	if reassembler.Connections() != 0 {
+		t.Errorf("tracking %d connections after closing all", reassembler.Connections())
+	}
+}
+
+func TestTCPReassemblerKeepsOneDirectionStreams(t *testing.T) {
+	tests := []struct {
+		name      string
+		handshake []tcpSegment // Segments before the data, which is sent from seq 1001 on
+		client    bool         // Direction of the data
+		want      string
+	}{
+		{"client leg", []tcpSegment{{true, TCPFlagSYN, 1000, ""}, {true, TCPFlagACK, 1001, ""}}, true, "d0|d1|d2|d3|d4|d5|d6|d7|[closed]"},
+		{"server leg", []tcpSegment{{false, TCPFlagSYN | TCPFlagACK, 1000, ""}}, false, "d0|d1|d2|d3|d4|d5|d6|d7|[closed]"},
+		{"picked up mid-stream", nil, true, "[skipped -1]d0|d1|d2|d3|d4|d5|d6|d7|[closed]"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := DefaultTCPReassemblerConfig()
+			config.HalfOpenTimeout, config.IdleTimeout = 10*time.Second, time.Minute
+			handler := &transcriptHandler{transcripts: map[StreamKey]*strings.Builder{}}
+			reassembler, err := NewTCPReassembler(config, handler)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			now := time.Unix(1700000000, 0)
+			for _, spec := range test.handshake {
+				reassembler.Process(tcpPacket(now, 40000, spec))
+			}
+			// the reverse direction is never seen, the stream lasts much longer than the half-open timeout
+			for i := 0; i < 8; i++ {
+				now = now.Add(15 * time.Second)
+				reassembler.Sweep(now)
+				reassembler.Process(tcpPacket(now, 40000, tcpSegment{test.client, TCPFlagACK, 1001 + uint32(2*i), fmt.Sprintf("d%d", i)}))
+			}
+			reassembler.Sweep(now.Add(config.IdleTimeout))
+
+			key := clientKey(40000)
+			if !test.client {
+				key = key.Reverse()
+			}
+			if got := handler.transcript(key); got != test.want {
+				t.Errorf("got stream %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+// transcriptHandler writes the chunks of each direction separated by "|", preceded by the bytes skipped before them
+// and followed by "[closed]" once the direction ended.
+type transcriptHandler struct {
+	transcripts map[StreamKey]*strings.Builder
+}
+
+// HandleStream implementation according to StreamHandler
+func (handler *transcriptHandler) HandleStream(stream *StreamData) {
+	builder := handler.builder(stream.Key)
+	if stream.Skipped != 0 {
+		fmt.Fprintf(builder, "[skipped %d]", stream.Skipped)
+	}
+	builder.Write(stream.Data)
+}
+
+// StreamClosed implementation according to StreamHandler
+func (handler *transcriptHandler) StreamClosed(key StreamKey) {
+	handler.builder(key).WriteString("[closed]")
+}
+
+// builder returns the transcript of the direction, separating the next entry from the previous one.
+func (handler *transcriptHandler) builder(key StreamKey) *strings.Builder {
+	builder := handler.transcripts[key]
+	if builder == nil {
+		builder = &strings.Builder{}
+		handler.transcripts[key] = builder
+	} else if builder.Len() > 0 {
+		builder.WriteByte('|')
+	}
+	return builder
+}
+
+// transcript returns what was written for the direction.
+func (handler *transcriptHandler) transcript(key StreamKey) string {
+	if builder := handler.transcripts[key]; builder != nil {
+		return builder.String()
+	}
+	return ""
+}
+
+// tcpPacket builds a segment of the connection from client port clientPort to port 80.
+func tcpPacket(timestamp time.Time, clientPort uint16, spec tcpSegment) *Packet {
+	packet := &Packet{
+		Timestamp: timestamp,
+		Interface: "eth0",
+		Network:   NetworkIPv4,
+		SrcIP:     []byte{10, 0, 0, 1},
+		DstIP:     []byte{10, 0, 0, 2},
+		Protocol:  ProtocolTCP,
+		SrcPort:   clientPort,
+		DstPort:   80,
+		TCPFlags:  spec.flags,
+		Seq:       spec.seq,
+		Payload:   []byte(spec.payload),
+	}
+	if !spec.client {
+		packet.SrcIP, packet.DstIP = packet.DstIP, packet.SrcIP
+		packet.SrcPort, packet.DstPort = packet.DstPort, packet.SrcPort
+	}
+	return packet
+}
+
+// clientKey returns the key of the client direction of the connection from clientPort.
+func clientKey(clientPort uint16) StreamKey {
+	return StreamKeyOf(tcpPacket(time.Time{}, clientPort, tcpSegment{client: true}))
+}
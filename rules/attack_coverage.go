@@ -0,0 +1,131 @@
+package rules
+
+import (
+	. "awesomeProject/model"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// CoverageEntry is a cell of the ATT&CK coverage matrix: a technique along with the rules detecting it.
+type CoverageEntry struct {
+	Technique
+	Rules         []string       // Names of the rules detecting the technique
+	IncidentTypes []IncidentType // Incident types the technique is detected through
+}
+
+// CoverageMatrix collects the ATT&CK techniques detected by a set of rules.
+type CoverageMatrix struct {
+	entries map[Technique]*CoverageEntry
+}
+
+// NewCoverageMatrix creates an empty CoverageMatrix.
+func NewCoverageMatrix() *CoverageMatrix {
+	return &CoverageMatrix{entries: make(map[Technique]*CoverageEntry)}
+}
+
+// AddRules adds the techniques declared by the rules. Rules that aren't Mapped don't tell which incident types
+// they report, so they aren't part of the matrix.
+func (matrix *CoverageMatrix) AddRules(rules []Rule) {
+	for _, rule := range rules {
+		matrix.Add(RuleName(rule), RuleTechniques(rule))
+	}
+}
+
+// Add adds the techniques a named detector reports per incident type.
+func (matrix *CoverageMatrix) Add(rule string, techniques map[IncidentType][]Technique) {
+	for incidentType, typeTechniques := range techniques {
+		for _, technique := range typeTechniques {
+			entry := matrix.entries[technique]
+			if entry == nil {
+				entry = &CoverageEntry{Technique: technique}
+				matrix.entries[technique] = entry
+			}
+			if !slices.Contains(entry.Rules, rule) {
+				entry.Rules = append(entry.Rules, rule)
+			}
+			if !slices.Contains(entry.IncidentTypes, incidentType) {
+				entry.IncidentTypes = append(entry.IncidentTypes, incidentType)
+			}
+		}
+	}
+}
+
+// Entries returns the detected techniques ordered by tactic and technique ID, with their rules and incident types sorted.
+func (matrix *CoverageMatrix) Entries() []CoverageEntry {
+	entries := make([]CoverageEntry, 0, len(matrix.entries))
+	for _, entry := range matrix.entries {
+		sorted := *entry
+		sorted.Rules = slices.Sorted(slices.Values(entry.Rules))
+		sorted.IncidentTypes = slices.Sorted(slices.Values(entry.IncidentTypes))
+		entries = append(entries, sorted)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].TacticID != entries[j].TacticID {
+			return entries[i].TacticID < entries[j].TacticID
+		}
+		return entries[i].ID < entries[j].ID
+	})
+	return entries
+}
+
+// WriteCSV writes the matrix as CSV, one technique per row. Rules and incident types are separated by ";".
+func (matrix *CoverageMatrix) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"tactic_id", "tactic", "technique_id", "technique", "rules", "incident_types"})
+	for _, entry := range matrix.Entries() {
+		incidentTypes := make([]string, len(entry.IncidentTypes))
+		for i, incidentType := range entry.IncidentTypes {
+			incidentTypes[i] = incidentType.String()
+		}
+		writer.Write([]string{entry.TacticID, entry.Tactic, entry.ID, entry.Name,
+			strings.Join(entry.Rules, ";"), strings.Join(incidentTypes, ";")})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// navigatorLayer is the subset of the ATT&CK Navigator layer format needed to highlight the covered techniques.
+type navigatorLayer struct {
+	Name        string               `json:"name"`
+	Domain      string               `json:"domain"`
+	Description string               `json:"description"`
+	Versions    map[string]string    `json:"versions"`
+	Techniques  []navigatorTechnique `json:"techniques"`
+}
+
+// navigatorTechnique is a technique of a navigator layer.
+type navigatorTechnique struct {
+	TechniqueID string `json:"techniqueID"`
+	Tactic      string `json:"tactic"`
+	Score       int    `json:"score"`
+	Comment     string `json:"comment"`
+}
+
+// WriteNavigatorLayer writes the matrix as an ATT&CK Navigator layer, which can be opened in the Navigator
+// to show the covered techniques. Each technique is scored with the number of rules detecting it.
+func (matrix *CoverageMatrix) WriteNavigatorLayer(w io.Writer, name string) error {
+	layer := navigatorLayer{
+		Name:        name,
+		Domain:      "enterprise-attack",
+		Description: "Techniques detected by the NIDS rules",
+		Versions:    map[string]string{"layer": "4.5"},
+		Techniques:  []navigatorTechnique{},
+	}
+	for _, entry := range matrix.Entries() {
+		layer.Techniques = append(layer.Techniques, navigatorTechnique{
+			TechniqueID: entry.ID,
+			Tactic:      entry.TacticShortName(),
+			Score:       len(entry.Rules),
+			Comment:     fmt.Sprintf("Detected by %s", strings.Join(entry.Rules, ", ")),
+		})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(layer)
+}
@@ -0,0 +1,61 @@
+package rules
+
+import (
+	. "awesomeProject/model"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCoverageMatrixWriteCSV(t *testing.T) {
+	web, ddos := NewHttpVulnerabilityRule(), NewDDoSRule(100, time.Minute)
+	defer ddos.Stop()
+	web.SetName("web")
+	matrix := NewCoverageMatrix()
+	matrix.AddRules([]Rule{web, ddos, unmappedRule{}})
+	matrix.Add("defragmenter", map[IncidentType][]Technique{FragmentFlood: FragmentFlood.Techniques()})
+
+	var out strings.Builder
+	if err := matrix.WriteCSV(&out); err != nil {
+		t.Fatal(err)
+	}
+	want := "tactic_id,tactic,technique_id,technique,rules,incident_types\n" +
+		"TA0001,Initial Access,T1190,Exploit Public-Facing Application,web,SQL Injection;Code Execution;File Read\n" +
+		"TA0002,Execution,T1059,Command and Scripting Interpreter,web,Code Execution\n" +
+		"TA0009,Collection,T1005,Data from Local System,web,File Read\n" +
+		"TA0040,Impact,T1498.001,Network Denial of Service: Direct Network Flood,ddos,DDoS Attack\n" +
+		"TA0040,Impact,T1499.001,Endpoint Denial of Service: OS Exhaustion Flood,defragmenter,Fragment Flood\n"
+	if out.String() != want {
+		t.Errorf("wrote\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestTechniquesOf(t *testing.T) {
+	exfiltration := LargeVolumeTraffic.Techniques()
+	tests := []struct {
+		name         string
+		rule         Rule
+		incidentType IncidentType
+		want         []Technique
+	}{
+		{"declared", NewHttpVulnerabilityRule(), FileRead, FileRead.Techniques()},
+		{"undeclared type", NewHttpVulnerabilityRule(), LargeVolumeTraffic, exfiltration},
+		{"unmapped rule", unmappedRule{}, LargeVolumeTraffic, exfiltration},
+		{"type without techniques", unmappedRule{}, FragmentOverlap, nil},
+	}
+
+	for _, test := range tests {
+		if got := TechniquesOf(test.rule, test.incidentType); !slices.Equal(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+// unmappedRule is a rule that doesn't declare the techniques of its incidents.
+type unmappedRule struct{}
+
+// Detect implementation according to Rule
+func (unmappedRule) Detect(packet *Packet) []*Incident {
+	return nil
+}
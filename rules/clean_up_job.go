@@ -0,0 +1,41 @@
+package rules
+
+import (
+	"awesomeProject/utils"
+	"time"
+)
+
+// cleanUpInterval is how often the rules prune expired entries from their state.
+const cleanUpInterval = 30 * time.Minute
+
+// cleanUpJob runs a rule's cleanUp function on every tick of a Clock until it is stopped.
+type cleanUpJob struct {
+	ticker utils.Ticker
+	done   chan struct{}
+}
+
+// startCleanUpJob starts a background goroutine that calls cleanUp every interval of the given clock.
+func startCleanUpJob(clock utils.Clock, interval time.Duration, cleanUp func()) *cleanUpJob {
+	job := &cleanUpJob{
+		ticker: clock.NewTicker(interval),
+		done:   make(chan struct{}),
+	}
+
+	go func() {
+		for {
+			select {
+			case <-job.ticker.C():
+				cleanUp() // Call the cleanUp function on every tick
+			case <-job.done:
+				return
+			}
+		}
+	}()
+	return job
+}
+
+// stop stops the ticker and terminates the background goroutine.
+func (job *cleanUpJob) stop() {
+	job.ticker.Stop()
+	close(job.done)
+}
@@ -10,18 +10,30 @@ import (
 
 // DDoSRule detects potential DDoS attempts based on request frequency.
 type DDoSRule struct {
-	sync.Mutex                            // Ensures thread-safe access to RequestLog
-	RequestLog     map[string][]time.Time // Logs requests per Source IP
-	Threshold      int                    // Max allowed requests per IP within the time window
-	WindowDuration time.Duration          // Time window for evaluating requests
+	ruleName                                // Name the rule was given, see Named
+	sync.Mutex                              // Ensures thread-safe access to RequestLog
+	RequestLog       map[string][]time.Time // Logs requests per source IP, or per source prefix for IPv6
+	Threshold        int                    // Max allowed requests per IP within the time window
+	WindowDuration   time.Duration          // Time window for evaluating requests
+	IPv6PrefixLength int                    // IPv6 sources are counted per prefix of this length, 128 counts each address
+	clock            utils.Clock            // Clock used to evaluate the time window
+	cleanUpJob       *cleanUpJob            // Background job pruning expired requests
 }
 
 // NewDDoSRule initializes a new DDoSRule with the given threshold and window duration and starts the cleanup job.
+// IPv6 sources are counted per /64.
 func NewDDoSRule(threshold int, windowDuration time.Duration) *DDoSRule {
+	return NewDDoSRuleWithIPv6Prefix(threshold, windowDuration, DefaultIPv6PrefixLength)
+}
+
+// NewDDoSRuleWithIPv6Prefix initializes a DDoSRule counting IPv6 sources per prefix of the given length.
+func NewDDoSRuleWithIPv6Prefix(threshold int, windowDuration time.Duration, ipv6PrefixLength int) *DDoSRule {
 	rule := &DDoSRule{
-		RequestLog:     make(map[string][]time.Time),
-		Threshold:      threshold,
-		WindowDuration: windowDuration,
+		RequestLog:       make(map[string][]time.Time),
+		Threshold:        threshold,
+		WindowDuration:   windowDuration,
+		IPv6PrefixLength: ipv6PrefixLength,
+		clock:            utils.NewWallClock(),
 	}
 
 	rule.startCleanUpJob() // Start the cleanup job
@@ -31,11 +43,15 @@ func NewDDoSRule(threshold int, windowDuration time.Duration) *DDoSRule {
 // Detect analyzes packets to detect potential DDoS attempts.
 // Returns a flag indicating if an attack is detected, the incident type, and the source IP.
 func (rule *DDoSRule) Detect(packet *Packet) []*Incident {
+	if packet.Network == NetworkARP {
+		return []*Incident{} // ARP addresses are claimed, not used as a source of traffic
+	}
+
 	rule.Lock()
 	defer rule.Unlock()
 
-	srcIP := packet.SrcIP.String()
-	now := time.Now()
+	srcIP := AggregationKey(packet.SrcIP, packet.Interface, rule.IPv6PrefixLength)
+	now := rule.clock.Now()
 
 	// Retrieve the request log for the source IP, initializing if necessary
 	requests := rule.getRequestLog(srcIP)
@@ -51,7 +67,11 @@ func (rule *DDoSRule) Detect(packet *Packet) []*Incident {
 
 	// Detect if the request count exceeds the threshold
 	if len(requests) > rule.Threshold {
-		return []*Incident{NewIncident(packet.SrcIP, DDoSAttack, packet.Timestamp, packet)}
+		threshold := Threshold{Name: "packets", Limit: rule.Threshold, Observed: len(requests), Window: rule.WindowDuration}
+		incident := NewIncident(packet.SrcIP, DDoSAttack, packet.Timestamp, packet)
+		incident.SourcePrefix = AggregatePrefix(packet.SrcIP, rule.IPv6PrefixLength)
+		description := fmt.Sprintf("%s sent %d packets within %s, more than the %d allowed", srcIP, len(requests), rule.WindowDuration, rule.Threshold)
+		return []*Incident{describe(incident, rule, SeverityHigh, exceededConfidence(threshold), description, threshold)}
 	}
 
 	return []*Incident{}
@@ -78,7 +98,7 @@ func (rule *DDoSRule) cleanUp() {
 	defer rule.Unlock()
 
 	fmt.Print("CleanUp activated for DDoSRule\n")
-	now := time.Now()
+	now := rule.clock.Now()
 	for srcIP, requests := range rule.RequestLog {
 		// Clean old requests for each IP
 		rule.RequestLog[srcIP] = rule.cleanOldRequests(requests, now)
@@ -90,16 +110,61 @@ func (rule *DDoSRule) cleanUp() {
 	}
 }
 
-// StartCleanUpJob starts a background goroutine that runs the cleanUp function every 30 minutes.
+// startCleanUpJob starts a background goroutine that runs the cleanUp function every 30 minutes of the rule's clock.
 func (rule *DDoSRule) startCleanUpJob() {
-	ticker := time.NewTicker(30 * time.Minute) // Ticker triggers every 30 minutes
-
-	go func() {
-		for {
-			select {
-			case <-ticker.C:
-				rule.cleanUp() // Call the cleanUp function on every tick
-			}
-		}
-	}()
+	rule.cleanUpJob = startCleanUpJob(rule.clock, cleanUpInterval, rule.cleanUp)
+}
+
+// SetLimits changes the threshold and window duration while keeping the recorded state.
+func (rule *DDoSRule) SetLimits(threshold int, windowDuration time.Duration) {
+	rule.Lock()
+	defer rule.Unlock()
+
+	rule.Threshold = threshold
+	rule.WindowDuration = windowDuration
+}
+
+// SetClock replaces the clock used to evaluate the time window and restarts the cleanup job on it.
+func (rule *DDoSRule) SetClock(clock utils.Clock) {
+	rule.Lock()
+	defer rule.Unlock()
+
+	if rule.cleanUpJob != nil {
+		rule.cleanUpJob.stop()
+	}
+	rule.clock = clock
+	rule.startCleanUpJob()
+}
+
+// Stop stops the cleanup job of the rule.
+func (rule *DDoSRule) Stop() {
+	rule.Lock()
+	defer rule.Unlock()
+
+	if rule.cleanUpJob != nil {
+		rule.cleanUpJob.stop()
+		rule.cleanUpJob = nil
+	}
+}
+
+// Name implementation according to Named, rules that weren't named are called ddos
+func (rule *DDoSRule) Name() string {
+	return rule.nameOr("ddos")
+}
+
+// Version implementation according to Versioned
+func (rule *DDoSRule) Version() string {
+	return "1.0"
+}
+
+// Techniques implementation according to Mapped
+func (rule *DDoSRule) Techniques() map[IncidentType][]Technique {
+	return defaultTechniques(DDoSAttack)
+}
+
+// TrackedKeys implementation according to Tracking
+func (rule *DDoSRule) TrackedKeys() map[string]int {
+	rule.Lock()
+	defer rule.Unlock()
+	return map[string]int{"RequestLog": len(rule.RequestLog)}
 }
@@ -2,42 +2,174 @@ package rules
 
 import (
 	. "awesomeProject/model"
+	"fmt"
 	"strings"
+	"sync"
 )
 
-// HttpVulnerabilityRule implements the Rule interface to detect HTTP vulnerabilities.
-type HttpVulnerabilityRule struct{}
+// HttpIncidentTypes lists the incident types HttpVulnerabilityRule can report, in the order they are checked.
+var HttpIncidentTypes = []IncidentType{SQLInjection, FileRead, CodeExecution}
 
-// NewHttpVulnerabilityRule initializes and returns a new instance of HttpVulnerabilityRule.
+// httpSeverities holds the severity of the incident types reported by HttpVulnerabilityRule.
+var httpSeverities = map[IncidentType]Severity{
+	SQLInjection:  SeverityHigh,
+	FileRead:      SeverityHigh,
+	CodeExecution: SeverityCritical,
+}
+
+// signatureConfidence is the confidence of a signature match, patterns can also occur in benign payloads.
+const signatureConfidence = 0.7
+
+// HttpVulnerabilityRule implements the Rule and StreamRule interfaces to detect HTTP vulnerabilities.
+// On reassembled streams it keeps the last bytes of each direction, so patterns split across segments are found.
+type HttpVulnerabilityRule struct {
+	ruleName                             // Name the rule was given, see Named
+	Signatures map[IncidentType][]string // Payload patterns reported as the incident type they are keyed by, see SetSignatures
+	mu         sync.Mutex                // Guards the signatures and tails
+	tails      map[StreamKey][]byte      // End of the data seen so far per stream, shorter than the longest pattern
+}
+
+// DefaultHttpSignatures returns the built-in vulnerability patterns.
+func DefaultHttpSignatures() map[IncidentType][]string {
+	return map[IncidentType][]string{
+		SQLInjection:  {"' OR '1'='1'", "SELECT * FROM"}, // SQL injection patterns
+		FileRead:      {"/etc/passwd", "file="},          // file read attempts
+		CodeExecution: {"eval(", "exec("},                // code execution attempts
+	}
+}
+
+// NewHttpVulnerabilityRule initializes and returns a new instance of HttpVulnerabilityRule with the default signatures.
 func NewHttpVulnerabilityRule() *HttpVulnerabilityRule {
-	return &HttpVulnerabilityRule{}
+	return NewHttpVulnerabilityRuleWithSignatures(DefaultHttpSignatures())
+}
+
+// NewHttpVulnerabilityRuleWithSignatures initializes a HttpVulnerabilityRule matching the given signatures.
+func NewHttpVulnerabilityRuleWithSignatures(signatures map[IncidentType][]string) *HttpVulnerabilityRule {
+	return &HttpVulnerabilityRule{Signatures: signatures}
 }
 
 // Detect analyzes the packet for specific HTTP vulnerabilities.
 func (r *HttpVulnerabilityRule) Detect(packet *Packet) []*Incident {
 
 	incidents := []*Incident{}
-	if packet.Length == 0 {
+	if len(packet.Payload) == 0 {
 		return incidents
 	}
 
-	// Example checks for vulnerability patterns in the packet
-	payload := packet.Payload
+	// Only the application payload is matched, protocol headers can't trigger a signature
+	payload := string(packet.Payload)
+	r.mu.Lock()
+	signatures := r.Signatures
+	r.mu.Unlock()
 
-	// Check for SQL injection patterns
-	if strings.Contains(payload, "' OR '1'='1'") || strings.Contains(payload, "SELECT * FROM") {
-		incidents = append(incidents, NewIncident(packet.SrcIP, SQLInjection, packet.Timestamp, packet))
+	// Report each incident type at most once
+	for _, incidentType := range HttpIncidentTypes {
+		if pattern, ok := matchAny(payload, signatures[incidentType], 0); ok {
+			incident := NewIncident(packet.SrcIP, incidentType, packet.Timestamp, packet)
+			incidents = append(incidents, r.describe(incident, pattern))
+		}
 	}
 
-	// Check for file read attempts
-	if strings.Contains(payload, "/etc/passwd") || strings.Contains(payload, "file=") {
-		incidents = append(incidents, NewIncident(packet.SrcIP, FileRead, packet.Timestamp, packet))
+	return incidents
+}
+
+// DetectStream analyzes reassembled stream data, together with the end of the data preceding it.
+func (r *HttpVulnerabilityRule) DetectStream(stream *StreamData) []*Incident {
+	incidents := []*Incident{}
+	if len(stream.Data) == 0 {
+		return incidents
 	}
 
-	// Check for code execution attempts
-	if strings.Contains(payload, "eval(") || strings.Contains(payload, "exec(") {
-		incidents = append(incidents, NewIncident(packet.SrcIP, CodeExecution, packet.Timestamp, packet))
+	r.mu.Lock()
+	signatures := r.Signatures
+	tail := r.tails[stream.Key]
+	if stream.Skipped != 0 {
+		tail = nil // the data doesn't continue the tail
+	}
+	payload := string(tail) + string(stream.Data)
+	if keep := r.maxPatternLength() - 1; keep > 0 {
+		if r.tails == nil {
+			r.tails = map[StreamKey][]byte{}
+		}
+		r.tails[stream.Key] = []byte(payload[max(len(payload)-keep, 0):])
+	}
+	r.mu.Unlock()
+
+	// Report each incident type at most once, matches within the tail were reported with the previous data
+	var attempt *Packet
+	for _, incidentType := range HttpIncidentTypes {
+		if pattern, ok := matchAny(payload, signatures[incidentType], len(tail)); ok {
+			if attempt == nil {
+				attempt = stream.Packet()
+			}
+			incident := NewIncident(attempt.SrcIP, incidentType, stream.Timestamp, attempt)
+			incidents = append(incidents, r.describe(incident, pattern))
+		}
 	}
 
 	return incidents
 }
+
+// StreamClosed forgets the tail kept for the stream.
+func (r *HttpVulnerabilityRule) StreamClosed(key StreamKey) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.tails, key)
+}
+
+// SetSignatures replaces the signatures while keeping the tails of the streams.
+func (r *HttpVulnerabilityRule) SetSignatures(signatures map[IncidentType][]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Signatures = signatures
+}
+
+// maxPatternLength returns the length of the longest signature.
+func (r *HttpVulnerabilityRule) maxPatternLength() int {
+	longest := 0
+	for _, patterns := range r.Signatures {
+		for _, pattern := range patterns {
+			longest = max(longest, len(pattern))
+		}
+	}
+	return longest
+}
+
+// matchAny returns the first pattern found in the payload, ignoring matches that end within its first skip bytes.
+func matchAny(payload string, patterns []string, skip int) (string, bool) {
+	for _, pattern := range patterns {
+		start := max(skip-len(pattern)+1, 0)
+		if start <= len(payload) && strings.Contains(payload[start:], pattern) {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+// describe fills in the triage metadata of an incident raised by a signature match.
+func (r *HttpVulnerabilityRule) describe(incident *Incident, pattern string) *Incident {
+	description := fmt.Sprintf("Payload from %s to %s port %d matches the %s signature %q", incident.IP, incident.DstIP, incident.DstPort, incident.Type, pattern)
+	return describe(incident, r, httpSeverities[incident.Type], signatureConfidence, description)
+}
+
+// Name implementation according to Named, rules that weren't named are called http_vulnerability
+func (r *HttpVulnerabilityRule) Name() string {
+	return r.nameOr("http_vulnerability")
+}
+
+// Version implementation according to Versioned
+func (r *HttpVulnerabilityRule) Version() string {
+	return "1.0"
+}
+
+// Techniques implementation according to Mapped
+func (r *HttpVulnerabilityRule) Techniques() map[IncidentType][]Technique {
+	return defaultTechniques(HttpIncidentTypes...)
+}
+
+// TrackedKeys implementation according to Tracking, the stream directions whose last bytes are kept
+func (r *HttpVulnerabilityRule) TrackedKeys() map[string]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return map[string]int{"tails": len(r.tails)}
+}
@@ -16,9 +16,12 @@ type DataTransfer struct {
 
 // LargeVolumeRule detects large data transfers exceeding a threshold within a specific time window.
 type LargeVolumeRule struct {
+	ruleName                                 // Name the rule was given, see Named
 	DataLog        map[string][]DataTransfer // Records of data transfers, keyed by IP address
 	Threshold      int                       // Maximum allowed data volume (in bytes) within the time window
 	WindowDuration time.Duration             // Time window within which data volume is counted
+	clock          utils.Clock               // Clock used to evaluate the time window
+	cleanUpJob     *cleanUpJob               // Background job pruning expired transfers
 	mu             sync.Mutex                // Mutex to ensure thread-safe access to DataLog
 }
 
@@ -28,6 +31,7 @@ func NewLargeVolumeRule(threshold int, windowDuration time.Duration) *LargeVolum
 		DataLog:        make(map[string][]DataTransfer),
 		Threshold:      threshold,
 		WindowDuration: windowDuration,
+		clock:          utils.NewWallClock(),
 	}
 
 	rule.startCleanUpJob() // Start the cleanup job
@@ -37,12 +41,16 @@ func NewLargeVolumeRule(threshold int, windowDuration time.Duration) *LargeVolum
 // Detect checks if the given packet causes a large data transfer.
 // It returns whether the detection is triggered, the type of incident, and the IP involved.
 func (rule *LargeVolumeRule) Detect(packet *Packet) []*Incident {
+	if packet.Network == NetworkARP {
+		return []*Incident{} // ARP addresses are claimed, not used as a source of traffic
+	}
+
 	rule.mu.Lock()
 	defer rule.mu.Unlock()
 
 	// Track data transfers by source IP
-	srcIP := packet.SrcIP.String()
-	now := time.Now()
+	srcIP := AggregationKey(packet.SrcIP, packet.Interface, 128)
+	now := rule.clock.Now()
 
 	// Fetch or initialize the transfer list for this IP
 	transfers := rule.getTransfers(srcIP)
@@ -61,7 +69,10 @@ func (rule *LargeVolumeRule) Detect(packet *Packet) []*Incident {
 
 	// Check if the total volume exceeds the threshold
 	if totalVolume > rule.Threshold {
-		return []*Incident{NewIncident(packet.SrcIP, LargeVolumeTraffic, packet.Timestamp, packet)}
+		threshold := Threshold{Name: "bytes", Limit: rule.Threshold, Observed: totalVolume, Window: rule.WindowDuration}
+		incident := NewIncident(packet.SrcIP, LargeVolumeTraffic, packet.Timestamp, packet)
+		description := fmt.Sprintf("%s sent %d bytes within %s, more than the %d allowed", srcIP, totalVolume, rule.WindowDuration, rule.Threshold)
+		return []*Incident{describe(incident, rule, SeverityMedium, exceededConfidence(threshold), description, threshold)}
 	}
 
 	// No large transfer detected
@@ -106,7 +117,7 @@ func (rule *LargeVolumeRule) cleanUp() {
 	defer rule.mu.Unlock()
 
 	fmt.Print("CleanUp activated for Large Volume rule\n")
-	now := time.Now()
+	now := rule.clock.Now()
 	for ip, transfers := range rule.DataLog {
 		// Clean old transfers for each IP
 		rule.DataLog[ip] = rule.cleanOldTransfers(transfers, now)
@@ -118,16 +129,61 @@ func (rule *LargeVolumeRule) cleanUp() {
 	}
 }
 
-// StartCleanUpJob starts a background goroutine that runs the cleanUp function every 30 minutes.
+// startCleanUpJob starts a background goroutine that runs the cleanUp function every 30 minutes of the rule's clock.
 func (rule *LargeVolumeRule) startCleanUpJob() {
-	ticker := time.NewTicker(30 * time.Minute) // Ticker triggers every 30 minutes
-
-	go func() {
-		for {
-			select {
-			case <-ticker.C:
-				rule.cleanUp() // Call the cleanUp function on every tick
-			}
-		}
-	}()
+	rule.cleanUpJob = startCleanUpJob(rule.clock, cleanUpInterval, rule.cleanUp)
+}
+
+// SetLimits changes the threshold and window duration while keeping the recorded state.
+func (rule *LargeVolumeRule) SetLimits(threshold int, windowDuration time.Duration) {
+	rule.mu.Lock()
+	defer rule.mu.Unlock()
+
+	rule.Threshold = threshold
+	rule.WindowDuration = windowDuration
+}
+
+// SetClock replaces the clock used to evaluate the time window and restarts the cleanup job on it.
+func (rule *LargeVolumeRule) SetClock(clock utils.Clock) {
+	rule.mu.Lock()
+	defer rule.mu.Unlock()
+
+	if rule.cleanUpJob != nil {
+		rule.cleanUpJob.stop()
+	}
+	rule.clock = clock
+	rule.startCleanUpJob()
+}
+
+// Stop stops the cleanup job of the rule.
+func (rule *LargeVolumeRule) Stop() {
+	rule.mu.Lock()
+	defer rule.mu.Unlock()
+
+	if rule.cleanUpJob != nil {
+		rule.cleanUpJob.stop()
+		rule.cleanUpJob = nil
+	}
+}
+
+// Name implementation according to Named, rules that weren't named are called large_volume
+func (rule *LargeVolumeRule) Name() string {
+	return rule.nameOr("large_volume")
+}
+
+// Version implementation according to Versioned
+func (rule *LargeVolumeRule) Version() string {
+	return "1.0"
+}
+
+// Techniques implementation according to Mapped
+func (rule *LargeVolumeRule) Techniques() map[IncidentType][]Technique {
+	return defaultTechniques(LargeVolumeTraffic)
+}
+
+// TrackedKeys implementation according to Tracking
+func (rule *LargeVolumeRule) TrackedKeys() map[string]int {
+	rule.mu.Lock()
+	defer rule.mu.Unlock()
+	return map[string]int{"DataLog": len(rule.DataLog)}
 }
@@ -10,24 +10,35 @@ import (
 
 // ConnectionAttempt holds information about a port and the timestamp of an attempt.
 type ConnectionAttempt struct {
-	Port      string
+	Port      uint16
 	Timestamp time.Time
 }
 
 // PortScanningRule implements logic to detect port scanning behavior.
 type PortScanningRule struct {
+	ruleName // Name the rule was given, see Named
 	sync.Mutex
-	ConnectionAttempts map[string]map[string][]ConnectionAttempt // Tracks attempts per Source IP -> Destination IP
+	ConnectionAttempts map[string]map[string][]ConnectionAttempt // Tracks attempts per Source IP (or IPv6 prefix) -> Destination IP
 	Threshold          int                                       // Maximum allowed attempts within the time window
 	WindowDuration     time.Duration                             // Time window for counting attempts
+	IPv6PrefixLength   int                                       // IPv6 sources are counted per prefix of this length, 128 counts each address
+	clock              utils.Clock                               // Clock used to evaluate the time window
+	cleanUpJob         *cleanUpJob                               // Background job pruning expired attempts
 }
 
-// NewPortScanningRule initializes a new PortScanningRule instance.
+// NewPortScanningRule initializes a new PortScanningRule instance. IPv6 sources are counted per /64.
 func NewPortScanningRule(threshold int, windowDuration time.Duration) *PortScanningRule {
+	return NewPortScanningRuleWithIPv6Prefix(threshold, windowDuration, DefaultIPv6PrefixLength)
+}
+
+// NewPortScanningRuleWithIPv6Prefix initializes a PortScanningRule counting IPv6 sources per prefix of the given length.
+func NewPortScanningRuleWithIPv6Prefix(threshold int, windowDuration time.Duration, ipv6PrefixLength int) *PortScanningRule {
 	rule := &PortScanningRule{
 		ConnectionAttempts: make(map[string]map[string][]ConnectionAttempt),
 		Threshold:          threshold,
 		WindowDuration:     windowDuration,
+		IPv6PrefixLength:   ipv6PrefixLength,
+		clock:              utils.NewWallClock(),
 	}
 
 	rule.startCleanUpJob()
@@ -37,12 +48,16 @@ func NewPortScanningRule(threshold int, windowDuration time.Duration) *PortScann
 // Detect checks if the incoming packet triggers a port scanning detection.
 // Returns detection status, incident type, and the IP involved.
 func (rule *PortScanningRule) Detect(packet *Packet) []*Incident {
+	if !packet.HasPorts() {
+		return []*Incident{} // ICMP, ARP and other protocols don't address ports
+	}
+
 	rule.Lock()
 	defer rule.Unlock()
 
-	srcIP := packet.SrcIP.String()
-	dstIP := packet.DstIP.String()
-	now := time.Now()
+	srcIP := AggregationKey(packet.SrcIP, packet.Interface, rule.IPv6PrefixLength)
+	dstIP := AggregationKey(packet.DstIP, packet.Interface, 128)
+	now := rule.clock.Now()
 
 	// Initialize or retrieve connection attempts for the given srcIP -> dstIP
 	attempts := rule.getConnectionAttempts(srcIP, dstIP)
@@ -58,7 +73,11 @@ func (rule *PortScanningRule) Detect(packet *Packet) []*Incident {
 
 	// Check if the number of attempts exceeds the threshold
 	if len(attempts) > rule.Threshold {
-		return []*Incident{NewIncident(packet.SrcIP, PortScanning, packet.Timestamp, packet)}
+		threshold := Threshold{Name: "ports", Limit: rule.Threshold, Observed: len(attempts), Window: rule.WindowDuration}
+		incident := NewIncident(packet.SrcIP, PortScanning, packet.Timestamp, packet)
+		incident.SourcePrefix = AggregatePrefix(packet.SrcIP, rule.IPv6PrefixLength)
+		description := fmt.Sprintf("%s probed %d ports of %s within %s, more than the %d allowed", srcIP, len(attempts), dstIP, rule.WindowDuration, rule.Threshold)
+		return []*Incident{describe(incident, rule, SeverityMedium, exceededConfidence(threshold), description, threshold)}
 	}
 
 	return []*Incident{}
@@ -86,7 +105,7 @@ func (rule *PortScanningRule) cleanOldAttempts(attempts []ConnectionAttempt, now
 }
 
 // updateAttempt updates the timestamp for an existing port attempt or adds a new one.
-func (rule *PortScanningRule) updateAttempt(attempts []ConnectionAttempt, port string, timestamp time.Time) []ConnectionAttempt {
+func (rule *PortScanningRule) updateAttempt(attempts []ConnectionAttempt, port uint16, timestamp time.Time) []ConnectionAttempt {
 	// Check if an attempt for the same port already exists
 	isExists, existingAttempt := utils.Find(attempts, func(attempt ConnectionAttempt) bool {
 		return attempt.Port == port
@@ -111,7 +130,7 @@ func (rule *PortScanningRule) cleanUp() {
 
 	fmt.Print("CleanUp activated for PortScanningRule\n")
 
-	now := time.Now()
+	now := rule.clock.Now()
 
 	// Iterate over all source IPs
 	for srcIP, dstMap := range rule.ConnectionAttempts {
@@ -136,16 +155,61 @@ func (rule *PortScanningRule) cleanUp() {
 	}
 }
 
-// StartCleanUpJob starts a background goroutine that runs the cleanUp function every 30 minutes.
+// startCleanUpJob starts a background goroutine that runs the cleanUp function every 30 minutes of the rule's clock.
 func (rule *PortScanningRule) startCleanUpJob() {
-	ticker := time.NewTicker(30 * time.Minute)
+	rule.cleanUpJob = startCleanUpJob(rule.clock, cleanUpInterval, rule.cleanUp)
+}
 
-	go func() {
-		for {
-			select {
-			case <-ticker.C:
-				rule.cleanUp() // Call the cleanUp function every 30 minutes
-			}
-		}
-	}()
+// SetLimits changes the threshold and window duration while keeping the recorded state.
+func (rule *PortScanningRule) SetLimits(threshold int, windowDuration time.Duration) {
+	rule.Lock()
+	defer rule.Unlock()
+
+	rule.Threshold = threshold
+	rule.WindowDuration = windowDuration
+}
+
+// SetClock replaces the clock used to evaluate the time window and restarts the cleanup job on it.
+func (rule *PortScanningRule) SetClock(clock utils.Clock) {
+	rule.Lock()
+	defer rule.Unlock()
+
+	if rule.cleanUpJob != nil {
+		rule.cleanUpJob.stop()
+	}
+	rule.clock = clock
+	rule.startCleanUpJob()
+}
+
+// Stop stops the cleanup job of the rule.
+func (rule *PortScanningRule) Stop() {
+	rule.Lock()
+	defer rule.Unlock()
+
+	if rule.cleanUpJob != nil {
+		rule.cleanUpJob.stop()
+		rule.cleanUpJob = nil
+	}
+}
+
+// Name implementation according to Named, rules that weren't named are called port_scanning
+func (rule *PortScanningRule) Name() string {
+	return rule.nameOr("port_scanning")
+}
+
+// Version implementation according to Versioned
+func (rule *PortScanningRule) Version() string {
+	return "1.0"
+}
+
+// Techniques implementation according to Mapped
+func (rule *PortScanningRule) Techniques() map[IncidentType][]Technique {
+	return defaultTechniques(PortScanning)
+}
+
+// TrackedKeys implementation according to Tracking, the sources whose attempts are tracked
+func (rule *PortScanningRule) TrackedKeys() map[string]int {
+	rule.Lock()
+	defer rule.Unlock()
+	return map[string]int{"ConnectionAttempts": len(rule.ConnectionAttempts)}
 }
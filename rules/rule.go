@@ -2,9 +2,149 @@ package rules
 
 import (
 	. "awesomeProject/model"
+	"awesomeProject/utils"
+	"fmt"
+	"strings"
+	"time"
 )
 
 // Rule is an interface representing a detection rule.
 type Rule interface {
 	Detect(packet *Packet) []*Incident
 }
+
+// ClockAware is implemented by rules that evaluate time windows and need to follow the NIDS clock.
+type ClockAware interface {
+	SetClock(clock utils.Clock)
+}
+
+// Stoppable is implemented by rules running background jobs that must be stopped on shutdown.
+type Stoppable interface {
+	Stop()
+}
+
+// WindowedRule is implemented by rules counting traffic over a sliding window.
+// Their limits can be changed without losing the traffic recorded so far.
+type WindowedRule interface {
+	Rule
+	SetLimits(threshold int, windowDuration time.Duration)
+}
+
+// SignatureRule is implemented by rules matching payload signatures.
+// Their signatures can be changed without losing the stream data kept so far.
+type SignatureRule interface {
+	Rule
+	SetSignatures(signatures map[IncidentType][]string)
+}
+
+// StreamRule is implemented by rules inspecting reassembled TCP streams rather than single segments.
+// When TCP reassembly is enabled, Detect only receives the packets of other protocols.
+type StreamRule interface {
+	Rule
+	DetectStream(stream *StreamData) []*Incident
+	StreamClosed(key StreamKey) // Releases the state kept for a direction of a connection
+}
+
+// Named is implemented by rules that can be named, the name identifies the rule in its incidents.
+type Named interface {
+	Name() string
+	SetName(name string)
+}
+
+// RuleName returns the name of the rule, or the name of its type if it can't be named.
+func RuleName(rule Rule) string {
+	if named, ok := rule.(Named); ok {
+		return named.Name()
+	}
+	return strings.TrimPrefix(fmt.Sprintf("%T", rule), "*")
+}
+
+// Versioned is implemented by rules reporting the version of their detection logic, recorded in their incidents.
+type Versioned interface {
+	Version() string
+}
+
+// RuleVersion returns the version of the rule, or an empty string if it doesn't report one.
+func RuleVersion(rule Rule) string {
+	if versioned, ok := rule.(Versioned); ok {
+		return versioned.Version()
+	}
+	return ""
+}
+
+// Mapped is implemented by rules declaring the MITRE ATT&CK techniques of the incident types they report.
+// Incidents of rules that aren't mapped are tagged with the default techniques of their type.
+type Mapped interface {
+	Techniques() map[IncidentType][]Technique
+}
+
+// RuleTechniques returns the techniques of the incident types the rule reports, nil if the rule isn't mapped.
+func RuleTechniques(rule Rule) map[IncidentType][]Technique {
+	if mapped, ok := rule.(Mapped); ok {
+		return mapped.Techniques()
+	}
+	return nil
+}
+
+// TechniquesOf returns the techniques of an incident of the rule: the ones the rule declares for the incident type,
+// or the default techniques of the type.
+func TechniquesOf(rule Rule, incidentType IncidentType) []Technique {
+	if techniques, ok := RuleTechniques(rule)[incidentType]; ok {
+		return techniques
+	}
+	return incidentType.Techniques()
+}
+
+// Tracking is implemented by rules keeping state per host or stream. TrackedKeys returns the number of keys
+// in each of their state maps, keyed by the name of the map, e.g. {"RequestLog": 42}.
+type Tracking interface {
+	TrackedKeys() map[string]int
+}
+
+// defaultTechniques returns the default techniques of the incident types.
+func defaultTechniques(incidentTypes ...IncidentType) map[IncidentType][]Technique {
+	techniques := make(map[IncidentType][]Technique, len(incidentTypes))
+	for _, incidentType := range incidentTypes {
+		techniques[incidentType] = incidentType.Techniques()
+	}
+	return techniques
+}
+
+// describe fills in the triage metadata of an incident raised by the rule.
+func describe(incident *Incident, rule Rule, severity Severity, confidence float64, description string, thresholds ...Threshold) *Incident {
+	incident.Rule = RuleName(rule)
+	incident.RuleVersion = RuleVersion(rule)
+	incident.Severity = severity
+	incident.Confidence = confidence
+	incident.Description = description
+	incident.Thresholds = thresholds
+	incident.Techniques = TechniquesOf(rule, incident.Type)
+	return incident
+}
+
+// exceededConfidence returns the confidence of a threshold being exceeded: 0.5 right above the limit,
+// growing to 1 at twice the limit.
+func exceededConfidence(threshold Threshold) float64 {
+	if threshold.Limit <= 0 {
+		return 1
+	}
+	return min(float64(threshold.Observed)/float64(2*threshold.Limit), 1)
+}
+
+// ruleName is embedded by the built-in rules to hold the name they were given.
+type ruleName struct {
+	name string
+}
+
+// SetName implementation according to Named
+func (n *ruleName) SetName(name string) {
+	n.name = name
+}
+
+// nameOr returns the given name, or the default name of the rule if it wasn't named.
+func (n *ruleName) nameOr(defaultName string) string {
+	if n.name != "" {
+		return n.name
+	}
+	return defaultName
+}
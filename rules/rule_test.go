@@ -0,0 +1,61 @@
+package rules
+
+import (
+	. "awesomeProject/model"
+	"awesomeProject/utils"
+	"net"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestExceededConfidence(t *testing.T) {
+	tests := []struct {
+		limit, observed int
+		confidence      float64
+	}{
+		{10, 11, 0.55},
+		{10, 15, 0.75},
+		{10, 20, 1},
+		{10, 50, 1},
+		{0, 1, 1},
+	}
+
+	for _, test := range tests {
+		threshold := Threshold{Name: "packets", Limit: test.limit, Observed: test.observed}
+		if got := exceededConfidence(threshold); got != test.confidence {
+			t.Errorf("%d of %d allowed: got confidence %g, want %g", test.observed, test.limit, got, test.confidence)
+		}
+	}
+}
+
+func TestDDoSRuleDescribesIncidents(t *testing.T) {
+	clock := utils.NewEventClock()
+	rule := NewDDoSRule(2, time.Minute)
+	rule.SetClock(clock)
+	defer rule.Stop()
+	rule.SetName("flood")
+
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	var incidents []*Incident
+	for i := 0; i < 3; i++ {
+		packet := &Packet{SrcIP: net.IPv4(192, 0, 2, 1), DstIP: net.IPv4(203, 0, 113, 1), Timestamp: start.Add(time.Duration(i) * time.Second)}
+		clock.Advance(packet.Timestamp)
+		incidents = rule.Detect(packet)
+	}
+
+	if len(incidents) != 1 {
+		t.Fatalf("got %d incidents, want 1", len(incidents))
+	}
+	incident := incidents[0]
+	if incident.Rule != "flood" || incident.RuleVersion != "1.0" || incident.Severity != SeverityHigh || incident.Confidence != 0.75 {
+		t.Errorf("got rule %q version %q severity %s confidence %g", incident.Rule, incident.RuleVersion, incident.Severity, incident.Confidence)
+	}
+	want := []Threshold{{Name: "packets", Limit: 2, Observed: 3, Window: time.Minute}}
+	if !slices.Equal(incident.Thresholds, want) {
+		t.Errorf("got thresholds %+v, want %+v", incident.Thresholds, want)
+	}
+	if incident.Description != "192.0.2.1 sent 3 packets within 1m0s, more than the 2 allowed" {
+		t.Errorf("got description %q", incident.Description)
+	}
+}
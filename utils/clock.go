@@ -0,0 +1,150 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the source of time used by the detection rules to evaluate their sliding windows.
+type Clock interface {
+	// Now returns the current time according to the clock.
+	Now() time.Time
+	// Advance reports the timestamp of a packet being processed. Wall clocks ignore it.
+	Advance(timestamp time.Time)
+	// NewTicker returns a ticker that fires every interval according to the clock.
+	NewTicker(interval time.Duration) Ticker
+}
+
+// Ticker delivers ticks of a Clock on a channel.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// WallClock is a Clock backed by the system time, used when capturing live traffic.
+type WallClock struct{}
+
+// NewWallClock creates a new WallClock.
+func NewWallClock() *WallClock {
+	return &WallClock{}
+}
+
+// Now returns the system time.
+func (clock *WallClock) Now() time.Time {
+	return time.Now()
+}
+
+// Advance is a no-op, the wall clock moves on its own.
+func (clock *WallClock) Advance(timestamp time.Time) {}
+
+// NewTicker returns a ticker backed by time.Ticker.
+func (clock *WallClock) NewTicker(interval time.Duration) Ticker {
+	return &wallTicker{ticker: time.NewTicker(interval)}
+}
+
+// wallTicker adapts time.Ticker to the Ticker interface.
+type wallTicker struct {
+	ticker *time.Ticker
+}
+
+func (t *wallTicker) C() <-chan time.Time {
+	return t.ticker.C
+}
+
+func (t *wallTicker) Stop() {
+	t.ticker.Stop()
+}
+
+// EventClock is a Clock driven by packet timestamps, used when replaying saved captures.
+// Its time is the latest timestamp reported through Advance and never moves backwards.
+type EventClock struct {
+	sync.Mutex
+	now     time.Time
+	tickers []*eventTicker
+}
+
+// NewEventClock creates a new EventClock. Its time is zero until the first packet is reported.
+func NewEventClock() *EventClock {
+	return &EventClock{}
+}
+
+// Now returns the latest packet timestamp seen by the clock.
+func (clock *EventClock) Now() time.Time {
+	clock.Lock()
+	defer clock.Unlock()
+	return clock.now
+}
+
+// Advance moves the clock forward to the given timestamp and fires any ticker that became due.
+// Timestamps older than the current time (out of order packets) are ignored.
+func (clock *EventClock) Advance(timestamp time.Time) {
+	clock.Lock()
+	defer clock.Unlock()
+
+	if !timestamp.After(clock.now) {
+		return
+	}
+
+	clock.now = timestamp
+	for _, ticker := range clock.tickers {
+		ticker.advance(timestamp)
+	}
+}
+
+// NewTicker returns a ticker that fires every interval of event time.
+// The first tick is scheduled one interval after the first timestamp the clock sees.
+func (clock *EventClock) NewTicker(interval time.Duration) Ticker {
+	clock.Lock()
+	defer clock.Unlock()
+
+	ticker := &eventTicker{
+		clock:    clock,
+		interval: interval,
+		c:        make(chan time.Time, 1),
+	}
+	if !clock.now.IsZero() {
+		ticker.next = clock.now.Add(interval)
+	}
+	clock.tickers = append(clock.tickers, ticker)
+	return ticker
+}
+
+// removeTicker detaches a stopped ticker from the clock.
+func (clock *EventClock) removeTicker(ticker *eventTicker) {
+	clock.Lock()
+	defer clock.Unlock()
+	clock.tickers = RemoveElement(clock.tickers, ticker)
+}
+
+// eventTicker is a Ticker that fires when the event time of its clock passes the next deadline.
+type eventTicker struct {
+	clock    *EventClock
+	interval time.Duration
+	next     time.Time
+	c        chan time.Time
+}
+
+func (t *eventTicker) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *eventTicker) Stop() {
+	t.clock.removeTicker(t)
+}
+
+// advance fires the ticker if now reached its deadline. Like time.Ticker, ticks are dropped for slow receivers.
+func (t *eventTicker) advance(now time.Time) {
+	if t.next.IsZero() {
+		t.next = now.Add(t.interval)
+		return
+	}
+	if now.Before(t.next) {
+		return
+	}
+
+	select {
+	case t.c <- now:
+	default:
+	}
+	t.next = now.Add(t.interval)
+}
@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+// start is the timestamp of the first packet replayed in the tests.
+var start = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func TestEventClockFollowsPacketTimestamps(t *testing.T) {
+	clock := NewEventClock()
+	if !clock.Now().IsZero() {
+		t.Fatalf("clock starts at %s, want zero", clock.Now())
+	}
+
+	steps := []struct {
+		timestamp time.Time
+		now       time.Time
+	}{
+		{start, start},
+		{start.Add(time.Hour), start.Add(time.Hour)},
+		{start.Add(time.Minute), start.Add(time.Hour)}, // out of order
+		{start.Add(time.Hour + time.Nanosecond), start.Add(time.Hour + time.Nanosecond)},
+	}
+	for i, step := range steps {
+		clock.Advance(step.timestamp)
+		if got := clock.Now(); !got.Equal(step.now) {
+			t.Errorf("step %d: clock at %s, want %s", i, got, step.now)
+		}
+	}
+}
+
+func TestEventClockTicker(t *testing.T) {
+	clock := NewEventClock()
+	ticker := clock.NewTicker(time.Minute) // scheduled by the first packet
+
+	steps := []struct {
+		after time.Duration // Since the first packet
+		tick  bool
+	}{
+		{0, false},
+		{59 * time.Second, false},
+		{time.Minute, true},
+		{time.Minute + 30*time.Second, false},
+		{5 * time.Minute, true}, // missed ticks are dropped, the next one is due a minute later
+		{5*time.Minute + 59*time.Second, false},
+		{6 * time.Minute, true},
+	}
+	for i, step := range steps {
+		now := start.Add(step.after)
+		clock.Advance(now)
+		select {
+		case tick := <-ticker.C():
+			if !step.tick || !tick.Equal(now) {
+				t.Errorf("step %d: ticked at %s", i, tick)
+			}
+		default:
+			if step.tick {
+				t.Errorf("step %d: no tick at %s", i, now)
+			}
+		}
+	}
+
+	late := clock.NewTicker(time.Minute) // scheduled a minute after the current time
+	ticker.Stop()
+	clock.Advance(start.Add(7 * time.Minute))
+	select {
+	case <-ticker.C():
+		t.Errorf("stopped ticker ticked")
+	default:
+	}
+	select {
+	case <-late.C():
+	default:
+		t.Errorf("ticker created after the first packet didn't tick a minute later")
+	}
+}